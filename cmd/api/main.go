@@ -16,19 +16,35 @@
 //	Produces:
 //	- application/json
 //
+//	SecurityDefinitions:
+//	adminToken:
+//	  type: apiKey
+//	  in: header
+//	  name: Authorization
+//
 // swagger:meta
 package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/models"
 	"grocery_scraper/internal/repository"
+	"grocery_scraper/internal/service"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time" // Required for context timeout
 
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -43,62 +59,913 @@ const (
 	DBNameKey     = "DB_NAME"
 )
 
-// initDatabase establishes a connection and initializes the repository.
-func initDatabase(dsn string) repository.OfferRepository {
-	var offerRepo repository.OfferRepository
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// initDatabase establishes a connection and initializes the repositories of the API.
+func initDatabase(dsn string, autoMigrate bool) OfferApi {
+	db, err := database.Open(dsn, &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Fatal Error: Could not connect to the database: %v", err)
 	}
-	log.Println("Successfully connected to PostgreSQL for API server.")
-
-	// Initialize the global repository instance
-	offerRepo = repository.NewPostgresOfferRepository(db)
+	log.Printf("Successfully connected to %s for API server.", database.Dialect(db))
 
-	// Optional: Check if the table is ready (Init() handles migration)
-	if err := offerRepo.Init(context.Background()); err != nil {
-		log.Fatalf("Fatal Error: Database migration failed: %v", err)
+	// Apply pending migrations, or refuse to serve a schema this build does not match
+	if err := migrations.Prepare(context.Background(), db, autoMigrate); err != nil {
+		log.Fatalf("Fatal Error: Database schema is not ready: %v", err)
+	}
+	return OfferApi{
+		offerRepository:    repository.NewOfferRepository(db),
+		productRepository:  repository.NewPostgresProductRepository(db),
+		changeRepository:   repository.NewPostgresOfferChangeRepository(db),
+		overrides:          repository.NewPostgresCategoryOverrideRepository(db),
+		categoryRepository: repository.NewPostgresCategoryRepository(db),
+		runRepository:      repository.NewPostgresScrapeRunRepository(db),
+		storeRepository:    repository.NewPostgresStoreRepository(db),
 	}
-	return offerRepo
 }
 
 type OfferApi struct {
-	offerRepository repository.OfferRepository
+	offerRepository    repository.OfferRepository
+	productRepository  repository.ProductRepository
+	changeRepository   repository.OfferChangeRepository
+	overrides          repository.CategoryOverrideRepository
+	categoryRepository repository.CategoryRepository
+	runRepository      repository.ScrapeRunRepository
+	storeRepository    repository.StoreRepository
+	taxonomy           *service.Taxonomy
+	// adminToken is the bearer token of the write endpoints; empty disables them
+	adminToken string
+}
+
+// requireAdmin lets a request through only with the admin token as its bearer
+// token. Without a configured token the endpoint is disabled.
+func (o OfferApi) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if o.adminToken == "" {
+			http.Error(w, "Writes are disabled: no admin token (APP_ADMIN_TOKEN) is configured", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(o.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "A valid admin token is required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeJSON encodes the value as the JSON response body.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Could not send JSON data", http.StatusInternalServerError)
+		log.Printf("Error encoding JSON: %v", err)
+	}
 }
 
 // swagger:operation GET /api/offers offers listOffers
 //
-// Returns a list of offers.
+// Returns the offers matching the filters.
+//
+// Without a limit every match is returned; with one, the X-Next-Cursor header
+// holds the cursor of the next page.
 //
 // ---
 // tags:
 // - offers
 // produces:
 // - application/json
+// parameters:
+// - name: store
+//   in: query
+//   description: only offers of these stores, by name
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+// - name: storeId
+//   in: query
+//   description: only offers of these stores, by ID
+//   type: array
+//   items:
+//     type: integer
+//   collectionFormat: multi
+// - name: chain
+//   in: query
+//   description: only offers of stores of this chain, e.g. ICA
+//   type: string
+// - name: category
+//   in: query
+//   description: only offers in one of these categories (taxonomy ID or label), including their subcategories
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+// - name: type
+//   in: query
+//   description: only offers of these offer types
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+// - name: minDiscount
+//   in: query
+//   description: minimum discount percentage
+//   type: number
+// - name: maxDiscount
+//   in: query
+//   description: maximum discount percentage
+//   type: number
+// - name: minPrice
+//   in: query
+//   description: minimum sale price
+//   type: number
+// - name: maxPrice
+//   in: query
+//   description: maximum sale price
+//   type: number
+// - name: validOn
+//   in: query
+//   description: only offers valid at this time (RFC 3339 or YYYY-MM-DD, default now)
+//   type: string
+// - name: q
+//   in: query
+//   description: text to search for in the product name and brand
+//   type: string
+// - name: brand
+//   in: query
+//   description: only offers of this brand (case-insensitive)
+//   type: string
+// - name: label
+//   in: query
+//   description: only offers with all of these labels
+//   type: array
+//   items:
+//     type: string
+//     enum: [organic, krav, fairtrade]
+//   collectionFormat: multi
+// - name: diet
+//   in: query
+//   description: only offers with all of these dietary tags
+//   type: array
+//   items:
+//     type: string
+//     enum: [vegan, lactose_free, gluten_free]
+//   collectionFormat: multi
+// - name: swedish
+//   in: query
+//   description: only offers of Swedish (true) or non-Swedish (false) origin
+//   type: boolean
+// - name: sort
+//   in: query
+//   description: numeric field to sort on, prefixed with - for descending order (default id)
+//   type: string
+//   enum: [id, salePrice, originalPrice, salePriceTotal, saleQuantity, discount, discountPercentage, netQuantity, -id, -salePrice, -originalPrice, -salePriceTotal, -saleQuantity, -discount, -discountPercentage, -netQuantity]
+// - name: limit
+//   in: query
+//   description: page size; all matches are returned without it
+//   type: integer
+// - name: cursor
+//   in: query
+//   description: the X-Next-Cursor of the previous page, with the same filters and sort
+//   type: string
 // responses:
 //   '200':
 //     description: An array of offers
+//     headers:
+//       X-Next-Cursor:
+//         description: cursor of the next page, missing on the last page
+//         type: string
 //     schema:
 //       type: array
 //       items:
 //         $ref: "#/definitions/OfferResponse"
+//   '400':
+//     description: Invalid query parameter
 func (o OfferApi) offersHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	query, err := o.parseOfferQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	offers, err := o.offerRepository.GetAllOffers(ctx)
+	page, err := o.offerRepository.QueryOffers(ctx, query)
+	if errors.Is(err, models.ErrUnknownSort) {
+		http.Error(w, "Invalid 'sort' parameter", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidCursor) {
+		http.Error(w, "The cursor does not belong to this sort", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
 		log.Printf("Error fetching offers: %v", err)
 		return
 	}
+	if page.Next != nil {
+		w.Header().Set("X-Next-Cursor", page.Next.String())
+	}
+	writeJSON(w, page.Offers)
+}
+
+// parseOfferQuery reads the offer filters, sort and page from the query parameters.
+func (o OfferApi) parseOfferQuery(params url.Values) (models.OfferQuery, error) {
+	query := models.OfferQuery{
+		Stores:      params["store"],
+		Chain:       params.Get("chain"),
+		Types:       params["type"],
+		Text:        params.Get("q"),
+		Brand:       params.Get("brand"),
+		Labels:      params["label"],
+		DietaryTags: params["diet"],
+	}
+	for _, param := range params["storeId"] {
+		id, err := strconv.ParseUint(param, 10, 0)
+		if err != nil {
+			return query, errors.New("Invalid 'storeId' parameter")
+		}
+		query.StoreIDs = append(query.StoreIDs, uint(id))
+	}
+	for _, category := range params["category"] {
+		if o.taxonomy == nil {
+			query.Categories = append(query.Categories, category)
+			continue
+		}
+		id, ok := o.taxonomy.Resolve(category, false)
+		if !ok {
+			return query, fmt.Errorf("Unknown category %q", category)
+		}
+		// The repository adds the subcategories
+		query.Categories = append(query.Categories, id)
+	}
 
-	if err := json.NewEncoder(w).Encode(offers); err != nil {
-		http.Error(w, "Could not send JSON data", http.StatusInternalServerError)
-		log.Printf("Error encoding JSON: %v", err)
+	var err error
+	for name, target := range map[string]**float64{
+		"minDiscount": &query.MinDiscount,
+		"maxDiscount": &query.MaxDiscount,
+		"minPrice":    &query.MinPrice,
+		"maxPrice":    &query.MaxPrice,
+	} {
+		if value := params.Get(name); value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return query, fmt.Errorf("Invalid '%s' parameter", name)
+			}
+			*target = &f
+		}
+	}
+	if query.ValidAt, err = parseTimeParam(params.Get("validOn")); err != nil {
+		return query, errors.New("Invalid 'validOn' parameter")
+	}
+	if swedish := params.Get("swedish"); swedish != "" {
+		b, err := strconv.ParseBool(swedish)
+		if err != nil {
+			return query, errors.New("Invalid 'swedish' parameter")
+		}
+		query.SwedishOrigin = &b
+	}
+
+	query.Sort, query.Descending = strings.CutPrefix(params.Get("sort"), "-")
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, errors.New("Invalid 'limit' parameter")
+		}
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		if query.After, err = models.ParseOfferCursor(cursor); err != nil {
+			return query, errors.New("Invalid 'cursor' parameter")
+		}
+	}
+	return query, nil
+}
+
+// swagger:operation GET /api/offers/search offers searchOffers
+//
+// Searches the current offers by product name and brand, best match first.
+//
+// The search uses Swedish stemming, so "mjölken" finds "Mjölk", and tolerates typos.
+// The filters of GET /api/offers apply as well; sort and cursor are ignored.
+//
+// ---
+// tags:
+// - offers
+// produces:
+// - application/json
+// parameters:
+// - name: q
+//   in: query
+//   required: true
+//   description: the search text; quotes, "or" and a leading - work as in web searches
+//   type: string
+// - name: store
+//   in: query
+//   description: only offers of these stores, by name
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+// - name: storeId
+//   in: query
+//   description: only offers of these stores, by ID
+//   type: array
+//   items:
+//     type: integer
+//   collectionFormat: multi
+// - name: category
+//   in: query
+//   description: only offers in one of these categories (taxonomy ID or label), including their subcategories
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+// - name: limit
+//   in: query
+//   description: maximum number of results (default 50)
+//   type: integer
+// responses:
+//   '200':
+//     description: The matching offers with their rank and highlighted name
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/OfferSearchResult"
+//   '400':
+//     description: Missing or invalid query parameter
+func (o OfferApi) searchOffersHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		http.Error(w, "Missing 'q' parameter", http.StatusBadRequest)
+		return
+	}
+	query, err := o.parseOfferQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	results, err := o.offerRepository.SearchOffers(ctx, text, query)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error searching offers: %v", err)
+		return
+	}
+	writeJSON(w, results)
+}
+
+// swagger:operation GET /api/products products findProducts
+//
+// Finds canonical products by name or brand.
+//
+// ---
+// tags:
+// - products
+// produces:
+// - application/json
+// parameters:
+// - name: q
+//   in: query
+//   description: text contained in the product name or brand
+//   type: string
+//   required: true
+// responses:
+//   '200':
+//     description: An array of products
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/Product"
+func (o OfferApi) productsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	products, err := o.productRepository.FindProducts(ctx, query)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error finding products: %v", err)
+		return
+	}
+	writeJSON(w, products)
+}
+
+// swagger:operation GET /api/products/{id}/offers products productOffers
+//
+// Returns this week's offers for a product across all stores, cheapest first.
+//
+// ---
+// tags:
+// - products
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   description: the canonical product ID
+//   type: integer
+//   required: true
+// responses:
+//   '200':
+//     description: An array of offers, cheapest unit price first
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/OfferResponse"
+func (o OfferApi) productOffersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	offers, err := o.productRepository.CheapestOffers(ctx, uint(id), time.Now())
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching offers for product %d: %v", id, err)
+		return
+	}
+	writeJSON(w, offers)
+}
+
+// parseTimeParam parses an RFC 3339 or YYYY-MM-DD query parameter; empty is the zero time.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.ParseInLocation(time.DateOnly, value, time.Local)
+	}
+	return t, err
+}
+
+// swagger:operation GET /api/offers/{id}/history offers getOfferHistory
+//
+// Returns every scrape's observation of an offer: prices, discount and type, oldest first.
+//
+// ---
+// tags:
+// - offers
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   required: true
+//   type: integer
+// responses:
+//   '200':
+//     description: The price history of the offer
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/OfferObservation"
+//   '400':
+//     description: Invalid offer id
+func (o OfferApi) offerHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid offer id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	history, err := o.offerRepository.GetOfferHistory(ctx, uint(id))
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching history for offer %d: %v", id, err)
+		return
+	}
+	writeJSON(w, history)
+}
+
+// swagger:operation GET /api/products/{id}/history products getProductHistory
+//
+// Returns the price timeline of a product: every observation of its offers in all stores, oldest first.
+//
+// ---
+// tags:
+// - products
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   required: true
+//   type: integer
+// - name: since
+//   in: query
+//   description: only observations at or after this time (RFC 3339 or YYYY-MM-DD)
+//   type: string
+// responses:
+//   '200':
+//     description: The price history of the product
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/OfferObservation"
+//   '400':
+//     description: Invalid product id or 'since' parameter
+func (o OfferApi) productHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product id", http.StatusBadRequest)
+		return
+	}
+	since, err := parseTimeParam(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid 'since' parameter", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	history, err := o.offerRepository.GetProductHistory(ctx, uint(id), since)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching history for product %d: %v", id, err)
+		return
+	}
+	writeJSON(w, history)
+}
+
+// swagger:operation GET /api/changes changes listChanges
+//
+// Returns offer change events (new, ended, price and discount changes), newest first.
+//
+// ---
+// tags:
+// - changes
+// produces:
+// - application/json
+// parameters:
+// - name: storeId
+//   in: query
+//   description: only changes for this store, by ID; unlike the name it survives renaming the store
+//   type: integer
+// - name: store
+//   in: query
+//   description: only changes for this store name
+//   type: string
+// - name: kind
+//   in: query
+//   description: only changes of this kind
+//   type: string
+//   enum: [new_offer, offer_ended, price_changed, discount_improved, discount_worsened, type_changed]
+// - name: since
+//   in: query
+//   description: only changes detected at or after this time (RFC 3339 or YYYY-MM-DD)
+//   type: string
+// - name: limit
+//   in: query
+//   description: maximum number of changes to return (default 500)
+//   type: integer
+// responses:
+//   '200':
+//     description: An array of offer changes
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/OfferChange"
+//   '400':
+//     description: Invalid query parameter
+func (o OfferApi) changesHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := models.OfferChangeFilter{
+		StoreName: params.Get("store"),
+		Kind:      params.Get("kind"),
+		Limit:     500,
+	}
+	since, err := parseTimeParam(params.Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid 'since' parameter", http.StatusBadRequest)
+		return
 	}
+	filter.Since = since
+	if storeID := params.Get("storeId"); storeID != "" {
+		id, err := strconv.ParseUint(storeID, 10, 0)
+		if err != nil {
+			http.Error(w, "Invalid 'storeId' parameter", http.StatusBadRequest)
+			return
+		}
+		filter.StoreID = uint(id)
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid 'limit' parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	changes, err := o.changeRepository.ListChanges(ctx, filter)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching offer changes: %v", err)
+		return
+	}
+	writeJSON(w, changes)
+}
+
+// swagger:operation GET /api/taxonomy taxonomy getTaxonomy
+//
+// Returns the category taxonomy. Offer categories are the IDs of its categories.
+//
+// ---
+// tags:
+// - taxonomy
+// produces:
+// - application/json
+// responses:
+//   '200':
+//     description: The taxonomy version and its categories
+//     schema:
+//       $ref: "#/definitions/Taxonomy"
+//   '404':
+//     description: No taxonomy is configured
+func (o OfferApi) taxonomyHandler(w http.ResponseWriter, r *http.Request) {
+	if o.taxonomy == nil {
+		http.Error(w, "No category taxonomy configured", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, o.taxonomy.Taxonomy)
+}
+
+// swagger:operation GET /api/categories categories listCategories
+//
+// Returns every category with the number of offers advertised in it and in its subcategories.
+//
+// ---
+// tags:
+// - categories
+// produces:
+// - application/json
+// parameters:
+// - name: validOn
+//   in: query
+//   description: count the offers advertised at this time (RFC 3339 or YYYY-MM-DD, default now)
+//   type: string
+// responses:
+//   '200':
+//     description: An array of categories, by key
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/CategoryCount"
+//   '400':
+//     description: Invalid query parameter
+func (o OfferApi) categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	at, err := parseTimeParam(r.URL.Query().Get("validOn"))
+	if err != nil {
+		http.Error(w, "Invalid 'validOn' parameter", http.StatusBadRequest)
+		return
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	counts, err := o.categoryRepository.CountOffers(ctx, at)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error counting offers per category: %v", err)
+		return
+	}
+	writeJSON(w, counts)
+}
+
+// swagger:operation GET /api/category-overrides categories listCategoryOverrides
+//
+// Returns the manual category overrides, most recently changed first.
+//
+// ---
+// tags:
+// - categories
+// produces:
+// - application/json
+// responses:
+//   '200':
+//     description: An array of category overrides
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/CategoryOverride"
+func (o OfferApi) listOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	overrides, err := o.overrides.ListOverrides(ctx, 0)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching category overrides: %v", err)
+		return
+	}
+	writeJSON(w, overrides)
+}
+
+// categoryOverrideRequest is the body of PUT /api/category-overrides.
+type categoryOverrideRequest struct {
+	ProductID  *uint    `json:"productId"`
+	Name       string   `json:"name"`
+	Categories []string `json:"categories"`
+	Reason     string   `json:"reason"`
+}
+
+// swagger:operation PUT /api/category-overrides categories setCategoryOverride
+//
+// Sets the categories of a canonical product or a product name. The override wins
+// over the categorizer from the next scrape on and is shown to the AI categorizer
+// as an example. Needs the admin token.
+//
+// ---
+// tags:
+// - categories
+// security:
+// - adminToken: []
+// consumes:
+// - application/json
+// produces:
+// - application/json
+// parameters:
+// - name: body
+//   in: body
+//   required: true
+//   schema:
+//     type: object
+//     required: [categories]
+//     properties:
+//       productId:
+//         description: the canonical product to override; takes precedence over name
+//         type: integer
+//       name:
+//         description: the product name to override
+//         type: string
+//       categories:
+//         description: category IDs or labels; resolved against the taxonomy when one is configured
+//         type: array
+//         items:
+//           type: string
+//       reason:
+//         type: string
+// responses:
+//   '200':
+//     description: The saved override
+//     schema:
+//       $ref: "#/definitions/CategoryOverride"
+//   '400':
+//     description: Invalid body or unknown category
+//   '401':
+//     description: Missing or wrong admin token
+//   '403':
+//     description: No admin token is configured, writes are disabled
+//   '404':
+//     description: Product not found
+func (o OfferApi) setOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	var req categoryOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.ProductID == nil && strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Either 'productId' or 'name' is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Categories) == 0 {
+		http.Error(w, "At least one category is required", http.StatusBadRequest)
+		return
+	}
+
+	categories := make([]string, 0, len(req.Categories))
+	for _, category := range req.Categories {
+		if o.taxonomy != nil {
+			id, ok := o.taxonomy.Resolve(category, false)
+			if !ok {
+				http.Error(w, "Unknown category: "+category, http.StatusBadRequest)
+				return
+			}
+			category = id
+		}
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	override := &models.CategoryOverride{
+		ProductID:   req.ProductID,
+		ProductName: strings.TrimSpace(req.Name),
+		Categories:  categories,
+		Reason:      req.Reason,
+	}
+	if req.ProductID != nil {
+		override.Key = service.ProductOverrideKey(*req.ProductID)
+		if override.ProductName == "" {
+			product, err := o.productRepository.GetProduct(ctx, *req.ProductID)
+			if err != nil {
+				http.Error(w, "Product not found", http.StatusNotFound)
+				return
+			}
+			override.ProductName = product.CanonicalName
+		}
+	} else {
+		override.Key = service.NameOverrideKey(override.ProductName)
+	}
+
+	if err := o.overrides.SetOverride(ctx, override); err != nil {
+		http.Error(w, "Could not save the override", http.StatusInternalServerError)
+		log.Printf("Error saving category override: %v", err)
+		return
+	}
+	writeJSON(w, override)
+}
+
+// swagger:operation DELETE /api/category-overrides categories deleteCategoryOverride
+//
+// Removes the override of a canonical product or a product name, so the
+// categorizer decides again. Needs the admin token.
+//
+// ---
+// tags:
+// - categories
+// security:
+// - adminToken: []
+// parameters:
+// - name: productId
+//   in: query
+//   description: the canonical product whose override is removed
+//   type: integer
+// - name: name
+//   in: query
+//   description: the product name whose override is removed
+//   type: string
+// responses:
+//   '204':
+//     description: The override was removed
+//   '400':
+//     description: Neither productId nor name given
+//   '401':
+//     description: Missing or wrong admin token
+//   '403':
+//     description: No admin token is configured, writes are disabled
+//   '404':
+//     description: There was no such override
+func (o OfferApi) deleteOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var key string
+	switch {
+	case params.Get("productId") != "":
+		id, err := strconv.ParseUint(params.Get("productId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid 'productId' parameter", http.StatusBadRequest)
+			return
+		}
+		key = service.ProductOverrideKey(uint(id))
+	case strings.TrimSpace(params.Get("name")) != "":
+		key = service.NameOverrideKey(params.Get("name"))
+	default:
+		http.Error(w, "Either 'productId' or 'name' is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := o.overrides.DeleteOverride(ctx, key)
+	if err != nil {
+		http.Error(w, "Could not delete the override", http.StatusInternalServerError)
+		log.Printf("Error deleting category override: %v", err)
+		return
+	}
+	if !deleted {
+		http.Error(w, "No such override", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // indexHandler serves the main page.
@@ -106,17 +973,163 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "web/index.html")
 }
 
+// swagger:operation GET /api/stores stores listStores
+//
+// Returns the stores in the catalogue with the number of their offers and when they were last scraped.
+//
+// ---
+// tags:
+// - stores
+// produces:
+// - application/json
+// responses:
+//   '200':
+//     description: An array of stores
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/StoreSummary"
+func (o OfferApi) storesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	stores, err := o.storeRepository.ListStoreSummaries(ctx)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching stores: %v", err)
+		return
+	}
+	writeJSON(w, stores)
+}
+
+// swagger:operation GET /api/runs runs listRuns
+//
+// Returns the most recent scrape runs with the result of every store, newest first.
+//
+// ---
+// tags:
+// - runs
+// produces:
+// - application/json
+// parameters:
+// - name: limit
+//   in: query
+//   description: maximum number of runs to return (default 20)
+//   type: integer
+// responses:
+//   '200':
+//     description: An array of scrape runs
+//     schema:
+//       type: array
+//       items:
+//         $ref: "#/definitions/ScrapeRun"
+//   '400':
+//     description: Invalid query parameter
+func (o OfferApi) runsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid 'limit' parameter", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	runs, err := o.runRepository.ListRuns(ctx, limit)
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching scrape runs: %v", err)
+		return
+	}
+	writeJSON(w, runs)
+}
+
+// swagger:operation GET /api/runs/{id} runs getRun
+//
+// Returns a single scrape run with the result of every store.
+//
+// ---
+// tags:
+// - runs
+// produces:
+// - application/json
+// parameters:
+// - name: id
+//   in: path
+//   required: true
+//   type: integer
+// responses:
+//   '200':
+//     description: The scrape run
+//     schema:
+//       $ref: "#/definitions/ScrapeRun"
+//   '400':
+//     description: Invalid run id
+//   '404':
+//     description: No run with this id
+func (o OfferApi) runHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid run id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	run, err := o.runRepository.GetRun(ctx, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Scrape run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not retrieve data from the database", http.StatusInternalServerError)
+		log.Printf("Error fetching scrape run %d: %v", id, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
 func main() {
 	ctx := context.Background()
 	const port = "8080"
 	conf := config.Init()
 	// 1. Initialize Database Connection and Repository
-	database := initDatabase(conf.DBConn)
-	api := OfferApi{database}
+	api := initDatabase(conf.DBConn, conf.Database.AutoMigrate)
+	api.adminToken = conf.AdminToken
+	if conf.Categorization.TaxonomyFile != "" {
+		taxonomy, err := service.LoadTaxonomy(conf.Categorization.TaxonomyFile)
+		if err != nil {
+			log.Fatalf("Fatal Error: Could not load category taxonomy: %v", err)
+		}
+		api.taxonomy = taxonomy
+		// Keep the categories table in step with the taxonomy, for the subtree filters
+		if err := api.categoryRepository.SyncTaxonomy(ctx, taxonomy.Categories); err != nil {
+			log.Fatalf("Fatal Error: Could not save the category taxonomy: %v", err)
+		}
+	}
 	// 2. Set up Handlers
 	http.HandleFunc("/", indexHandler)                // Serves the homepage
 	http.HandleFunc("/api/offers", api.offersHandler) // Serves the JSON data
-	count, err := database.CountOffers(ctx)
+	http.HandleFunc("GET /api/offers/search", api.searchOffersHandler)
+	http.HandleFunc("GET /api/products", api.productsHandler)
+	http.HandleFunc("GET /api/products/{id}/offers", api.productOffersHandler)
+	http.HandleFunc("GET /api/products/{id}/history", api.productHistoryHandler)
+	http.HandleFunc("GET /api/offers/{id}/history", api.offerHistoryHandler)
+	http.HandleFunc("GET /api/changes", api.changesHandler)
+	http.HandleFunc("GET /api/taxonomy", api.taxonomyHandler)
+	http.HandleFunc("GET /api/categories", api.categoriesHandler)
+	http.HandleFunc("GET /api/category-overrides", api.listOverridesHandler)
+	http.HandleFunc("PUT /api/category-overrides", api.requireAdmin(api.setOverrideHandler))
+	http.HandleFunc("DELETE /api/category-overrides", api.requireAdmin(api.deleteOverrideHandler))
+	http.HandleFunc("GET /api/runs", api.runsHandler)
+	http.HandleFunc("GET /api/stores", api.storesHandler)
+	http.HandleFunc("GET /api/runs/{id}", api.runHandler)
+	count, err := api.offerRepository.CountOffers(ctx)
 	if err != nil {
 		log.Fatalf("Error counting offers: %v", err)
 	}
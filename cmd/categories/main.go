@@ -0,0 +1,78 @@
+// Command categories manages the persistent categorization cache.
+//
+// Usage:
+//
+//	categories invalidate <product name> [product name ...]
+//	categories invalidate -older-than 168h
+//	categories invalidate -all
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/repository"
+	"grocery_scraper/internal/service"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: categories invalidate [-all | -older-than <duration> | <product name> ...]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	appConfig := config.Init()
+	db, err := database.Open(appConfig.DBConn, &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := migrations.Prepare(ctx, db, appConfig.Database.AutoMigrate); err != nil {
+		log.Fatalf("Database schema is not ready: %v", err)
+	}
+	cache := repository.NewPostgresCategoryCacheRepository(db)
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "invalidate":
+		fs := flag.NewFlagSet("invalidate", flag.ExitOnError)
+		all := fs.Bool("all", false, "clear the whole cache")
+		olderThan := fs.Duration("older-than", 0, "clear entries older than this")
+		fs.Parse(args)
+
+		var removed int
+		switch {
+		case *all:
+			removed, err = cache.InvalidateCachedCategoriesBefore(ctx, time.Now())
+		case *olderThan > 0:
+			removed, err = cache.InvalidateCachedCategoriesBefore(ctx, time.Now().Add(-*olderThan))
+		case fs.NArg() > 0:
+			names := make([]string, 0, fs.NArg())
+			for _, name := range fs.Args() {
+				names = append(names, service.NormalizeProductName(name))
+			}
+			removed, err = cache.InvalidateCachedCategories(ctx, names)
+		default:
+			usage()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed %d cached category assignments.\n", removed)
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,326 @@
+// Command evaluate runs a categorizer against a labelled dataset and reports
+// precision and recall per category, a confusion matrix, cost and latency. With
+// -baseline it also shows what changed since an earlier report.
+//
+// Usage:
+//
+//	evaluate [-categorizer ai|rules|fallback] [-dataset file] [-rules file] [-taxonomy file] [-out report.json] [-baseline report.json]
+//
+// It needs no database. The stub provider answers from canned responses and needs
+// no network, e.g. for CI:
+//
+//	evaluate -provider stub -endpoint data/categorization_stub.yaml -categorizer fallback -min-f1 0.8
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/llm"
+	"grocery_scraper/internal/service"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	appConfig := config.Load()
+
+	kind := flag.String("categorizer", "ai", "categorizer to evaluate: ai, rules or fallback (ai with the rules as fallback)")
+	dataset := flag.String("dataset", "data/categorization_eval.yaml", "labelled products and their expected categories")
+	rulesFile := flag.String("rules", cmp.Or(appConfig.Categorization.RulesFile, "data/category_rules.yaml"), "category rules of the rules categorizer")
+	taxonomyFile := flag.String("taxonomy", cmp.Or(appConfig.Categorization.TaxonomyFile, "data/taxonomy.yaml"), "allowed categories; empty accepts any label")
+	provider := flag.String("provider", appConfig.LLM.Provider, "LLM provider: gemini, openai or stub")
+	model := flag.String("model", appConfig.LLM.Model, "LLM model")
+	endpoint := flag.String("endpoint", appConfig.LLM.Endpoint, "OpenAI-compatible endpoint, or the response file of the stub provider")
+	batchSize := flag.Int("batch", appConfig.LLM.BatchSize, "products per categorizer call")
+	inputPrice := flag.Float64("input-price", 0, "price per million input tokens, for the cost estimate")
+	outputPrice := flag.Float64("output-price", 0, "price per million output tokens, for the cost estimate")
+	name := flag.String("name", "", "name of the run in the report (default: categorizer and model)")
+	out := flag.String("out", "", "write the report as JSON to this file")
+	baselineFile := flag.String("baseline", "", "compare against a report written earlier with -out")
+	minF1 := flag.Float64("min-f1", 0, "exit with status 1 when the overall F1 score is lower")
+	topLevelOnly := flag.Bool("top-level", false, "compare top-level categories only, e.g. mejeri instead of mejeri.ost")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	var taxonomy *service.Taxonomy
+	if *taxonomyFile != "" {
+		var err error
+		taxonomy, err = service.LoadTaxonomy(*taxonomyFile)
+		if err != nil {
+			log.Fatalf("Failed to load category taxonomy: %v", err)
+		}
+	}
+	withTaxonomy := func(c service.Categorizer) service.Categorizer {
+		if taxonomy == nil {
+			return c
+		}
+		validated, err := service.NewTaxonomyCategorizer(c, taxonomy, appConfig.Categorization.TaxonomyMode)
+		if err != nil {
+			log.Fatalf("Invalid categorization configuration: %v", err)
+		}
+		return validated
+	}
+
+	cases, err := service.LoadEvaluationSet(*dataset, taxonomy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Build the categorizer the same way the parser does, minus the cache: a cached
+	// answer would hide the model being evaluated
+	var usage *llm.UsageCounter
+	newAI := func() service.Categorizer {
+		client, err := llm.New(ctx, llm.Options{
+			Provider:    *provider,
+			Model:       *model,
+			Endpoint:    *endpoint,
+			APIKey:      appConfig.AIAPIKey,
+			Temperature: appConfig.LLM.Temperature,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize the LLM client: %v", err)
+		}
+		usage = llm.NewUsageCounter(client)
+		limited := llm.NewRateLimitedClient(usage, appConfig.LLM.RequestsPerMinute, appConfig.LLM.TokensPerMinute, appConfig.LLM.MaxRetries)
+		aiCat := service.NewAICategorizer(limited, appConfig.LLM.BatchSize, appConfig.LLM.Concurrency)
+		if taxonomy != nil {
+			aiCat.SetCategories(taxonomy.Labels())
+		}
+		return withTaxonomy(aiCat)
+	}
+	newRules := func() service.Categorizer {
+		if *rulesFile == "" {
+			log.Fatal("The rules categorizer needs -rules.")
+		}
+		rules, err := service.LoadRuleCategorizer(*rulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load category rules: %v", err)
+		}
+		return withTaxonomy(rules)
+	}
+
+	var categorizer service.Categorizer
+	switch *kind {
+	case "ai":
+		categorizer = newAI()
+	case "rules":
+		categorizer = newRules()
+	case "fallback":
+		categorizer = service.NewFallbackCategorizer(newAI(), newRules())
+	default:
+		log.Fatalf("Unknown categorizer %q; use ai, rules or fallback.", *kind)
+	}
+
+	if *topLevelOnly {
+		if taxonomy == nil {
+			log.Fatal("-top-level needs a category taxonomy (-taxonomy).")
+		}
+		for i := range cases {
+			cases[i].Categories = topLevel(taxonomy, cases[i].Categories)
+		}
+		categorizer = &topLevelCategorizer{next: categorizer, taxonomy: taxonomy}
+	}
+
+	log.Printf("Evaluating the %s categorizer on %d products from %s...", *kind, len(cases), *dataset)
+	report, err := service.EvaluateCategorizer(ctx, categorizer, cases, *batchSize)
+	if err != nil {
+		log.Fatalf("Evaluation failed: %v", err)
+	}
+	report.Dataset = *dataset
+	report.Name = *name
+	if report.Name == "" {
+		report.Name = *kind
+		if *kind != "rules" {
+			report.Name += " " + *provider
+			if *model != "" {
+				report.Name += "/" + *model
+			}
+		}
+	}
+	if usage != nil {
+		report.Usage = usage.Usage()
+		report.Cost = report.Usage.Cost(*inputPrice, *outputPrice)
+	}
+
+	printReport(report)
+
+	if *baselineFile != "" {
+		baseline, err := readReport(*baselineFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printDiff(baseline, service.DiffEvaluations(baseline, report))
+	}
+
+	if *out != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode the report: %v", err)
+		}
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			log.Fatalf("Failed to write the report: %v", err)
+		}
+		log.Printf("Report written to %s", *out)
+	}
+
+	if report.F1 < *minF1 {
+		fmt.Printf("\nF1 %.3f is below the required %.3f\n", report.F1, *minF1)
+		os.Exit(1)
+	}
+}
+
+// topLevelCategorizer reduces the categories of another categorizer to their top-level
+// ancestors, so categorizers that only know the main categories, like the rules,
+// can be compared with ones that pick subcategories.
+type topLevelCategorizer struct {
+	next     service.Categorizer
+	taxonomy *service.Taxonomy
+}
+
+func (c *topLevelCategorizer) Categorize(ctx context.Context, products []string) (*service.CategorizationResult, error) {
+	result, err := c.next.Categorize(ctx, products)
+	if result != nil {
+		for product, categories := range result.Categories {
+			result.Categories[product] = topLevel(c.taxonomy, categories)
+		}
+	}
+	return result, err
+}
+
+// topLevel maps category IDs to the IDs of their top-level categories.
+func topLevel(taxonomy *service.Taxonomy, categories []string) []string {
+	var roots []string
+	for _, category := range categories {
+		if ancestors := taxonomy.Ancestors(category); len(ancestors) > 0 {
+			category = ancestors[len(ancestors)-1]
+		}
+		if !slices.Contains(roots, category) {
+			roots = append(roots, category)
+		}
+	}
+	return roots
+}
+
+func readReport(path string) (*service.EvaluationReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline report: %w", err)
+	}
+	var report service.EvaluationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+func printReport(r *service.EvaluationReport) {
+	fmt.Printf("\n--- %s on %s ---\n", r.Name, r.Dataset)
+	fmt.Printf("Products:      %d (%d categorized, %d exactly right)\n", r.Products, r.Categorized, r.ExactMatches)
+	fmt.Printf("Precision:     %.3f\n", r.Precision)
+	fmt.Printf("Recall:        %.3f\n", r.Recall)
+	fmt.Printf("F1:            %.3f\n", r.F1)
+	fmt.Printf("Latency:       %s total, %s per product, batch p50 %s, p95 %s, max %s\n",
+		r.Latency.Total, r.Latency.PerProduct, r.Latency.BatchP50, r.Latency.BatchP95, r.Latency.BatchMax)
+	if r.Usage.Requests > 0 {
+		fmt.Printf("Usage:         %d requests (%d failed), %d input and %d output tokens, cost %.4f\n",
+			r.Usage.Requests, r.Usage.Failures, r.Usage.InputTokens, r.Usage.OutputTokens, r.Cost)
+	}
+
+	fmt.Println("\nPer category:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "category\tTP\tFP\tFN\tprecision\trecall\tF1\t")
+	for _, category := range slices.Sorted(maps.Keys(r.Categories)) {
+		s := r.Categories[category]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\t\n",
+			category, s.TruePositives, s.FalsePositives, s.FalseNegatives, s.Precision, s.Recall, s.F1)
+	}
+	w.Flush()
+
+	// Rows are expected, columns predicted categories; only categories that occur are shown
+	labels := make(map[string]bool)
+	for expected, row := range r.Confusion {
+		labels[expected] = true
+		for predicted := range row {
+			labels[predicted] = true
+		}
+	}
+	columns := slices.Sorted(maps.Keys(labels))
+	fmt.Println("\nConfusion matrix (rows expected, columns predicted):")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for i := range columns {
+		fmt.Fprintf(w, "%d\t", i+1)
+	}
+	fmt.Fprintln(w)
+	for i, expected := range columns {
+		fmt.Fprintf(w, "%d %s\t", i+1, expected)
+		for _, predicted := range columns {
+			if n := r.Confusion[expected][predicted]; n > 0 {
+				fmt.Fprintf(w, "%d\t", n)
+			} else {
+				fmt.Fprint(w, ".\t")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	var wrong []service.EvaluationResult
+	for _, res := range r.Results {
+		if !res.ExactMatch() {
+			wrong = append(wrong, res)
+		}
+	}
+	if len(wrong) > 0 {
+		fmt.Println("\nWrong or missing:")
+		for _, res := range wrong {
+			got := strings.Join(res.Predicted, ", ")
+			if got == "" {
+				got = res.Failure
+			}
+			fmt.Printf("  %s: expected %s, got %s\n", res.Product, strings.Join(res.Expected, ", "), got)
+		}
+	}
+}
+
+func printDiff(baseline *service.EvaluationReport, d service.EvaluationDiff) {
+	fmt.Printf("\n--- Compared to %s (%s) ---\n", baseline.Name, baseline.CreatedAt.Format("2006-01-02 15:04"))
+	fmt.Printf("Precision %+.3f, recall %+.3f, F1 %+.3f\n", d.Overall.Precision, d.Overall.Recall, d.Overall.F1)
+	latency := d.PerProductLatency.String()
+	if d.PerProductLatency >= 0 {
+		latency = "+" + latency
+	}
+	fmt.Printf("Latency per product %s, cost %+.4f\n", latency, d.Cost)
+	if len(d.Categories) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "category\tprecision\trecall\tF1\t")
+		for _, category := range slices.Sorted(maps.Keys(d.Categories)) {
+			s := d.Categories[category]
+			fmt.Fprintf(w, "%s\t%+.3f\t%+.3f\t%+.3f\t\n", category, s.Precision, s.Recall, s.F1)
+		}
+		w.Flush()
+	}
+	printProducts("Fixed", d.Fixed)
+	printProducts("Broken", d.Broken)
+	printProducts("New in dataset", d.Added)
+	printProducts("No longer in dataset", d.Removed)
+}
+
+func printProducts(title string, products []string) {
+	if len(products) == 0 {
+		return
+	}
+	fmt.Printf("%s (%d):\n", title, len(products))
+	for _, product := range products {
+		fmt.Printf("  %s\n", product)
+	}
+}
@@ -0,0 +1,115 @@
+// Command migrate applies and reverts the versioned database migrations.
+//
+// Usage:
+//
+//	migrate up
+//	migrate down [steps]
+//	migrate to <version>
+//	migrate status
+package main
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate <up|down [steps]|to <version>|status>")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	appConfig := config.Init()
+	db, err := database.Open(appConfig.DBConn, &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	ctx := context.Background()
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations("Applied", applied)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				usage()
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		printMigrations("Reverted", reverted)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "to":
+		if len(args) != 1 {
+			usage()
+		}
+		version, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			usage()
+		}
+		changed, err := migrator.To(ctx, uint(version))
+		printMigrations("Migrated", changed)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	default:
+		usage()
+	}
+
+	current, err := migrator.Current(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Database at version %d of %d.\n", current, migrator.Latest())
+}
+
+func printMigrations(verb string, changed []migrations.Migration) {
+	if len(changed) == 0 {
+		fmt.Println("Nothing to do.")
+		return
+	}
+	for _, m := range changed {
+		fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+}
@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/llm"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/models"
 	"grocery_scraper/internal/parser"
 	"grocery_scraper/internal/repository"
 	"grocery_scraper/internal/service"
 	"log"
+	"os"
+	"runtime/debug"
+	"slices"
+	"time"
 
 	"golang.org/x/sync/errgroup"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -26,82 +33,281 @@ func main() {
 	}
 
 	// 2. Database Connection (using GORM)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	db, err := database.Open(dsn, &gorm.Config{
 		PrepareStmt: true,
 	})
 	if err != nil {
 		log.Fatalf("Error connecting to database with GORM using DSN '%s': %v", dsn, err)
 	}
-	log.Println("Successfully connected to PostgreSQL using GORM!")
+	log.Printf("Successfully connected to %s using GORM!", database.Dialect(db))
 
 	// 3. Dependency Injection: Initialize components
 	icaRepo := repository.NewICARepository()
-	offerRepo := repository.NewPostgresOfferRepository(db)
+	offerRepo := repository.NewOfferRepository(db)
+	quarantineRepo := repository.NewPostgresQuarantineRepository(db)
+	productRepo := repository.NewPostgresProductRepository(db)
+	changeRepo := repository.NewPostgresOfferChangeRepository(db)
+	overrideRepo := repository.NewPostgresCategoryOverrideRepository(db)
+	runRepo := repository.NewPostgresScrapeRunRepository(db)
 
 	// 4. Database Migration
 	ctx := context.Background()
-	if err := offerRepo.Init(ctx); err != nil {
-		log.Fatalf("Failed to run database auto-migration: %v", err)
+	if err := migrations.Prepare(ctx, db, appConfig.Database.AutoMigrate); err != nil {
+		log.Fatalf("Database schema is not ready: %v", err)
 	}
 	log.Println("Database structure verified/migrated successfully.")
 
-	// Initialize AI Categorizer
+	// Link the configured stores to their rows in the stores table; offers are saved by store ID
+	targetStores, err = service.RegisterStores(ctx, repository.NewPostgresStoreRepository(db), targetStores)
+	if err != nil {
+		log.Fatalf("Failed to register stores: %v", err)
+	}
+
+	// Load the category taxonomy; categorizer results are validated against it
+	var taxonomy *service.Taxonomy
+	if appConfig.Categorization.TaxonomyFile != "" {
+		taxonomy, err = service.LoadTaxonomy(appConfig.Categorization.TaxonomyFile)
+		if err != nil {
+			log.Fatalf("Failed to load category taxonomy: %v", err)
+		}
+		log.Printf("Loaded category taxonomy v%d (%d categories).", taxonomy.Version, len(taxonomy.Categories))
+		// Offers are linked to the categories table; the taxonomy gives it labels and parents
+		if err := repository.NewPostgresCategoryRepository(db).SyncTaxonomy(ctx, taxonomy.Categories); err != nil {
+			log.Fatalf("Failed to save the category taxonomy: %v", err)
+		}
+	}
+	// withTaxonomy maps a categorizer's labels to taxonomy IDs, so the fallback below
+	// also covers products whose AI labels were all rejected.
+	withTaxonomy := func(c service.Categorizer) service.Categorizer {
+		if taxonomy == nil {
+			return c
+		}
+		validated, err := service.NewTaxonomyCategorizer(c, taxonomy, appConfig.Categorization.TaxonomyMode)
+		if err != nil {
+			log.Fatalf("Invalid categorization configuration: %v", err)
+		}
+		return validated
+	}
+
+	// Initialize AI Categorizer. Gemini needs an API key; an OpenAI-compatible
+	// endpoint such as a local Ollama server may not.
 	var categorizer service.Categorizer
-	if appConfig.AIAPIKey != "" {
-		var err error
-		categorizer, err = service.NewAICategorizer(ctx, appConfig.AIAPIKey)
+	var attributeExtractor service.AttributeExtractor
+	if appConfig.AIAPIKey != "" || appConfig.LLM.Provider == llm.ProviderOpenAI {
+		client, err := llm.New(ctx, llm.Options{
+			Provider:    appConfig.LLM.Provider,
+			Model:       appConfig.LLM.Model,
+			Endpoint:    appConfig.LLM.Endpoint,
+			APIKey:      appConfig.AIAPIKey,
+			Temperature: appConfig.LLM.Temperature,
+		})
 		if err != nil {
-			log.Printf("Warning: Failed to initialize AI Categorizer: %v. Categorization will be skipped.", err)
+			log.Printf("Warning: Failed to initialize AI Categorizer: %v.", err)
 		} else {
-			log.Println("AI Categorizer initialized successfully.")
-			if aiCat, ok := categorizer.(*service.AICategorizer); ok {
-				defer aiCat.Close()
+			log.Printf("AI Categorizer initialized successfully (provider %s).", appConfig.LLM.Provider)
+			// One limiter for the whole run, so the budget covers all stores together
+			client = llm.NewRateLimitedClient(client, appConfig.LLM.RequestsPerMinute, appConfig.LLM.TokensPerMinute, appConfig.LLM.MaxRetries)
+			aiCat := service.NewAICategorizer(client, appConfig.LLM.BatchSize, appConfig.LLM.Concurrency)
+			defer aiCat.Close()
+			if taxonomy != nil {
+				aiCat.SetCategories(taxonomy.Labels())
+			}
+			// Manual corrections teach the model how similar products should be categorized
+			if appConfig.Categorization.OverrideExamples > 0 {
+				overrides, err := overrideRepo.ListOverrides(ctx, appConfig.Categorization.OverrideExamples)
+				if err != nil {
+					log.Printf("Warning: could not load category overrides as examples: %v", err)
+				}
+				aiCat.SetExamples(service.OverrideExamples(overrides, taxonomy))
+			}
+			categorizer = aiCat
+			if appConfig.LLM.ExtractAttributes {
+				attributeExtractor = service.NewAIAttributeExtractor(client, appConfig.LLM.BatchSize, appConfig.LLM.Concurrency)
 			}
 		}
 	} else {
-		log.Println("No AI API key provided. Categorization will be skipped.")
+		log.Println("No AI API key provided.")
 	}
 
-	par := parser.NewOfferParser()
-	offerService := service.NewOfferService(icaRepo, par, categorizer)
+	// Only products that are not in the category cache are sent to the categorizer
+	if categorizer != nil && appConfig.Categorization.Cache {
+		categoryCache := repository.NewPostgresCategoryCacheRepository(db)
+		categorizer = service.NewCachedCategorizer(categorizer, categoryCache, appConfig.Categorization.CacheTTL)
+		log.Printf("Category cache enabled (TTL %s).", appConfig.Categorization.CacheTTL)
+	}
+	if categorizer != nil {
+		categorizer = withTaxonomy(categorizer)
+	}
 
-	// Initialize the errgroup.Group
-	g, gCtx := errgroup.WithContext(ctx)
+	// The rule-based categorizer works offline: it replaces the AI when there is none,
+	// and fills in for it when the AI call fails or leaves products uncategorized.
+	if appConfig.Categorization.RulesFile != "" {
+		rules, err := service.LoadRuleCategorizer(appConfig.Categorization.RulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load category rules: %v", err)
+		}
+		if categorizer != nil {
+			categorizer = service.NewFallbackCategorizer(categorizer, withTaxonomy(rules))
+			log.Println("Rule-based categorizer enabled as fallback.")
+		} else {
+			categorizer = withTaxonomy(rules)
+			log.Println("Using the rule-based categorizer.")
+		}
+	}
+	if categorizer == nil {
+		log.Println("No categorizer configured. Categorization will be skipped.")
+	}
 
-	// 5. Execution Loop: Scrape and Save in parallel
-	for _, store := range targetStores {
-		g.Go(func() error {
-			log.Printf("Starting scrape for: %s", store.Name)
+	validator, err := service.NewOfferValidator(appConfig.Validation.Rules, appConfig.Validation.MaxDiscountPercentage)
+	if err != nil {
+		log.Fatalf("Invalid validation configuration: %v", err)
+	}
 
-			// Use the context from the errgroup for scrape calls
-			offers, err := offerService.GetStoreOffers(ctx, store)
-			if err != nil {
-				return fmt.Errorf("error scraping %s: %w", store.Name, err)
-			}
+	// Build the processing pipeline. Extra stages can be registered here, e.g.
+	// pipeline.InsertAfter(service.StageNormalize, myEnrichmentStage)
+	pipeline := service.NewDefaultPipeline(service.PipelineDependencies{
+		Repo:                icaRepo,
+		Parser:              parser.NewOfferParser(),
+		Validator:           validator,
+		Quarantine:          quarantineRepo,
+		Products:            productRepo,
+		Attributes:          attributeExtractor,
+		Categorizer:         categorizer,
+		CategoryOverrides:   overrideRepo,
+		MinCategoryCoverage: appConfig.Categorization.MinCoverage,
+	})
+	log.Printf("Offer pipeline stages: %v", pipeline.StageNames())
+	offerService := service.NewOfferService(pipeline)
+	changeTracker := service.NewChangeTracker(offerRepo, changeRepo)
 
-			log.Printf("Successfully processed %d offers from %s. Starting insertion...", len(offers), store.Name)
-			//Use the context from the errgroup for insertion calls
-			insertedOrUpdatedCount, err := offerRepo.InsertOffers(gCtx, offers)
-			if err != nil {
-				return fmt.Errorf("error inserting offers for %s: %w", store.Name, err)
-			}
+	// 5. Record the run; the offers and observations it saves carry its ID
+	run, err := service.StartRun(ctx, runRepo, appConfig.Hash(), buildVersion())
+	if err != nil {
+		log.Fatalf("Failed to record the scrape run: %v", err)
+	}
+	runID := run.ID()
+	log.Printf("Started scrape run %d.", runID)
+
+	// 6. Scrape all stores in parallel. Categorization runs once the last store is
+	// done, so a product on sale in several stores is only categorized once.
+	batches, runErr := offerService.ProcessStores(ctx, targetStores)
+	if runErr != nil {
+		log.Printf("Error: the scrape run failed, no offers will be saved: %v", runErr)
+	}
 
-			log.Printf("Successfully inserted/updated %d offers from %s", insertedOrUpdatedCount, store.Name)
+	// 7. Save the offers of every store in parallel. A failing store does not stop the
+	// others; every store's outcome is recorded with the run.
+	var g errgroup.Group
+	for _, batch := range batches {
+		g.Go(func() error {
+			store := batch.Store
+			start := time.Now()
+			var written repository.InsertResult
+			err := batch.Err
+			switch {
+			case err != nil:
+				log.Printf("Error scraping %s: %v", store.Name, err)
+			case runErr != nil:
+				err = runErr
+			default:
+				written, err = saveOffers(ctx, offerRepo, changeTracker, batch, runID)
+				if err != nil {
+					log.Printf("Error saving offers for %s: %v", store.Name, err)
+				}
+			}
+			if recordErr := run.RecordStore(ctx, batch, written, time.Since(start), err); recordErr != nil {
+				log.Printf("Warning: could not record the scrape result of %s: %v", store.Name, recordErr)
+			}
 			return nil
 		})
 	}
+	g.Wait()
 
-	// 6. Wait for all goroutines to complete.
-	if err := g.Wait(); err != nil {
-		log.Fatalf("One or more scraping/insertion tasks failed: %v", err)
+	if err := run.Finish(ctx, runErr); err != nil {
+		log.Printf("Warning: could not record the end of scrape run %d: %v", runID, err)
 	}
 
-	// 7. Final Output
+	// 8. Final Output
 	totalCount, err := offerRepo.CountOffers(ctx)
 	if err != nil {
 		log.Printf("Warning: Could not get final offer count from DB: %v", err)
 	}
 
 	fmt.Printf("\n--- SCRAPE AND PERSISTENCE COMPLETE (via GORM) ---\n")
-	fmt.Printf("Successfully scraped and saved/updated a total of %d offers to PostgreSQL.\n", totalCount)
+	fmt.Printf("Scrape run %d %s. The database holds a total of %d offers.\n", runID, run.Status(), totalCount)
+	if run.Status() != models.ScrapeRunSucceeded {
+		os.Exit(1)
+	}
+}
+
+// saveOffers diffs a store's offers against the previous run, saves them with the
+// run ID and records the changes. A complete scrape replaces the store's offers and
+// withdraws the ones no longer on its page; an incomplete one only adds and updates.
+func saveOffers(ctx context.Context, offerRepo repository.OfferRepository, changeTracker *service.ChangeTracker, batch *service.OfferBatch, runID uint) (repository.InsertResult, error) {
+	store := batch.Store
+	offers := batch.Offers()
+	for i := range offers {
+		offers[i].RunID = &runID
+	}
+
+	// Compare with the previous run before the insert overwrites it
+	previous, err := changeTracker.Previous(ctx, store)
+	if err != nil {
+		return repository.InsertResult{}, fmt.Errorf("error diffing offers for %s: %w", store.Name, err)
+	}
+	changes := changeTracker.Diff(previous, offers)
+	incomplete := batch.Incomplete(len(previous))
+	if incomplete != "" {
+		// Offers missing from an incomplete page are still advertised, so they have not ended
+		changes = slices.DeleteFunc(changes, func(c models.OfferChange) bool { return c.Kind == models.OfferChangeEnded })
+	}
+
+	log.Printf("Successfully processed %d offers from %s. Starting insertion...", len(offers), store.Name)
+	var written repository.InsertResult
+	if incomplete != "" {
+		log.Printf("Warning: the scrape of %s looks incomplete (%s); no offers will be withdrawn", store.Name, incomplete)
+		written, err = offerRepo.InsertOffers(ctx, offers)
+	} else {
+		written, err = offerRepo.ReplaceStoreOffers(ctx, store.ID, offers, batch.PromotionIDs(), batch.Periods())
+	}
+	if err != nil {
+		return written, fmt.Errorf("error inserting offers for %s: %w", store.Name, err)
+	}
+	log.Printf("Successfully inserted %d, updated %d and withdrew %d offers from %s", written.Inserted, written.Updated, written.Withdrawn, store.Name)
+
+	if err := changeTracker.Record(ctx, changes); err != nil {
+		return written, fmt.Errorf("error recording offer changes for %s: %w", store.Name, err)
+	}
+	log.Printf("Recorded %d offer changes for %s", len(changes), store.Name)
+	return written, nil
+}
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3". Without it
+// the VCS revision from the build info is used.
+var version string
+
+// buildVersion returns the version recorded with every scrape run.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if revision != "" {
+		return revision + modified
+	}
+	return info.Main.Version
 }
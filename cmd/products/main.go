@@ -0,0 +1,149 @@
+// Command products inspects canonical products and manages manual merge/split overrides.
+//
+// Usage:
+//
+//	products find <text>
+//	products keys <id>
+//	products offers <id>
+//	products history [-since YYYY-MM-DD] <id>
+//	products merge [-reason ..] <from-id> <into-id>
+//	products split [-reason ..] <key>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/repository"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: products <find|keys|offers|history|merge|split> [flags] args")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	appConfig := config.Init()
+	db, err := database.Open(appConfig.DBConn, &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := migrations.Prepare(ctx, db, appConfig.Database.AutoMigrate); err != nil {
+		log.Fatalf("Database schema is not ready: %v", err)
+	}
+	productRepo := repository.NewPostgresProductRepository(db)
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	reason := fs.String("reason", "", "why the override was made")
+	since := fs.String("since", "", "only history from this date (YYYY-MM-DD)")
+	fs.Parse(args)
+	args = fs.Args()
+
+	switch cmd {
+	case "find":
+		if len(args) != 1 {
+			usage()
+		}
+		products, err := productRepo.FindProducts(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tBRAND\tSIZE\tEAN")
+		for _, p := range products {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%g %s\t%s\n", p.ID, p.CanonicalName, p.Brand, p.Size, p.Unit, p.EAN)
+		}
+		w.Flush()
+	case "keys":
+		if len(args) != 1 {
+			usage()
+		}
+		keys, err := productRepo.ListProductKeys(ctx, parseID(args[0]))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+	case "offers":
+		if len(args) != 1 {
+			usage()
+		}
+		offers, err := productRepo.CheapestOffers(ctx, parseID(args[0]), time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STORE\tNAME\tTYPE\tSALE PRICE\tMULTIBUY\tDISCOUNT %")
+		for _, o := range offers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%d for %.2f\t%.2f\n", o.StoreName, o.Name, o.Type, o.SalePrice, o.SaleQuantity, o.SalePriceTotal, o.DiscountPercentage)
+		}
+		w.Flush()
+	case "history":
+		if len(args) != 1 {
+			usage()
+		}
+		var from time.Time
+		if *since != "" {
+			if from, err = time.ParseInLocation(time.DateOnly, *since, time.Local); err != nil {
+				log.Fatalf("Invalid -since date: %v", err)
+			}
+		}
+		offerRepo := repository.NewOfferRepository(db)
+		history, err := offerRepo.GetProductHistory(ctx, parseID(args[0]), from)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OBSERVED\tSTORE\tNAME\tTYPE\tORIGINAL\tSALE PRICE\tMULTIBUY\tDISCOUNT %")
+		for _, o := range history {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f\t%.2f\t%d for %.2f\t%.2f\n", o.ObservedAt.Format("2006-01-02 15:04"), o.StoreName, o.Name, o.Type, o.OriginalPrice, o.SalePrice, o.SaleQuantity, o.SalePriceTotal, o.DiscountPercentage)
+		}
+		w.Flush()
+	case "merge":
+		if len(args) != 2 {
+			usage()
+		}
+		from, into := parseID(args[0]), parseID(args[1])
+		if err := productRepo.MergeProducts(ctx, from, into, *reason); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Merged product %d into %d.\n", from, into)
+	case "split":
+		if len(args) != 1 {
+			usage()
+		}
+		product, err := productRepo.SplitProductKey(ctx, args[0], *reason)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Key %q now belongs to new product %d.\n", args[0], product.ID)
+	default:
+		usage()
+	}
+}
+
+func parseID(arg string) uint {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		log.Fatalf("invalid id %q: %v", arg, err)
+	}
+	return uint(id)
+}
@@ -0,0 +1,190 @@
+// Command quarantine reviews, fixes and releases offers that failed validation.
+//
+// Usage:
+//
+//	quarantine list [-status pending|released|discarded|all]
+//	quarantine show <id>
+//	quarantine fix [-name ..] [-type ..] [-original-price ..] [-sale-price ..]
+//	               [-sale-quantity ..] [-sale-price-total ..] [-discount ..] <id>
+//	quarantine release [-force] <id>
+//	quarantine discard <id>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"grocery_scraper/internal/service"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: quarantine <list|show|fix|release|discard> [flags] [id]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	appConfig := config.Init()
+	db, err := database.Open(appConfig.DBConn, &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := migrations.Prepare(ctx, db, appConfig.Database.AutoMigrate); err != nil {
+		log.Fatalf("Database schema is not ready: %v", err)
+	}
+	quarantineRepo := repository.NewPostgresQuarantineRepository(db)
+	validator, err := service.NewOfferValidator(appConfig.Validation.Rules, appConfig.Validation.MaxDiscountPercentage)
+	if err != nil {
+		log.Fatalf("Invalid validation configuration: %v", err)
+	}
+	svc := service.NewQuarantineService(quarantineRepo, repository.NewOfferRepository(db), validator)
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		status := fs.String("status", models.QuarantineStatusPending, "filter by status, or 'all'")
+		fs.Parse(args)
+		if *status == "all" {
+			*status = ""
+		}
+		offers, err := svc.List(ctx, *status)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printList(offers)
+	case "show":
+		q, err := svc.Get(ctx, parseID(args))
+		if err != nil {
+			log.Fatal(err)
+		}
+		printDetails(q)
+	case "fix":
+		runFix(ctx, svc, args)
+	case "release":
+		fs := flag.NewFlagSet("release", flag.ExitOnError)
+		force := fs.Bool("force", false, "release even if the offer still fails validation")
+		fs.Parse(args)
+		q, err := svc.Release(ctx, parseID(fs.Args()), *force)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Released offer %d (%s) into offers.\n", q.ID, q.Name)
+	case "discard":
+		q, err := svc.Discard(ctx, parseID(args))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Discarded offer %d (%s).\n", q.ID, q.Name)
+	default:
+		usage()
+	}
+}
+
+// runFix applies only the flags that were explicitly given on the command line.
+func runFix(ctx context.Context, svc *service.QuarantineService, args []string) {
+	fs := flag.NewFlagSet("fix", flag.ExitOnError)
+	name := fs.String("name", "", "product name")
+	offerType := fs.String("type", "", "offer type (single, multibuy, percentage)")
+	originalPrice := fs.Float64("original-price", 0, "original price")
+	salePrice := fs.Float64("sale-price", 0, "sale price")
+	saleQuantity := fs.Int("sale-quantity", 0, "quantity for multibuy offers")
+	salePriceTotal := fs.Float64("sale-price-total", 0, "total price for multibuy offers")
+	discount := fs.Int("discount", 0, "discount for percentage offers")
+	fs.Parse(args)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if len(set) == 0 {
+		log.Fatal("fix: no fields given")
+	}
+
+	q, failure, err := svc.Fix(ctx, parseID(fs.Args()), func(q *models.QuarantinedOffer) {
+		if set["name"] {
+			q.Name = *name
+		}
+		if set["type"] {
+			q.Type = *offerType
+		}
+		if set["original-price"] {
+			q.OriginalPrice = *originalPrice
+		}
+		if set["sale-price"] {
+			q.SalePrice = *salePrice
+		}
+		if set["sale-quantity"] {
+			q.SaleQuantity = *saleQuantity
+		}
+		if set["sale-price-total"] {
+			q.SalePriceTotal = *salePriceTotal
+		}
+		if set["discount"] {
+			q.Discount = *discount
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printDetails(q)
+	if failure != nil {
+		fmt.Printf("\nStill failing validation: %v\n", failure)
+	} else {
+		fmt.Printf("\nOffer passes validation. Run 'quarantine release %d' to publish it.\n", q.ID)
+	}
+}
+
+func parseID(args []string) uint {
+	if len(args) != 1 {
+		usage()
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		log.Fatalf("invalid id %q: %v", args[0], err)
+	}
+	return uint(id)
+}
+
+func printList(offers []models.QuarantinedOffer) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSTORE\tNAME\tRULE")
+	for _, q := range offers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", q.ID, q.Status, q.StoreName, q.Name, q.Rule)
+	}
+	w.Flush()
+}
+
+func printDetails(q *models.QuarantinedOffer) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", q.ID)
+	fmt.Fprintf(w, "Status:\t%s\n", q.Status)
+	fmt.Fprintf(w, "Store:\t%s\n", q.StoreName)
+	fmt.Fprintf(w, "Name:\t%s\n", q.Name)
+	fmt.Fprintf(w, "URL:\t%s\n", q.ProductURL)
+	fmt.Fprintf(w, "Type:\t%s\n", q.Type)
+	fmt.Fprintf(w, "Original price:\t%.2f\n", q.OriginalPrice)
+	fmt.Fprintf(w, "Sale price:\t%.2f\n", q.SalePrice)
+	fmt.Fprintf(w, "Multibuy:\t%d for %.2f\n", q.SaleQuantity, q.SalePriceTotal)
+	fmt.Fprintf(w, "Discount:\t%d (%.2f%%)\n", q.Discount, q.DiscountPercentage)
+	fmt.Fprintf(w, "Rule:\t%s\n", q.Rule)
+	fmt.Fprintf(w, "Reason:\t%s\n", q.Reason)
+	fmt.Fprintf(w, "Raw card text:\t%q\n", q.RawOriginalText)
+	fmt.Fprintf(w, "Raw deal text:\t%q\n", q.RawDealText)
+	w.Flush()
+}
@@ -0,0 +1,128 @@
+// Command stores discovers stores and adds them to the scrape list in config.yaml.
+//
+// Usage:
+//
+//	stores search <name, city or postal code>
+//	stores list
+//	stores add <external-id> [external-id ...]
+package main
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/config"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"grocery_scraper/internal/service"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: stores <search|list|add> args")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	appConfig := config.Init()
+	db, err := database.Open(appConfig.DBConn, &gorm.Config{})
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := migrations.Prepare(ctx, db, appConfig.Database.AutoMigrate); err != nil {
+		log.Fatalf("Database schema is not ready: %v", err)
+	}
+	storeRepo := repository.NewPostgresStoreRepository(db)
+	catalog := service.NewStoreCatalogService(newLookup(appConfig.StoreLookup), storeRepo)
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "search":
+		if len(args) == 0 {
+			usage()
+		}
+		stores, err := catalog.Search(ctx, strings.Join(args, " "))
+		if err != nil {
+			log.Fatal(err)
+		}
+		printStores(stores)
+	case "list":
+		stores, err := storeRepo.ListStoreSummaries(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printSummaries(stores)
+	case "add":
+		if len(args) == 0 {
+			usage()
+		}
+		var targets []models.Store
+		for _, id := range args {
+			store, err := catalog.Find(ctx, models.ChainICA, id)
+			if err != nil {
+				log.Fatal(err)
+			}
+			targets = append(targets, store.ScrapeTarget())
+		}
+		added, err := config.AddStores(targets)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Added %d of %d stores to the scrape list.\n", added, len(targets))
+	default:
+		usage()
+	}
+}
+
+func newLookup(conf config.StoreLookupConfig) repository.StoreLookup {
+	switch conf.Source {
+	case "http":
+		if conf.Endpoint == "" {
+			log.Fatal("store_lookup.endpoint is required for the http source")
+		}
+		return repository.NewHTTPStoreLookup(conf.Endpoint)
+	case "json", "":
+		if conf.Path == "" {
+			log.Fatal("store_lookup.path is required for the json source")
+		}
+		return repository.NewJSONStoreLookup(conf.Path)
+	default:
+		log.Fatalf("unknown store_lookup.source %q", conf.Source)
+		return nil
+	}
+}
+
+func printStores(stores []models.StoreInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPROFILE\tADDRESS\tCITY\tSLUG")
+	for _, s := range stores {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s %s\t%s\n", s.ExternalID, s.Name, s.Profile, s.Address, s.PostalCode, s.City, s.URLSlug)
+	}
+	w.Flush()
+}
+
+func printSummaries(stores []models.StoreSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCITY\tOFFERS\tCURRENT\tLAST SCRAPED")
+	for _, s := range stores {
+		lastScraped := "never"
+		if s.LastScrapedAt != nil {
+			lastScraped = s.LastScrapedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", s.ExternalID, s.Name, s.City, s.Offers, s.CurrentOffers, lastScraped)
+	}
+	w.Flush()
+}
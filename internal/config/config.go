@@ -1,10 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"grocery_scraper/internal/models"
 	"log"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 
@@ -13,24 +17,107 @@ import (
 
 // Config holds the application configuration parameters.
 type Config struct {
-	DBConn   string
-	Stores   []models.Store
-	AIAPIKey string
+	DBConn         string
+	Stores         []models.Store
+	AIAPIKey       string
+	AdminToken     string
+	Validation     ValidationConfig
+	StoreLookup    StoreLookupConfig
+	Categorization CategorizationConfig
+	LLM            LLMConfig
+	Database       DatabaseConfig
+}
+
+// DatabaseConfig controls how the schema is handled at startup.
+type DatabaseConfig struct {
+	// AutoMigrate applies pending migrations at startup; without it the commands
+	// refuse to start unless the schema is at the version they were built for
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+}
+
+// LLMConfig selects the language model used for AI categorization.
+type LLMConfig struct {
+	// Provider is "gemini" or "openai" (any OpenAI-compatible endpoint, e.g. Ollama or llama.cpp)
+	Provider string `mapstructure:"provider"`
+	// Model defaults to gemini-2.5-flash-lite for Gemini and must be set for openai
+	Model string `mapstructure:"model"`
+	// Endpoint is the base URL of an OpenAI-compatible API, up to /chat/completions
+	Endpoint    string  `mapstructure:"endpoint"`
+	Temperature float32 `mapstructure:"temperature"`
+	// BatchSize is the number of products sent per request
+	BatchSize int `mapstructure:"batch_size"`
+	// Concurrency is how many batches are sent at the same time
+	Concurrency int `mapstructure:"concurrency"`
+	// RequestsPerMinute and TokensPerMinute limit the whole run across all stores; 0 disables a limit
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int `mapstructure:"tokens_per_minute"`
+	// MaxRetries is how often a request rejected with 429 is retried
+	MaxRetries int `mapstructure:"max_retries"`
+	// ExtractAttributes also asks the model for brand, quantity, labels, origin and dietary tags.
+	// It is off by default: the answers are not cached, so every offer costs a call on every run.
+	ExtractAttributes bool `mapstructure:"extract_attributes"`
+}
+
+// CategorizationConfig controls how products are categorized.
+type CategorizationConfig struct {
+	// Cache enables the persistent product_categories cache in front of the categorizer
+	Cache bool `mapstructure:"cache"`
+	// CacheTTL is how long a cached category assignment is trusted; 0 keeps it forever
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// RulesFile is the keyword dictionary for the offline rule-based categorizer
+	RulesFile string `mapstructure:"rules_file"`
+	// TaxonomyFile is the category taxonomy every assigned category is validated against
+	TaxonomyFile string `mapstructure:"taxonomy_file"`
+	// TaxonomyMode is "fuzzy" (map near misses to the closest category) or "strict" (reject them)
+	TaxonomyMode string `mapstructure:"taxonomy_mode"`
+	// MinCoverage is the share of a store's products (0-1) that must be categorized for its offers to be saved
+	MinCoverage float64 `mapstructure:"min_coverage"`
+	// OverrideExamples is how many manual overrides are shown to the AI as examples; 0 shows none
+	OverrideExamples int `mapstructure:"override_examples"`
+}
+
+// StoreLookupConfig selects where store discovery searches for stores.
+type StoreLookupConfig struct {
+	// Source is "json" (a local file) or "http" (a JSON search endpoint)
+	Source   string `mapstructure:"source"`
+	Path     string `mapstructure:"path"`
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+// ValidationConfig selects the offer validation rules and their thresholds.
+type ValidationConfig struct {
+	Rules                 []string `mapstructure:"rules"`
+	MaxDiscountPercentage float64  `mapstructure:"max_discount_percentage"`
 }
 
 // Global constants for configuration keys
 const (
-	DBHostKey     = "DB_HOST"
-	DBPortKey     = "DB_PORT"
-	DBUserKey     = "DB_USER"
-	DBPasswordKey = "DB_PASSWORD"
-	DBNameKey     = "DB_NAME"
-	StoresKey     = "stores" // Key for the list of stores in config.yaml
-	AIAPIKey      = "AI_API_KEY"
+	DBHostKey         = "DB_HOST"
+	DBPortKey         = "DB_PORT"
+	DBUserKey         = "DB_USER"
+	DBPasswordKey     = "DB_PASSWORD"
+	DBNameKey         = "DB_NAME"
+	DBURLKey          = "DB_URL" // A full DSN; takes precedence over the DB_* parts
+	StoresKey         = "stores" // Key for the list of stores in config.yaml
+	AIAPIKey          = "AI_API_KEY"
+	AdminTokenKey     = "ADMIN_TOKEN"    // Bearer token for the API's write endpoints; unset disables them
+	ValidationKey     = "validation"     // Key for the validation rules in config.yaml
+	StoreLookupKey    = "store_lookup"   // Key for the store discovery source in config.yaml
+	CategorizationKey = "categorization" // Key for the categorization settings in config.yaml
+	LLMKey            = "llm"            // Key for the language model settings in config.yaml
+	DatabaseKey       = "database"       // Key for the schema settings in config.yaml
 )
 
 // Init initializes Viper, sets defaults, and constructs the DSN.
 func Init() *Config {
+	config := Load()
+	config.DBConn = buildDSN()
+	return config
+}
+
+// Load initializes Viper and sets defaults like Init, but leaves out the database
+// connection, for tools that do not use the database.
+func Load() *Config {
 	// --- File-based configuration ---
 	viper.SetConfigName("config") // name of config file (e.g., config.yaml)
 	viper.SetConfigType("yaml")
@@ -45,31 +132,94 @@ func Init() *Config {
 		}
 	}
 
+	viper.SetDefault(CategorizationKey+".cache", true)
+	viper.SetDefault(CategorizationKey+".cache_ttl", "720h")
+	viper.SetDefault(CategorizationKey+".taxonomy_mode", "fuzzy")
+	viper.SetDefault(CategorizationKey+".override_examples", 20)
+	viper.SetDefault(LLMKey+".provider", "gemini")
+	viper.SetDefault(LLMKey+".batch_size", 50)
+	viper.SetDefault(LLMKey+".concurrency", 4)
+	viper.SetDefault(LLMKey+".max_retries", 3)
+	viper.SetDefault(DatabaseKey+".auto_migrate", true)
+
 	// Set up Viper to read environment variables
 	viper.SetEnvPrefix("APP")
 	viper.AutomaticEnv()
 
-	// Construct the DSN from individual components
-	dsn := buildDSN()
 	// Unmarshal the stores configuration
 	var stores []models.Store
 	if err := viper.UnmarshalKey(StoresKey, &stores); err != nil {
 		log.Fatalf("Fatal Error: could not unmarshal stores configuration: %v", err)
 	}
+	// Unmarshal the validation rules; an empty rule list falls back to the service defaults
+	var validation ValidationConfig
+	if err := viper.UnmarshalKey(ValidationKey, &validation); err != nil {
+		log.Fatalf("Fatal Error: could not unmarshal validation configuration: %v", err)
+	}
+	var storeLookup StoreLookupConfig
+	if err := viper.UnmarshalKey(StoreLookupKey, &storeLookup); err != nil {
+		log.Fatalf("Fatal Error: could not unmarshal store lookup configuration: %v", err)
+	}
+	// Read categorization settings one by one so defaults apply to keys missing from the file
+	categorization := CategorizationConfig{
+		Cache:            viper.GetBool(CategorizationKey + ".cache"),
+		CacheTTL:         viper.GetDuration(CategorizationKey + ".cache_ttl"),
+		RulesFile:        viper.GetString(CategorizationKey + ".rules_file"),
+		TaxonomyFile:     viper.GetString(CategorizationKey + ".taxonomy_file"),
+		TaxonomyMode:     viper.GetString(CategorizationKey + ".taxonomy_mode"),
+		MinCoverage:      viper.GetFloat64(CategorizationKey + ".min_coverage"),
+		OverrideExamples: viper.GetInt(CategorizationKey + ".override_examples"),
+	}
+	llmConfig := LLMConfig{
+		Provider:          viper.GetString(LLMKey + ".provider"),
+		Model:             viper.GetString(LLMKey + ".model"),
+		Endpoint:          viper.GetString(LLMKey + ".endpoint"),
+		Temperature:       float32(viper.GetFloat64(LLMKey + ".temperature")),
+		BatchSize:         viper.GetInt(LLMKey + ".batch_size"),
+		Concurrency:       viper.GetInt(LLMKey + ".concurrency"),
+		RequestsPerMinute: viper.GetInt(LLMKey + ".requests_per_minute"),
+		TokensPerMinute:   viper.GetInt(LLMKey + ".tokens_per_minute"),
+		MaxRetries:        viper.GetInt(LLMKey + ".max_retries"),
+		ExtractAttributes: viper.GetBool(LLMKey + ".extract_attributes"),
+	}
 	viper.OnConfigChange(func(e fsnotify.Event) {
 	})
 
 	viper.WatchConfig()
 
 	return &Config{
-		DBConn:   dsn,
-		Stores:   stores,
-		AIAPIKey: viper.GetString(AIAPIKey),
+		Stores:         stores,
+		AIAPIKey:       viper.GetString(AIAPIKey),
+		AdminToken:     viper.GetString(AdminTokenKey),
+		Validation:     validation,
+		StoreLookup:    storeLookup,
+		Categorization: categorization,
+		LLM:            llmConfig,
+		Database: DatabaseConfig{
+			AutoMigrate: viper.GetBool(DatabaseKey + ".auto_migrate"),
+		},
 	}
 }
 
-// buildDSN constructs the PostgreSQL DSN from individual config values read by Viper.
+// Hash returns a SHA-256 of the settings, without the database connection and the
+// secrets, so runs with the same configuration can be recognized.
+func (c *Config) Hash() string {
+	settings := *c
+	settings.DBConn, settings.AIAPIKey, settings.AdminToken = "", "", ""
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildDSN returns DB_URL when it is set, e.g. "sqlite://offers.db" or a Postgres URL,
+// and otherwise constructs the PostgreSQL DSN from individual config values read by Viper.
 func buildDSN() string {
+	if url := viper.GetString(DBURLKey); url != "" {
+		return url
+	}
 	host := viper.GetString(DBHostKey)
 	port := viper.GetString(DBPortKey)
 	user := viper.GetString(DBUserKey)
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"os"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// AddStores appends stores to the scrape list in config.yaml, skipping the ones whose
+// url_slug is already listed. The file is edited in place, so comments and all other
+// settings are kept as they are. It returns the number of stores added.
+func AddStores(stores []models.Store) (int, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = "config.yaml"
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return 0, fmt.Errorf("could not parse %s: %w", path, err)
+		}
+	} else {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("%s: top level is not a mapping", path)
+	}
+	list := storesNode(root)
+
+	existing := make(map[string]bool)
+	for _, entry := range list.Content {
+		for i := 0; i+1 < len(entry.Content); i += 2 {
+			if entry.Content[i].Value == "url_slug" {
+				existing[entry.Content[i+1].Value] = true
+			}
+		}
+	}
+
+	added := 0
+	for _, store := range stores {
+		if existing[store.URLSlug] {
+			continue
+		}
+		existing[store.URLSlug] = true
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "name"},
+			{Kind: yaml.ScalarNode, Value: store.Name, Style: yaml.DoubleQuotedStyle},
+			{Kind: yaml.ScalarNode, Value: "url_slug"},
+			{Kind: yaml.ScalarNode, Value: store.URLSlug, Style: yaml.DoubleQuotedStyle},
+		}})
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return 0, fmt.Errorf("could not encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return added, nil
+}
+
+// storesNode returns the sequence under the stores key, creating it if needed.
+func storesNode(root *yaml.Node) *yaml.Node {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == StoresKey {
+			list := root.Content[i+1]
+			if list.Kind != yaml.SequenceNode {
+				*list = yaml.Node{Kind: yaml.SequenceNode}
+			}
+			return list
+		}
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: StoresKey}, list)
+	return list
+}
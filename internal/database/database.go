@@ -0,0 +1,60 @@
+// Package database opens the storage backend selected by the DSN.
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Names of the supported backends, as returned by Dialect.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// sqlitePragmas make concurrent use of a SQLite file wait for locks instead of
+// failing, and enforce foreign keys like Postgres does.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"}
+
+// Open connects to the database of the DSN. "sqlite://offers.db" (or "sqlite:offers.db")
+// opens or creates a SQLite file; anything else is a Postgres URL or key=value DSN.
+func Open(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	path, ok := strings.CutPrefix(dsn, "sqlite:")
+	if !ok {
+		db, err := gorm.Open(postgres.Open(dsn), config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+		}
+		return db, nil
+	}
+
+	path = strings.TrimPrefix(path, "//")
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	for _, pragma := range sqlitePragmas {
+		path += separator + "_pragma=" + pragma
+		separator = "&"
+	}
+	db, err := gorm.Open(sqlite.Open(path), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", dsn, err)
+	}
+	// SQLite has a single writer; one connection avoids "database is locked" errors
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Dialect returns the backend of an open database: Postgres or SQLite.
+func Dialect(db *gorm.DB) string {
+	return db.Dialector.Name()
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GeminiClient implements Client using Google Generative AI.
+type GeminiClient struct {
+	client      *genai.Client
+	model       string
+	temperature float32
+}
+
+// NewGeminiClient creates a new GeminiClient.
+func NewGeminiClient(ctx context.Context, apiKey, model string, temperature float32) (*GeminiClient, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key is required for the Gemini provider")
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genai client: %w", err)
+	}
+
+	return &GeminiClient{
+		client:      client,
+		model:       model,
+		temperature: temperature,
+	}, nil
+}
+
+// Close closes the underlying client.
+func (c *GeminiClient) Close() error {
+	return c.client.Close()
+}
+
+// Generate implements Client.
+func (c *GeminiClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	model := c.client.GenerativeModel(c.model)
+	model.SetTemperature(c.temperature)
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+	if req.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiSchema(req.Schema)
+	}
+
+	resp, err := model.GenerateContent(ctx, genai.Text(req.Prompt))
+	if err != nil {
+		if quotaErr := geminiQuotaError(err); quotaErr != nil {
+			return nil, quotaErr
+		}
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no content generated")
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			text.WriteString(string(txt))
+		}
+	}
+
+	out := &Response{Text: text.String()}
+	if resp.UsageMetadata != nil {
+		out.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+		out.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+	return out, nil
+}
+
+// geminiQuotaError turns the gRPC RESOURCE_EXHAUSTED status, Gemini's equivalent of
+// HTTP 429, into a StatusError carrying the retry delay the service asked for.
+func geminiQuotaError(err error) *StatusError {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return nil
+	}
+	quotaErr := &StatusError{StatusCode: http.StatusTooManyRequests, Message: st.Message()}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			quotaErr.RetryAfter = info.GetRetryDelay().AsDuration()
+		}
+	}
+	return quotaErr
+}
+
+// geminiSchema converts a Schema to the SDK's schema type.
+func geminiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	out := &genai.Schema{
+		Description: s.Description,
+		Enum:        s.Enum,
+		Items:       geminiSchema(s.Items),
+		Required:    s.Required,
+		Nullable:    s.Nullable,
+	}
+	switch s.Type {
+	case "object":
+		out.Type = genai.TypeObject
+	case "array":
+		out.Type = genai.TypeArray
+	case "integer":
+		out.Type = genai.TypeInteger
+	case "number":
+		out.Type = genai.TypeNumber
+	case "boolean":
+		out.Type = genai.TypeBoolean
+	default:
+		out.Type = genai.TypeString
+	}
+	if len(s.Enum) > 0 {
+		out.Format = "enum"
+	}
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			out.Properties[name] = geminiSchema(prop)
+		}
+	}
+	return out
+}
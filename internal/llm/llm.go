@@ -0,0 +1,129 @@
+// Package llm is a provider-neutral client for the language models used by the
+// categorizer. Gemini and any OpenAI-compatible chat-completions endpoint (OpenAI,
+// Ollama, llama.cpp, vLLM, ...) are supported.
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// Supported providers.
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	// ProviderStub answers offline from a file of canned responses
+	ProviderStub = "stub"
+)
+
+// Default models and endpoints when the configuration leaves them empty.
+const (
+	DefaultGeminiModel    = "gemini-2.5-flash-lite"
+	DefaultOpenAIEndpoint = "http://localhost:11434/v1" // a local Ollama server
+)
+
+// Client generates a completion for a single prompt.
+type Client interface {
+	Generate(ctx context.Context, req Request) (*Response, error)
+	Close() error
+}
+
+// Request is one prompt sent to the model.
+type Request struct {
+	// System holds instructions that apply to the whole conversation
+	System string
+	Prompt string
+	// Schema is the JSON the response must follow; nil allows free text
+	Schema *Schema
+}
+
+// Response is the text the model generated and what it cost.
+type Response struct {
+	Text         string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Schema is the subset of JSON Schema that all providers understand.
+// Type is one of "object", "array", "string", "integer", "number" or "boolean".
+type Schema struct {
+	Type        string
+	Description string
+	Enum        []string
+	Items       *Schema
+	Properties  map[string]*Schema
+	Required    []string
+	// Nullable allows null as well. Strict structured output requires every property,
+	// so an optional property is a required one that may be null.
+	Nullable bool
+}
+
+// JSONSchema converts the schema to a JSON Schema document. Objects do not allow
+// additional properties, as required by strict structured output.
+func (s *Schema) JSONSchema() map[string]any {
+	if s == nil {
+		return nil
+	}
+	out := map[string]any{"type": s.Type}
+	if s.Nullable {
+		out["type"] = []string{s.Type, "null"}
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		enum := make([]any, 0, len(s.Enum)+1)
+		for _, value := range s.Enum {
+			enum = append(enum, value)
+		}
+		if s.Nullable {
+			enum = append(enum, nil)
+		}
+		out["enum"] = enum
+	}
+	if s.Items != nil {
+		out["items"] = s.Items.JSONSchema()
+	}
+	if s.Type == "object" {
+		props := make(map[string]any, len(s.Properties))
+		for name, prop := range s.Properties {
+			props[name] = prop.JSONSchema()
+		}
+		out["properties"] = props
+		out["required"] = s.Required
+		out["additionalProperties"] = false
+	}
+	return out
+}
+
+// Options selects and configures the provider.
+type Options struct {
+	Provider string
+	Model    string
+	// Endpoint is the API URL for ProviderOpenAI and the response file for ProviderStub
+	Endpoint    string
+	APIKey      string
+	Temperature float32
+}
+
+// New creates a client for the configured provider.
+func New(ctx context.Context, opts Options) (Client, error) {
+	switch opts.Provider {
+	case ProviderGemini, "":
+		model := opts.Model
+		if model == "" {
+			model = DefaultGeminiModel
+		}
+		return NewGeminiClient(ctx, opts.APIKey, model, opts.Temperature)
+	case ProviderOpenAI:
+		endpoint := opts.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultOpenAIEndpoint
+		}
+		return NewOpenAIClient(endpoint, opts.APIKey, opts.Model, opts.Temperature)
+	case ProviderStub:
+		return LoadStubClient(opts.Endpoint)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", opts.Provider)
+	}
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIClient implements Client for any OpenAI-compatible chat-completions API,
+// e.g. OpenAI itself, Ollama (http://localhost:11434/v1) or a llama.cpp server.
+type OpenAIClient struct {
+	endpoint    string
+	apiKey      string
+	model       string
+	temperature float32
+	httpClient  *http.Client
+}
+
+// NewOpenAIClient creates a client for the API at endpoint (the URL up to /chat/completions).
+// The API key may be empty for local servers.
+func NewOpenAIClient(endpoint, apiKey, model string, temperature float32) (*OpenAIClient, error) {
+	if model == "" {
+		return nil, fmt.Errorf("a model is required for the OpenAI-compatible provider")
+	}
+	return &OpenAIClient{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		apiKey:      apiKey,
+		model:       model,
+		temperature: temperature,
+		httpClient:  &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Close implements Client.
+func (c *OpenAIClient) Close() error {
+	return nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string         `json:"model"`
+	Messages       []chatMessage  `json:"messages"`
+	Temperature    float32        `json:"temperature"`
+	ResponseFormat map[string]any `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Generate implements Client.
+func (c *OpenAIClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	body := chatRequest{
+		Model:       c.model,
+		Temperature: c.temperature,
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, chatMessage{Role: "system", Content: req.System})
+	}
+	body.Messages = append(body.Messages, chatMessage{Role: "user", Content: req.Prompt})
+	if req.Schema != nil {
+		body.ResponseFormat = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   "response",
+				"strict": true,
+				"schema": req.Schema.JSONSchema(),
+			},
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("chat request to %s failed: %w", c.endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	var decoded chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode chat response: %w", err)
+	}
+	if len(decoded.Choices) == 0 {
+		return nil, fmt.Errorf("no content generated")
+	}
+	return &Response{
+		Text:         decoded.Choices[0].Message.Content,
+		InputTokens:  decoded.Usage.PromptTokens,
+		OutputTokens: decoded.Usage.CompletionTokens,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIClientGenerate(t *testing.T) {
+	var got struct {
+		path, auth string
+		body       map[string]any
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path, got.auth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got.body); err != nil {
+			t.Errorf("the request body is not JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"products\": []}"}}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 5}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewOpenAIClient(server.URL+"/v1/", "secret", "llama3.1", 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Generate(context.Background(), Request{
+		System: "You categorize groceries.",
+		Prompt: "0: Mellanmjölk 1,5l",
+		Schema: &Schema{Type: "object", Properties: map[string]*Schema{"products": {Type: "array", Items: &Schema{Type: "string"}}}, Required: []string{"products"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *resp != (Response{Text: `{"products": []}`, InputTokens: 12, OutputTokens: 5}) {
+		t.Errorf("got response %+v", resp)
+	}
+
+	if got.path != "/v1/chat/completions" {
+		t.Errorf("posted to %s, want /v1/chat/completions", got.path)
+	}
+	if got.auth != "Bearer secret" {
+		t.Errorf("sent the Authorization header %q, want the bearer token", got.auth)
+	}
+	if got.body["model"] != "llama3.1" {
+		t.Errorf("sent the model %v, want llama3.1", got.body["model"])
+	}
+	if temperature, _ := got.body["temperature"].(float64); float32(temperature) != 0.2 {
+		t.Errorf("sent the temperature %v, want 0.2", got.body["temperature"])
+	}
+	messages, _ := got.body["messages"].([]any)
+	if len(messages) != 2 || messages[0].(map[string]any)["role"] != "system" || messages[1].(map[string]any)["content"] != "0: Mellanmjölk 1,5l" {
+		t.Errorf("sent the messages %v", messages)
+	}
+	format, _ := got.body["response_format"].(map[string]any)
+	jsonSchema, _ := format["json_schema"].(map[string]any)
+	schema, _ := jsonSchema["schema"].(map[string]any)
+	if format["type"] != "json_schema" || jsonSchema["strict"] != true || schema["additionalProperties"] != false {
+		t.Errorf("sent the response format %v", format)
+	}
+}
+
+func TestOpenAIClientWithoutSchemaOrKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["response_format"]; ok {
+			t.Error("a free text request sent a response format")
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("a client without an API key sent the Authorization header %q", auth)
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "hej"}}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewOpenAIClient(server.URL, "", "llama3.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client.Generate(context.Background(), Request{Prompt: "hej"}); err != nil || resp.Text != "hej" {
+		t.Errorf("got %+v, %v", resp, err)
+	}
+}
+
+func TestOpenAIClientStatusError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       time.Duration
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "7", want: 7 * time.Second},
+		{name: "rate limited without Retry-After", status: http.StatusTooManyRequests},
+		{name: "server error", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				http.Error(w, "slow down", tt.status)
+			}))
+			defer server.Close()
+
+			client, err := NewOpenAIClient(server.URL, "secret", "gpt-4o-mini", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.Generate(context.Background(), Request{Prompt: "hej"})
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("got the error %v, want a *StatusError", err)
+			}
+			if statusErr.StatusCode != tt.status || statusErr.RetryAfter != tt.want || statusErr.Message != "slow down" {
+				t.Errorf("got %+v, want status %d and retry after %s", statusErr, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOpenAIClientRequiresModel(t *testing.T) {
+	if _, err := NewOpenAIClient(DefaultOpenAIEndpoint, "", "", 0); err == nil {
+		t.Error("a client without a model was created")
+	}
+}
@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// StatusError is returned when the provider rejects a request with an HTTP status.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is how long the provider asked us to wait; 0 if it did not say
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("provider returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && time.Until(at) > 0 {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// defaultRetryAfter is the first pause after a 429 that did not say how long to wait.
+// It doubles with every further 429 for the same request.
+var defaultRetryAfter = 5 * time.Second
+
+// RateLimitedClient is a Client decorator that keeps all requests within a
+// requests-per-minute and a tokens-per-minute budget. Share one instance between
+// everything that calls the provider in a run, so the budget covers all stores.
+// When the provider answers 429, all requests pause for the time it asked for
+// and the request is retried.
+type RateLimitedClient struct {
+	next       Client
+	requests   *rate.Limiter
+	tokens     *rate.Limiter
+	maxRetries int
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// NewRateLimitedClient wraps next. A limit of 0 disables that limit.
+func NewRateLimitedClient(next Client, requestsPerMinute, tokensPerMinute, maxRetries int) *RateLimitedClient {
+	c := &RateLimitedClient{
+		next:       next,
+		requests:   rate.NewLimiter(rate.Inf, 0),
+		tokens:     rate.NewLimiter(rate.Inf, 0),
+		maxRetries: maxRetries,
+	}
+	if requestsPerMinute > 0 {
+		c.requests = rate.NewLimiter(rate.Limit(float64(requestsPerMinute)/60), 1)
+	}
+	if tokensPerMinute > 0 {
+		c.tokens = rate.NewLimiter(rate.Limit(float64(tokensPerMinute)/60), tokensPerMinute)
+	}
+	return c
+}
+
+// Close implements Client.
+func (c *RateLimitedClient) Close() error {
+	return c.next.Close()
+}
+
+// EstimateTokens roughly estimates the tokens of a request, about four characters
+// per token for the prompt plus the same again for the response.
+func EstimateTokens(req Request) int {
+	return (len(req.System) + len(req.Prompt)) / 4 * 2
+}
+
+// Generate implements Client.
+func (c *RateLimitedClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	tokens := EstimateTokens(req)
+	if burst := c.tokens.Burst(); c.tokens.Limit() != rate.Inf && tokens > burst {
+		tokens = burst
+	}
+
+	backoff := defaultRetryAfter
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForPause(ctx); err != nil {
+			return nil, err
+		}
+		if err := c.requests.Wait(ctx); err != nil {
+			return nil, err
+		}
+		if err := c.tokens.WaitN(ctx, tokens); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.next.Generate(ctx, req)
+		var statusErr *StatusError
+		if err == nil || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || attempt >= c.maxRetries {
+			return resp, err
+		}
+
+		wait := statusErr.RetryAfter
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		log.Printf("LLM provider is rate limiting, pausing all requests for %s (retry %d/%d)", wait, attempt+1, c.maxRetries)
+		c.pause(wait)
+	}
+}
+
+// pause stops all requests for the given time.
+func (c *RateLimitedClient) pause(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until := time.Now().Add(d); until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+func (c *RateLimitedClient) waitForPause(ctx context.Context) error {
+	c.mu.Lock()
+	wait := time.Until(c.pausedUntil)
+	c.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,189 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedClient answers the calls to Generate with the errors of its script in
+// order, and successfully once the script is used up.
+type scriptedClient struct {
+	mu     sync.Mutex
+	script []error
+	calls  []time.Time
+}
+
+func (c *scriptedClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, time.Now())
+	if len(c.calls) <= len(c.script) {
+		if err := c.script[len(c.calls)-1]; err != nil {
+			return nil, err
+		}
+	}
+	return &Response{Text: req.Prompt}, nil
+}
+
+func (c *scriptedClient) Close() error { return nil }
+
+func (c *scriptedClient) callTimes() []time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Time{}, c.calls...)
+}
+
+func tooManyRequests(retryAfter time.Duration) error {
+	return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+func TestRateLimitedClientRetries(t *testing.T) {
+	defer func(d time.Duration) { defaultRetryAfter = d }(defaultRetryAfter)
+	defaultRetryAfter = 10 * time.Millisecond
+
+	failed := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		script     []error
+		maxRetries int
+		wantCalls  int
+		wantStatus int   // of the returned *StatusError
+		wantErr    error // any other error
+		minElapsed time.Duration
+	}{
+		{name: "success", maxRetries: 3, wantCalls: 1},
+		{name: "retried after Retry-After", script: []error{tooManyRequests(30 * time.Millisecond)}, maxRetries: 3,
+			wantCalls: 2, minElapsed: 30 * time.Millisecond},
+		{name: "backoff doubles without Retry-After", script: []error{tooManyRequests(0), tooManyRequests(0)}, maxRetries: 3,
+			wantCalls: 3, minElapsed: 30 * time.Millisecond},
+		{name: "gives up after maxRetries", script: []error{tooManyRequests(time.Millisecond), tooManyRequests(time.Millisecond), tooManyRequests(time.Millisecond)},
+			maxRetries: 2, wantCalls: 3, wantStatus: http.StatusTooManyRequests},
+		{name: "no retries", script: []error{tooManyRequests(time.Millisecond)}, wantCalls: 1, wantStatus: http.StatusTooManyRequests},
+		{name: "other status not retried", script: []error{&StatusError{StatusCode: http.StatusInternalServerError}}, maxRetries: 3,
+			wantCalls: 1, wantStatus: http.StatusInternalServerError},
+		{name: "other error not retried", script: []error{failed}, maxRetries: 3, wantCalls: 1, wantErr: failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &scriptedClient{script: tt.script}
+			client := NewRateLimitedClient(next, 0, 0, tt.maxRetries)
+
+			start := time.Now()
+			resp, err := client.Generate(context.Background(), Request{Prompt: "hej"})
+			elapsed := time.Since(start)
+
+			if calls := len(next.callTimes()); calls != tt.wantCalls {
+				t.Errorf("the provider was called %d times, want %d", calls, tt.wantCalls)
+			}
+			if elapsed < tt.minElapsed {
+				t.Errorf("returned after %s, want at least %s", elapsed, tt.minElapsed)
+			}
+			var statusErr *StatusError
+			switch {
+			case tt.wantStatus != 0:
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Errorf("got the error %v, want status %d", err, tt.wantStatus)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got the error %v, want %v", err, tt.wantErr)
+				}
+			case err != nil || resp.Text != "hej":
+				t.Errorf("got %+v, %v", resp, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitedClientSharedPause(t *testing.T) {
+	next := &scriptedClient{script: []error{tooManyRequests(100 * time.Millisecond)}}
+	client := NewRateLimitedClient(next, 0, 0, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Generate(context.Background(), Request{Prompt: "first"})
+		done <- err
+	}()
+
+	// Once the first request was told to wait, a second caller waits as well
+	var pausedUntil time.Time
+	for pausedUntil.IsZero() {
+		time.Sleep(time.Millisecond)
+		client.mu.Lock()
+		pausedUntil = client.pausedUntil
+		client.mu.Unlock()
+	}
+	if _, err := client.Generate(context.Background(), Request{Prompt: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	calls := next.callTimes()
+	if len(calls) != 3 {
+		t.Fatalf("the provider was called %d times, want 3", len(calls))
+	}
+	for _, call := range calls[1:] {
+		if call.Before(pausedUntil) {
+			t.Errorf("a request was sent %s before the pause ended", pausedUntil.Sub(call))
+		}
+	}
+
+	// A canceled caller stops waiting for the pause
+	client.pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Generate(ctx, Request{Prompt: "third"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got the error %v, want the deadline", err)
+	}
+}
+
+func TestRateLimitedClientLimits(t *testing.T) {
+	next := &scriptedClient{}
+	// 1200 requests per minute are one every 50ms
+	client := NewRateLimitedClient(next, 1200, 0, 0)
+	start := time.Now()
+	for range 3 {
+		if _, err := client.Generate(context.Background(), Request{Prompt: "hej"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests took %s, want at least 100ms", elapsed)
+	}
+
+	// A request larger than the whole token budget still goes out
+	client = NewRateLimitedClient(next, 0, 6000, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.Generate(ctx, Request{Prompt: string(make([]byte, 50000))}); err != nil {
+		t.Errorf("a large request failed: %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{value: ""},
+		{value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{value: "0"},
+		{value: "-5"},
+		{value: "soon"},
+		{value: time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat), min: 28 * time.Second, max: 30 * time.Second},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
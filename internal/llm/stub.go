@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// numberedLineRegex matches the numbered item lines of a prompt: "3: Mellanmjölk 1,5l | text".
+var numberedLineRegex = regexp.MustCompile(`(?m)^(\d+): ([^|\n]*)`)
+
+// StubClient is an offline Client with canned answers, for evaluation runs in CI.
+// It understands prompts that list items as numbered lines, as the categorizer and
+// the attribute extractor send them, and answers {"products": [{"id": N, ...}]}
+// with the stored fields of every item it knows. Unknown items are left out.
+type StubClient struct {
+	responses map[string]map[string]any
+}
+
+// NewStubClient creates a stub answering with the given fields per item name.
+func NewStubClient(responses map[string]map[string]any) *StubClient {
+	return &StubClient{responses: responses}
+}
+
+// LoadStubClient reads the answers from a YAML file mapping item names to fields, e.g.
+//
+//	"Mellanmjölk 1,5l": {categories: [Mjölk]}
+func LoadStubClient(path string) (*StubClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stub responses: %w", err)
+	}
+	var responses map[string]map[string]any
+	if err := yaml.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("failed to parse stub responses %s: %w", path, err)
+	}
+	return NewStubClient(responses), nil
+}
+
+// Close implements Client.
+func (c *StubClient) Close() error {
+	return nil
+}
+
+// Generate implements Client.
+func (c *StubClient) Generate(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	products := []map[string]any{}
+	for _, match := range numberedLineRegex.FindAllStringSubmatch(req.Prompt, -1) {
+		fields, ok := c.responses[strings.TrimSpace(match[2])]
+		if !ok {
+			continue
+		}
+		id, _ := strconv.Atoi(match[1])
+		product := map[string]any{"id": id}
+		for name, value := range fields {
+			product[name] = value
+		}
+		products = append(products, product)
+	}
+	text, err := json.Marshal(map[string]any{"products": products})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode stub response: %w", err)
+	}
+	return &Response{
+		Text:         string(text),
+		InputTokens:  (len(req.System) + len(req.Prompt)) / 4,
+		OutputTokens: len(text) / 4,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage is what a client has consumed so far.
+type Usage struct {
+	Requests     int `json:"requests"`
+	Failures     int `json:"failures"`
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// Cost is the price of the usage given prices per million input and output tokens.
+func (u Usage) Cost(inputPrice, outputPrice float64) float64 {
+	return (float64(u.InputTokens)*inputPrice + float64(u.OutputTokens)*outputPrice) / 1e6
+}
+
+// UsageCounter is a Client decorator that adds up requests and tokens.
+type UsageCounter struct {
+	next Client
+
+	mu    sync.Mutex
+	usage Usage
+}
+
+// NewUsageCounter wraps next.
+func NewUsageCounter(next Client) *UsageCounter {
+	return &UsageCounter{next: next}
+}
+
+// Usage returns the totals so far.
+func (c *UsageCounter) Usage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
+
+// Generate implements Client.
+func (c *UsageCounter) Generate(ctx context.Context, req Request) (*Response, error) {
+	resp, err := c.next.Generate(ctx, req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage.Requests++
+	if err != nil {
+		c.usage.Failures++
+		return nil, err
+	}
+	c.usage.InputTokens += resp.InputTokens
+	c.usage.OutputTokens += resp.OutputTokens
+	return resp, nil
+}
+
+// Close implements Client.
+func (c *UsageCounter) Close() error {
+	return c.next.Close()
+}
@@ -0,0 +1,347 @@
+// Package migrations applies the versioned SQL migrations of the database schema.
+//
+// Migrations are embedded SQL files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, one directory per database backend with the same
+// versions in each. The versions applied to a database are recorded in
+// the schema_migrations table; every migration runs in its own transaction
+// together with its bookkeeping, so a failed migration leaves nothing behind.
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"grocery_scraper/internal/database"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockID is the Postgres advisory lock held while a migration runs, so parsers and
+// API servers starting at the same time do not migrate twice. SQLite needs no lock,
+// it only has one writer at a time.
+const lockID = 7_210_043
+
+// ErrSchemaMismatch is returned by Check when the database is not at the version
+// the binary was built for.
+var ErrSchemaMismatch = errors.New("database schema does not match")
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns a migrator for the embedded migrations of the database's backend.
+func New(db *gorm.DB) (*Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the database connection: %w", err)
+	}
+	dialect := database.Dialect(db)
+	dir, err := fs.Sub(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the %s migrations: %w", dialect, err)
+	}
+	return &Migrator{db: sqlDB, dialect: dialect, migrations: migrations}, nil
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations from the files in the root of fsys, ordered by version.
+// Every migration needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file %s in migrations", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// init creates the schema_migrations table.
+func (m *Migrator) init(ctx context.Context) error {
+	appliedAt := "applied_at timestamptz NOT NULL DEFAULT now()"
+	if m.dialect == database.SQLite {
+		appliedAt = "applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	}
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		`+appliedAt+`
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// applied returns when each applied version was applied. A database without the
+// schema_migrations table has none; reading does not create it.
+func (m *Migrator) applied(ctx context.Context) (map[uint]time.Time, error) {
+	applied := make(map[uint]time.Time)
+	lookup := `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	if m.dialect == database.SQLite {
+		lookup = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`
+	}
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, lookup).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version uint
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Current returns the newest applied version, 0 for an empty database.
+func (m *Migrator) Current(ctx context.Context) (uint, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var current uint
+	for version := range applied {
+		current = max(current, version)
+	}
+	return current, nil
+}
+
+// Status lists every known migration and whether it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the given number of applied migrations, newest first, and returns
+// the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			versions = append(versions, migration.Version)
+		}
+	}
+	var target uint
+	if steps < len(versions) {
+		target = versions[len(versions)-1-steps]
+	}
+	return m.To(ctx, target)
+}
+
+// To migrates up or down until version is the newest applied migration. Version 0
+// reverts everything.
+func (m *Migrator) To(ctx context.Context, version uint) ([]Migration, error) {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(mig Migration) bool { return mig.Version == version }) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > version {
+			continue
+		}
+		if err := m.run(ctx, migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+			continue
+		}
+		if err := m.run(ctx, migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// run applies or reverts a single migration and records it, in one transaction.
+// Another process may have done the same while this one waited for the lock, so
+// the bookkeeping is checked again once the lock is held.
+func (m *Migrator) run(ctx context.Context, migration Migration, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start migration %d: %w", migration.Version, err)
+	}
+	defer tx.Rollback()
+
+	if m.dialect == database.Postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+			return fmt.Errorf("failed to lock the schema for migration %d: %w", migration.Version, err)
+		}
+	}
+	var applied bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version).Scan(&applied)
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if applied == up {
+		return nil
+	}
+
+	script, direction := migration.Up, "apply"
+	if !up {
+		script, direction = migration.Down, "revert"
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("failed to %s migration %d_%s: %w", direction, migration.Version, migration.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return tx.Commit()
+}
+
+// Check returns ErrSchemaMismatch unless the newest applied migration is the
+// newest migration of this binary.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current != m.Latest() {
+		return fmt.Errorf("%w: the database is at version %d, this build expects %d", ErrSchemaMismatch, current, m.Latest())
+	}
+	return nil
+}
+
+// Prepare readies the database for use at startup: with autoMigrate it applies the
+// pending migrations, otherwise it fails unless the schema is at the latest version.
+func Prepare(ctx context.Context, db *gorm.DB, autoMigrate bool) error {
+	migrator, err := New(db)
+	if err != nil {
+		return err
+	}
+	if !autoMigrate {
+		return migrator.Check(ctx)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		return fmt.Errorf("failed to migrate the database: %w", err)
+	}
+	return nil
+}
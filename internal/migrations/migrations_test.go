@@ -0,0 +1,231 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/database"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// baselineOffers is the offers table as GORM's AutoMigrate created it before
+// versioned migrations, the only table of those databases.
+const baselineOffers = `
+CREATE TABLE offers (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    store_name varchar(100),
+    name varchar(255),
+    product_url varchar(2048),
+    type varchar(50),
+    original_price numeric(10, 2),
+    sale_price numeric(10, 2) NOT NULL,
+    sale_quantity bigint,
+    sale_price_total numeric(10, 2),
+    discount bigint,
+    discount_percentage numeric(5, 2),
+    categories text[],
+    valid_from timestamptz,
+    valid_to timestamptz
+);
+CREATE INDEX idx_offers_deleted_at ON offers (deleted_at);
+CREATE UNIQUE INDEX idx_store_name_product_name ON offers (store_name, name, product_url);
+CREATE INDEX idx_offers_valid_from ON offers (valid_from);
+CREATE INDEX idx_offers_valid_to ON offers (valid_to);
+`
+
+func TestEmbeddedMigrations(t *testing.T) {
+	var latest []uint
+	for _, dialect := range []string{database.Postgres, database.SQLite} {
+		dir, err := fs.Sub(files, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrations, err := Load(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: no migrations", dialect)
+		}
+		for i, m := range migrations {
+			if m.Version != uint(i+1) {
+				t.Errorf("%s: migration %d_%s should be version %d", dialect, m.Version, m.Name, i+1)
+			}
+		}
+		latest = append(latest, migrations[len(migrations)-1].Version)
+	}
+	if latest[0] != latest[1] {
+		t.Errorf("the Postgres migrations end at version %d, the SQLite ones at %d", latest[0], latest[1])
+	}
+}
+
+func TestSQLiteUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, "sqlite://"+filepath.Join(t.TempDir(), "offers.db"))
+	migrator := newMigrator(t, db)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Down(ctx, int(migrator.Latest())); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if current, err := migrator.Current(ctx); err != nil || current != 0 {
+		t.Fatalf("after down the database is at version %d (%v), want 0", current, err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+}
+
+func TestSQLiteOfferChangeStoreIDs(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, "sqlite://"+filepath.Join(t.TempDir(), "offers.db"))
+	migrator := newMigrator(t, db)
+	if _, err := migrator.To(ctx, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	statements := []string{
+		`INSERT INTO stores (id, chain, external_id, name, url_slug) VALUES
+			(1, 'ICA', '1004348', 'ICA Maxi Kalmar', 'maxi-ica-stormarknad-kalmar-1004348'),
+			(2, 'ICA', '1003977', 'ICA Kvantum', 'kvantum-smedby-1003977')`,
+		`INSERT INTO offers (store_id, source, promotion_id, store_name, name, product_url, sale_price)
+			VALUES (2, 'ica', 'p1', 'ICA Kvantum', 'Kaffe', '', 39.90)`,
+		`INSERT INTO offer_changes (store_name, name, product_url, kind) VALUES
+			('Maxi Kalmar', 'Mjölk', 'https://www.ica.se/erbjudanden/maxi-ica-stormarknad-kalmar-1004348?id=1&action=details', 'new_offer'),
+			('ICA Kvantum', 'Kaffe', '', 'offer_ended'),
+			('Okänd butik', 'Ost', '', 'new_offer')`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []struct {
+		Name    string
+		StoreID *uint
+	}
+	if err := db.Raw("SELECT name, store_id FROM offer_changes").Scan(&changes).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint{"Mjölk": 1, "Kaffe": 2, "Ost": 0}
+	for _, change := range changes {
+		var got uint
+		if change.StoreID != nil {
+			got = *change.StoreID
+		}
+		if got != want[change.Name] {
+			t.Errorf("the change of %s belongs to store %d, want %d", change.Name, got, want[change.Name])
+		}
+	}
+}
+
+// TestPostgresBaseline migrates a database created before versioned migrations.
+// It needs a Postgres server: set TEST_POSTGRES_URL to a database URL, the test
+// works in a schema of its own and drops it afterwards.
+func TestPostgresBaseline(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	admin := openTestDB(t, dsn)
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_POSTGRES_URL must be a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	db := openTestDB(t, u.String())
+
+	if err := db.Exec(baselineOffers).Error; err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec(`INSERT INTO offers (created_at, updated_at, store_name, name, product_url, type,
+			sale_price, categories, valid_from, valid_to)
+		VALUES (now(), NULL, 'ICA Maxi Lindhagen', 'Kaffe', 'https://www.ica.se/erbjudanden/ica-maxi-lindhagen-1004247?id=2002&action=details',
+			'regular', 39.90, '{Skafferi}', now(), now() + interval '7 days')`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Prepare(ctx, db, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prepare(ctx, db, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var offer struct {
+		StoreID     *uint
+		PromotionID *string
+	}
+	if err := db.Raw("SELECT store_id, promotion_id FROM offers").Scan(&offer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if offer.StoreID == nil || offer.PromotionID == nil || *offer.PromotionID != "2002" {
+		t.Errorf("the baseline offer was not backfilled: store %v, promotion %v", offer.StoreID, offer.PromotionID)
+	}
+	var observations, categories int64
+	if err := db.Raw("SELECT COUNT(*) FROM offer_observations").Scan(&observations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if observations != 1 {
+		t.Errorf("got %d observations of the baseline offer, want 1", observations)
+	}
+	if err := db.Raw("SELECT COUNT(*) FROM offer_categories").Scan(&categories).Error; err != nil {
+		t.Fatal(err)
+	}
+	if categories != 1 {
+		t.Errorf("got %d categories of the baseline offer, want 1", categories)
+	}
+}
+
+func openTestDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newMigrator(t *testing.T, db *gorm.DB) *Migrator {
+	t.Helper()
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS scrape_run_stores;
+DROP TABLE IF EXISTS scrape_runs;
+DROP TABLE IF EXISTS stores;
+DROP TABLE IF EXISTS quarantined_offers;
+DROP TABLE IF EXISTS offer_changes;
+DROP TABLE IF EXISTS category_overrides;
+DROP TABLE IF EXISTS product_categories;
+DROP TABLE IF EXISTS product_overrides;
+DROP TABLE IF EXISTS product_keys;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS offer_observations;
+DROP TABLE IF EXISTS offers;
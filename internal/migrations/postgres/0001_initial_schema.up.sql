@@ -0,0 +1,247 @@
+-- The schema as it was created by GORM's AutoMigrate. Every statement is guarded
+-- with IF NOT EXISTS, so databases that were set up before versioned migrations
+-- are adopted as they are. Their offers table may predate the columns added since
+-- the first release; those are added before anything uses them.
+
+CREATE TABLE IF NOT EXISTS offers (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    store_name varchar(100),
+    name varchar(255),
+    product_url varchar(2048),
+    type varchar(50),
+    original_price numeric(10, 2),
+    sale_price numeric(10, 2) NOT NULL,
+    sale_quantity bigint,
+    sale_price_total numeric(10, 2),
+    discount bigint,
+    discount_percentage numeric(5, 2),
+    categories text[],
+    brand varchar(100),
+    net_quantity numeric(10, 3),
+    net_unit varchar(10),
+    labels text[],
+    swedish_origin boolean,
+    dietary_tags text[],
+    product_id bigint,
+    product_key varchar(512),
+    run_id bigint,
+    valid_from timestamptz,
+    valid_to timestamptz
+);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS brand varchar(100);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS net_quantity numeric(10, 3);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS net_unit varchar(10);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS labels text[];
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS swedish_origin boolean;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS dietary_tags text[];
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS product_id bigint;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS product_key varchar(512);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS run_id bigint;
+CREATE INDEX IF NOT EXISTS idx_offers_deleted_at ON offers (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_store_name_product_name ON offers (store_name, name, product_url);
+CREATE INDEX IF NOT EXISTS idx_offers_brand ON offers (brand);
+CREATE INDEX IF NOT EXISTS idx_offers_swedish_origin ON offers (swedish_origin);
+CREATE INDEX IF NOT EXISTS idx_offers_product_id ON offers (product_id);
+CREATE INDEX IF NOT EXISTS idx_offers_product_key ON offers (product_key);
+CREATE INDEX IF NOT EXISTS idx_offers_run_id ON offers (run_id);
+CREATE INDEX IF NOT EXISTS idx_offers_valid_from ON offers (valid_from);
+CREATE INDEX IF NOT EXISTS idx_offers_valid_to ON offers (valid_to);
+
+CREATE TABLE IF NOT EXISTS offer_observations (
+    id bigserial PRIMARY KEY,
+    offer_id bigint NOT NULL,
+    product_id bigint,
+    run_id bigint,
+    store_name varchar(100),
+    name varchar(255),
+    type varchar(50),
+    original_price numeric(10, 2),
+    sale_price numeric(10, 2),
+    sale_quantity bigint,
+    sale_price_total numeric(10, 2),
+    discount bigint,
+    discount_percentage numeric(5, 2),
+    valid_from timestamptz,
+    valid_to timestamptz,
+    observed_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_offer_observations_offer ON offer_observations (offer_id, observed_at);
+CREATE INDEX IF NOT EXISTS idx_offer_observations_product ON offer_observations (product_id, observed_at);
+CREATE INDEX IF NOT EXISTS idx_offer_observations_run_id ON offer_observations (run_id);
+CREATE INDEX IF NOT EXISTS idx_offer_observations_observed_at ON offer_observations (observed_at);
+
+-- The history starts with the offers already in the table
+INSERT INTO offer_observations (offer_id, product_id, store_name, name, type,
+        original_price, sale_price, sale_quantity, sale_price_total, discount, discount_percentage,
+        valid_from, valid_to, observed_at)
+    SELECT id, product_id, store_name, name, type, original_price, sale_price, sale_quantity,
+        sale_price_total, discount, discount_percentage, valid_from, valid_to,
+        COALESCE(updated_at, created_at, now())
+    FROM offers
+    WHERE deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM offer_observations);
+
+CREATE TABLE IF NOT EXISTS products (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    canonical_name varchar(255),
+    brand varchar(100),
+    size numeric(10, 2),
+    unit varchar(10),
+    ean varchar(14)
+);
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_products_canonical_name ON products (canonical_name);
+CREATE INDEX IF NOT EXISTS idx_products_ean ON products (ean);
+
+CREATE TABLE IF NOT EXISTS product_keys (
+    key varchar(512) PRIMARY KEY,
+    product_id bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_product_keys_product_id ON product_keys (product_id);
+
+CREATE TABLE IF NOT EXISTS product_overrides (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    key varchar(512),
+    product_id bigint NOT NULL,
+    action varchar(10),
+    reason text
+);
+CREATE INDEX IF NOT EXISTS idx_product_overrides_deleted_at ON product_overrides (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_overrides_key ON product_overrides (key);
+CREATE INDEX IF NOT EXISTS idx_product_overrides_product_id ON product_overrides (product_id);
+
+CREATE TABLE IF NOT EXISTS product_categories (
+    normalized_name varchar(255) PRIMARY KEY,
+    categories text[],
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_product_categories_updated_at ON product_categories (updated_at);
+
+CREATE TABLE IF NOT EXISTS category_overrides (
+    id bigserial PRIMARY KEY,
+    key varchar(300),
+    product_id bigint,
+    product_name varchar(255),
+    categories text[],
+    reason varchar(255),
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_category_overrides_key ON category_overrides (key);
+CREATE INDEX IF NOT EXISTS idx_category_overrides_updated_at ON category_overrides (updated_at);
+
+CREATE TABLE IF NOT EXISTS offer_changes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    store_name varchar(100),
+    name varchar(255),
+    product_url varchar(2048),
+    product_id bigint,
+    kind varchar(30),
+    old_type varchar(50),
+    new_type varchar(50),
+    old_price numeric(10, 2),
+    new_price numeric(10, 2),
+    old_discount_percentage numeric(5, 2),
+    new_discount_percentage numeric(5, 2),
+    detected_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_offer_changes_deleted_at ON offer_changes (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_offer_changes_store_name ON offer_changes (store_name);
+CREATE INDEX IF NOT EXISTS idx_offer_changes_product_id ON offer_changes (product_id);
+CREATE INDEX IF NOT EXISTS idx_offer_changes_kind ON offer_changes (kind);
+CREATE INDEX IF NOT EXISTS idx_offer_changes_detected_at ON offer_changes (detected_at);
+
+CREATE TABLE IF NOT EXISTS quarantined_offers (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    store_name varchar(100),
+    name varchar(255),
+    product_url varchar(2048),
+    type varchar(50),
+    original_price numeric(10, 2),
+    sale_price numeric(10, 2),
+    sale_quantity bigint,
+    sale_price_total numeric(10, 2),
+    discount bigint,
+    discount_percentage numeric(5, 2),
+    valid_from timestamptz,
+    valid_to timestamptz,
+    raw_original_text text,
+    raw_deal_text text,
+    rule varchar(50),
+    reason text,
+    status varchar(20) DEFAULT 'pending',
+    released_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_quarantined_offers_deleted_at ON quarantined_offers (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantine_store_product ON quarantined_offers (store_name, name, product_url);
+CREATE INDEX IF NOT EXISTS idx_quarantined_offers_status ON quarantined_offers (status);
+
+CREATE TABLE IF NOT EXISTS stores (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    chain varchar(20),
+    external_id varchar(50),
+    name varchar(100),
+    url_slug varchar(255),
+    profile varchar(20),
+    address varchar(255),
+    postal_code varchar(10),
+    city varchar(100),
+    latitude decimal,
+    longitude decimal,
+    opening_hours text
+);
+CREATE INDEX IF NOT EXISTS idx_stores_deleted_at ON stores (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_store_chain_external_id ON stores (chain, external_id);
+CREATE INDEX IF NOT EXISTS idx_stores_postal_code ON stores (postal_code);
+CREATE INDEX IF NOT EXISTS idx_stores_city ON stores (city);
+
+CREATE TABLE IF NOT EXISTS scrape_runs (
+    id bigserial PRIMARY KEY,
+    started_at timestamptz NOT NULL,
+    finished_at timestamptz,
+    status varchar(20) NOT NULL,
+    config_hash varchar(64),
+    version varchar(100),
+    error text
+);
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_started_at ON scrape_runs (started_at);
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_status ON scrape_runs (status);
+
+CREATE TABLE IF NOT EXISTS scrape_run_stores (
+    id bigserial PRIMARY KEY,
+    run_id bigint NOT NULL,
+    store_name varchar(100) NOT NULL,
+    status varchar(20) NOT NULL,
+    fetched bigint,
+    parsed bigint,
+    skipped bigint,
+    inserted bigint,
+    updated bigint,
+    categorized bigint,
+    categorization_failed bigint,
+    started_at timestamptz,
+    finished_at timestamptz,
+    duration_ms bigint,
+    error text,
+    CONSTRAINT fk_scrape_runs_stores FOREIGN KEY (run_id) REFERENCES scrape_runs (id)
+);
+CREATE INDEX IF NOT EXISTS idx_scrape_run_stores_run_id ON scrape_run_stores (run_id);
+CREATE INDEX IF NOT EXISTS idx_scrape_run_stores_store ON scrape_run_stores (store_name, status, finished_at);
@@ -0,0 +1,11 @@
+-- Indexes for OfferQuery: the array filters, the offer type, and keyset pagination on
+-- the most used sort fields. Ties are broken by ID, so it is the last key column.
+CREATE INDEX IF NOT EXISTS idx_offers_categories ON offers USING gin (categories);
+CREATE INDEX IF NOT EXISTS idx_offers_labels ON offers USING gin (labels);
+CREATE INDEX IF NOT EXISTS idx_offers_dietary_tags ON offers USING gin (dietary_tags);
+CREATE INDEX IF NOT EXISTS idx_offers_type ON offers (type);
+CREATE INDEX IF NOT EXISTS idx_offers_sale_price_id ON offers (sale_price, id);
+CREATE INDEX IF NOT EXISTS idx_offers_discount_percentage_id ON offers (discount_percentage, id);
+CREATE INDEX IF NOT EXISTS idx_offers_discount_id ON offers (discount, id);
+CREATE INDEX IF NOT EXISTS idx_offers_original_price_id ON offers (original_price, id);
+CREATE INDEX IF NOT EXISTS idx_stores_chain ON stores (chain);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_offers_name_trgm;
+DROP INDEX IF EXISTS idx_offers_search_vector;
+ALTER TABLE offers DROP COLUMN IF EXISTS search_vector;
+-- pg_trgm is left installed; other database objects may use it
@@ -0,0 +1,12 @@
+-- Product search: Swedish full-text search on the name and brand, so "mjölken" finds
+-- "Mjölk", and trigram similarity on the name for typos.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('swedish', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('swedish', coalesce(brand, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_offers_search_vector ON offers USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_offers_name_trgm ON offers USING gin (name gin_trgm_ops);
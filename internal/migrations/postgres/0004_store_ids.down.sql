@@ -0,0 +1,15 @@
+-- The stores added for existing offers stay in the catalogue; merged duplicate
+-- offers are not split again.
+ALTER TABLE scrape_run_stores DROP CONSTRAINT IF EXISTS fk_scrape_run_stores_store;
+ALTER TABLE quarantined_offers DROP CONSTRAINT IF EXISTS fk_quarantined_offers_store;
+ALTER TABLE offers DROP CONSTRAINT IF EXISTS fk_offers_store;
+
+DROP INDEX IF EXISTS idx_scrape_run_stores_store_id;
+DROP INDEX IF EXISTS idx_quarantined_offers_store_id;
+DROP INDEX IF EXISTS idx_offers_store_name;
+DROP INDEX IF EXISTS idx_offers_store_product;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_store_name_product_name ON offers (store_name, name, product_url);
+
+ALTER TABLE scrape_run_stores DROP COLUMN IF EXISTS store_id;
+ALTER TABLE quarantined_offers DROP COLUMN IF EXISTS store_id;
+ALTER TABLE offers DROP COLUMN IF EXISTS store_id;
@@ -0,0 +1,57 @@
+-- Offers reference the stores table instead of being keyed by the store's display
+-- name, so renaming a store in config.yaml keeps its offers. Stores are keyed by
+-- chain and the ID at the end of the offers page slug, which existing rows carry in
+-- their product URL: https://www.ica.se/erbjudanden/<slug>?id=...
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS store_id bigint;
+ALTER TABLE quarantined_offers ADD COLUMN IF NOT EXISTS store_id bigint;
+ALTER TABLE scrape_run_stores ADD COLUMN IF NOT EXISTS store_id bigint;
+
+CREATE TEMPORARY TABLE offer_store_keys ON COMMIT DROP AS
+    SELECT 'offers' AS source, id, store_name, updated_at, slug,
+        COALESCE(substring(slug FROM '-(\d+)$'), slug) AS external_id
+    FROM (SELECT id, store_name, updated_at, substring(product_url FROM '/erbjudanden/([^/?]+)') AS slug FROM offers) o
+    WHERE slug IS NOT NULL
+    UNION ALL
+    SELECT 'quarantined_offers', id, store_name, updated_at, slug,
+        COALESCE(substring(slug FROM '-(\d+)$'), slug)
+    FROM (SELECT id, store_name, updated_at, substring(product_url FROM '/erbjudanden/([^/?]+)') AS slug FROM quarantined_offers) q
+    WHERE slug IS NOT NULL;
+
+-- Every store that was scraped gets a row, named as in its latest offer
+INSERT INTO stores (created_at, updated_at, chain, external_id, name, url_slug)
+    SELECT DISTINCT ON (external_id) now(), now(), 'ICA', external_id, store_name, slug
+    FROM offer_store_keys
+    ORDER BY external_id, updated_at DESC
+ON CONFLICT (chain, external_id) DO NOTHING;
+
+UPDATE offers SET store_id = stores.id
+    FROM offer_store_keys k JOIN stores ON stores.chain = 'ICA' AND stores.external_id = k.external_id
+    WHERE k.source = 'offers' AND offers.id = k.id;
+UPDATE quarantined_offers SET store_id = stores.id
+    FROM offer_store_keys k JOIN stores ON stores.chain = 'ICA' AND stores.external_id = k.external_id
+    WHERE k.source = 'quarantined_offers' AND quarantined_offers.id = k.id;
+UPDATE scrape_run_stores SET store_id = (
+    SELECT MIN(store_id) FROM offers WHERE offers.store_name = scrape_run_stores.store_name
+);
+
+-- A store that was renamed has its offers twice; keep the latest row of each and
+-- move the history of the others onto it
+CREATE TEMPORARY TABLE duplicate_offers ON COMMIT DROP AS
+    SELECT id, keep_id FROM (
+        SELECT id, first_value(id) OVER (PARTITION BY store_id, name, product_url ORDER BY updated_at DESC, id DESC) AS keep_id
+        FROM offers
+        WHERE store_id IS NOT NULL
+    ) ranked
+    WHERE id <> keep_id;
+UPDATE offer_observations SET offer_id = d.keep_id FROM duplicate_offers d WHERE offer_observations.offer_id = d.id;
+DELETE FROM offers USING duplicate_offers d WHERE offers.id = d.id;
+
+DROP INDEX IF EXISTS idx_store_name_product_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_store_product ON offers (store_id, name, product_url);
+CREATE INDEX IF NOT EXISTS idx_offers_store_name ON offers (store_name);
+CREATE INDEX IF NOT EXISTS idx_quarantined_offers_store_id ON quarantined_offers (store_id);
+CREATE INDEX IF NOT EXISTS idx_scrape_run_stores_store_id ON scrape_run_stores (store_id);
+
+ALTER TABLE offers ADD CONSTRAINT fk_offers_store FOREIGN KEY (store_id) REFERENCES stores (id);
+ALTER TABLE quarantined_offers ADD CONSTRAINT fk_quarantined_offers_store FOREIGN KEY (store_id) REFERENCES stores (id);
+ALTER TABLE scrape_run_stores ADD CONSTRAINT fk_scrape_run_stores_store FOREIGN KEY (store_id) REFERENCES stores (id);
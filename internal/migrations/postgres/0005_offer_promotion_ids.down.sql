@@ -0,0 +1,21 @@
+-- Offers of the same product in several weeks share a name and URL; only the latest
+-- row of each is kept so the old unique index can be built again.
+CREATE TEMPORARY TABLE duplicate_products ON COMMIT DROP AS
+    SELECT id, keep_id FROM (
+        SELECT id, first_value(id) OVER (
+            PARTITION BY store_id, name, product_url
+            ORDER BY updated_at DESC, id DESC
+        ) AS keep_id
+        FROM offers
+    ) ranked
+    WHERE id <> keep_id;
+UPDATE offer_observations SET offer_id = d.keep_id FROM duplicate_products d WHERE offer_observations.offer_id = d.id;
+DELETE FROM offers USING duplicate_products d WHERE offers.id = d.id;
+
+DROP INDEX IF EXISTS idx_offers_promotion;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_store_product ON offers (store_id, name, product_url);
+
+ALTER TABLE quarantined_offers DROP COLUMN IF EXISTS promotion_id;
+ALTER TABLE quarantined_offers DROP COLUMN IF EXISTS source;
+ALTER TABLE offers DROP COLUMN IF EXISTS promotion_id;
+ALTER TABLE offers DROP COLUMN IF EXISTS source;
@@ -0,0 +1,29 @@
+-- Offers are identified by their store, source, promotion ID and validity period
+-- instead of their name and URL, so a product renamed by ICA updates its offer and
+-- two offers with the same title stay apart. Existing rows carry the promotion ID in
+-- their product URL: https://www.ica.se/erbjudanden/<slug>?id=<promotion ID>&action=details
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS source varchar(20);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS promotion_id varchar(100);
+ALTER TABLE quarantined_offers ADD COLUMN IF NOT EXISTS source varchar(20);
+ALTER TABLE quarantined_offers ADD COLUMN IF NOT EXISTS promotion_id varchar(100);
+
+UPDATE offers SET source = 'ica', promotion_id = substring(product_url FROM '[?&]id=([^&]+)');
+UPDATE quarantined_offers SET source = 'ica', promotion_id = substring(product_url FROM '[?&]id=([^&]+)');
+
+-- A renamed product has the same promotion twice; keep the latest row of each and
+-- move the history of the others onto it. Rows without a promotion ID are kept.
+CREATE TEMPORARY TABLE duplicate_promotions ON COMMIT DROP AS
+    SELECT id, keep_id FROM (
+        SELECT id, first_value(id) OVER (
+            PARTITION BY store_id, source, promotion_id, valid_from, valid_to
+            ORDER BY updated_at DESC, id DESC
+        ) AS keep_id
+        FROM offers
+        WHERE promotion_id IS NOT NULL
+    ) ranked
+    WHERE id <> keep_id;
+UPDATE offer_observations SET offer_id = d.keep_id FROM duplicate_promotions d WHERE offer_observations.offer_id = d.id;
+DELETE FROM offers USING duplicate_promotions d WHERE offers.id = d.id;
+
+DROP INDEX IF EXISTS idx_offers_store_product;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_promotion ON offers (store_id, source, promotion_id, valid_from, valid_to);
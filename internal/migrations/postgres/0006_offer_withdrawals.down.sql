@@ -0,0 +1,3 @@
+ALTER TABLE scrape_run_stores DROP COLUMN IF EXISTS withdrawn;
+DROP INDEX IF EXISTS idx_offers_withdrawn_at;
+ALTER TABLE offers DROP COLUMN IF EXISTS withdrawn_at;
@@ -0,0 +1,15 @@
+ALTER TABLE product_categories DROP COLUMN IF EXISTS confidence;
+ALTER TABLE product_categories DROP COLUMN IF EXISTS source;
+
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS categories text[];
+UPDATE offers SET categories = assigned.keys
+FROM (
+    SELECT offer_categories.offer_id, array_agg(categories.key ORDER BY categories.key) AS keys
+    FROM offer_categories JOIN categories ON categories.id = offer_categories.category_id
+    GROUP BY offer_categories.offer_id
+) AS assigned
+WHERE assigned.offer_id = offers.id;
+CREATE INDEX IF NOT EXISTS idx_offers_categories ON offers USING gin (categories);
+
+DROP TABLE IF EXISTS offer_categories;
+DROP TABLE IF EXISTS categories;
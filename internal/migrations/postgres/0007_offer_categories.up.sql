@@ -0,0 +1,43 @@
+-- Categories move from the text[] column of offers into their own table, linked to
+-- the offers through offer_categories. Every assignment records who made it and how
+-- sure it was; the existing ones predate that and are marked legacy. The parents of
+-- the categories are filled in from the taxonomy when the parser or the API starts.
+CREATE TABLE IF NOT EXISTS categories (
+    id bigserial PRIMARY KEY,
+    key varchar(100),
+    name varchar(255),
+    parent_id bigint REFERENCES categories (id) ON DELETE SET NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_key ON categories (key);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+CREATE TABLE IF NOT EXISTS offer_categories (
+    offer_id bigint NOT NULL REFERENCES offers (id) ON DELETE CASCADE,
+    category_id bigint NOT NULL REFERENCES categories (id) ON DELETE CASCADE,
+    source varchar(20) NOT NULL,
+    confidence numeric(4, 3),
+    created_at timestamptz,
+    PRIMARY KEY (offer_id, category_id)
+);
+CREATE INDEX IF NOT EXISTS idx_offer_categories_category_id ON offer_categories (category_id);
+
+INSERT INTO categories (key, name, created_at, updated_at)
+    SELECT DISTINCT c.key, c.key, now(), now()
+    FROM offers CROSS JOIN LATERAL unnest(offers.categories) AS c(key)
+    WHERE c.key <> ''
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO offer_categories (offer_id, category_id, source, created_at)
+    SELECT DISTINCT offers.id, categories.id, 'legacy', now()
+    FROM offers CROSS JOIN LATERAL unnest(offers.categories) AS c(key)
+    JOIN categories ON categories.key = c.key
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_offers_categories;
+ALTER TABLE offers DROP COLUMN IF EXISTS categories;
+
+-- The category cache remembers who categorized a product as well
+ALTER TABLE product_categories ADD COLUMN IF NOT EXISTS source varchar(20);
+ALTER TABLE product_categories ADD COLUMN IF NOT EXISTS confidence numeric(4, 3);
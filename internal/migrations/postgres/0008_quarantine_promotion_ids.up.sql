@@ -0,0 +1,18 @@
+-- Quarantined offers are identified like offers, by their store, source, promotion ID
+-- and validity period, so a quarantined card that ICA renames stays one row and two
+-- cards with the same title stay apart. The latest row of each promotion is kept;
+-- rows without a promotion ID are kept.
+CREATE TEMPORARY TABLE duplicate_quarantined ON COMMIT DROP AS
+    SELECT id FROM (
+        SELECT id, first_value(id) OVER (
+            PARTITION BY store_id, source, promotion_id, valid_from, valid_to
+            ORDER BY updated_at DESC, id DESC
+        ) AS keep_id
+        FROM quarantined_offers
+        WHERE promotion_id IS NOT NULL
+    ) ranked
+    WHERE id <> keep_id;
+DELETE FROM quarantined_offers USING duplicate_quarantined d WHERE quarantined_offers.id = d.id;
+
+DROP INDEX IF EXISTS idx_quarantine_store_product;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantine_promotion ON quarantined_offers (store_id, source, promotion_id, valid_from, valid_to);
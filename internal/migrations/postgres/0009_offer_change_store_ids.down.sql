@@ -0,0 +1,3 @@
+ALTER TABLE offer_changes DROP CONSTRAINT IF EXISTS fk_offer_changes_store;
+DROP INDEX IF EXISTS idx_offer_changes_store_id;
+ALTER TABLE offer_changes DROP COLUMN IF EXISTS store_id;
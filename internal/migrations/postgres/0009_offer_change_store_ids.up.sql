@@ -0,0 +1,17 @@
+-- Change events reference the stores table like offers do, so renaming a store does
+-- not split its change history under two names. Existing events take the store
+-- whose offers page their product URL points to, or else the store of the offers
+-- with the same store name.
+ALTER TABLE offer_changes ADD COLUMN IF NOT EXISTS store_id bigint;
+
+UPDATE offer_changes SET store_id = (
+    SELECT MIN(stores.id) FROM stores
+    WHERE strpos(offer_changes.product_url, '/erbjudanden/' || stores.url_slug || '?') > 0
+);
+UPDATE offer_changes SET store_id = (
+    SELECT MIN(store_id) FROM offers WHERE offers.store_name = offer_changes.store_name
+)
+WHERE store_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_offer_changes_store_id ON offer_changes (store_id);
+ALTER TABLE offer_changes ADD CONSTRAINT fk_offer_changes_store FOREIGN KEY (store_id) REFERENCES stores (id);
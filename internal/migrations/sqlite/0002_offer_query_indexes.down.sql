@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_stores_chain;
+DROP INDEX IF EXISTS idx_offers_original_price_id;
+DROP INDEX IF EXISTS idx_offers_discount_id;
+DROP INDEX IF EXISTS idx_offers_discount_percentage_id;
+DROP INDEX IF EXISTS idx_offers_sale_price_id;
+DROP INDEX IF EXISTS idx_offers_type;
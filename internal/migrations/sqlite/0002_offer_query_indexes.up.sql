@@ -0,0 +1,8 @@
+-- Indexes for OfferQuery: the offer type and keyset pagination on the most used sort
+-- fields. The array filters read the JSON columns, which SQLite cannot index.
+CREATE INDEX IF NOT EXISTS idx_offers_type ON offers (type);
+CREATE INDEX IF NOT EXISTS idx_offers_sale_price_id ON offers (sale_price, id);
+CREATE INDEX IF NOT EXISTS idx_offers_discount_percentage_id ON offers (discount_percentage, id);
+CREATE INDEX IF NOT EXISTS idx_offers_discount_id ON offers (discount, id);
+CREATE INDEX IF NOT EXISTS idx_offers_original_price_id ON offers (original_price, id);
+CREATE INDEX IF NOT EXISTS idx_stores_chain ON stores (chain);
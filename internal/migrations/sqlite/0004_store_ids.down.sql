@@ -0,0 +1,11 @@
+-- The stores added for existing offers stay in the catalogue; merged duplicate
+-- offers are not split again.
+DROP INDEX IF EXISTS idx_scrape_run_stores_store_id;
+DROP INDEX IF EXISTS idx_quarantined_offers_store_id;
+DROP INDEX IF EXISTS idx_offers_store_name;
+DROP INDEX IF EXISTS idx_offers_store_product;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_store_name_product_name ON offers (store_name, name, product_url);
+
+ALTER TABLE scrape_run_stores DROP COLUMN store_id;
+ALTER TABLE quarantined_offers DROP COLUMN store_id;
+ALTER TABLE offers DROP COLUMN store_id;
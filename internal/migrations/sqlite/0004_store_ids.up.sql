@@ -0,0 +1,67 @@
+-- Offers reference the stores table instead of being keyed by the store's display
+-- name, so renaming a store in config.yaml keeps its offers. Stores are keyed by
+-- chain and the ID at the end of the offers page slug, which existing rows carry in
+-- their product URL: https://www.ica.se/erbjudanden/<slug>?id=...
+ALTER TABLE offers ADD COLUMN store_id integer REFERENCES stores (id);
+ALTER TABLE quarantined_offers ADD COLUMN store_id integer REFERENCES stores (id);
+ALTER TABLE scrape_run_stores ADD COLUMN store_id integer REFERENCES stores (id);
+
+-- SQLite has no regular expressions: the slug is cut out of the URL with instr, and
+-- its trailing digits are the store ID when they follow a dash
+CREATE TEMPORARY TABLE offer_store_keys AS
+    SELECT source, id, store_name, updated_at, slug,
+        CASE WHEN rtrim(slug, '0123456789') LIKE '%-' AND rtrim(slug, '0123456789') <> slug
+            THEN substr(slug, length(rtrim(slug, '0123456789')) + 1)
+            ELSE slug
+        END AS external_id
+    FROM (
+        SELECT source, id, store_name, updated_at,
+            CASE WHEN instr(path, '?') > 0 THEN substr(path, 1, instr(path, '?') - 1) ELSE path END AS slug
+        FROM (
+            SELECT 'offers' AS source, id, store_name, updated_at,
+                substr(product_url, instr(product_url, '/erbjudanden/') + 13) AS path
+            FROM offers WHERE instr(product_url, '/erbjudanden/') > 0
+            UNION ALL
+            SELECT 'quarantined_offers', id, store_name, updated_at,
+                substr(product_url, instr(product_url, '/erbjudanden/') + 13)
+            FROM quarantined_offers WHERE instr(product_url, '/erbjudanden/') > 0
+        )
+    )
+    WHERE slug <> '';
+
+-- Every store that was scraped gets a row, named as in its latest offer (SQLite takes
+-- the other columns of a group from the row with the MAX)
+INSERT OR IGNORE INTO stores (created_at, updated_at, chain, external_id, name, url_slug)
+    SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'ICA', external_id, store_name, slug
+    FROM (SELECT external_id, store_name, slug, MAX(updated_at) FROM offer_store_keys GROUP BY external_id);
+
+UPDATE offers SET store_id = stores.id
+    FROM offer_store_keys k JOIN stores ON stores.chain = 'ICA' AND stores.external_id = k.external_id
+    WHERE k.source = 'offers' AND offers.id = k.id;
+UPDATE quarantined_offers SET store_id = stores.id
+    FROM offer_store_keys k JOIN stores ON stores.chain = 'ICA' AND stores.external_id = k.external_id
+    WHERE k.source = 'quarantined_offers' AND quarantined_offers.id = k.id;
+UPDATE scrape_run_stores SET store_id = (
+    SELECT MIN(store_id) FROM offers WHERE offers.store_name = scrape_run_stores.store_name
+);
+
+-- A store that was renamed has its offers twice; keep the latest row of each and
+-- move the history of the others onto it
+CREATE TEMPORARY TABLE duplicate_offers AS
+    SELECT id, keep_id FROM (
+        SELECT id, first_value(id) OVER (PARTITION BY store_id, name, product_url ORDER BY updated_at DESC, id DESC) AS keep_id
+        FROM offers
+        WHERE store_id IS NOT NULL
+    )
+    WHERE id <> keep_id;
+UPDATE offer_observations SET offer_id = d.keep_id FROM duplicate_offers d WHERE offer_observations.offer_id = d.id;
+DELETE FROM offers WHERE id IN (SELECT id FROM duplicate_offers);
+
+DROP TABLE offer_store_keys;
+DROP TABLE duplicate_offers;
+
+DROP INDEX IF EXISTS idx_store_name_product_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_store_product ON offers (store_id, name, product_url);
+CREATE INDEX IF NOT EXISTS idx_offers_store_name ON offers (store_name);
+CREATE INDEX IF NOT EXISTS idx_quarantined_offers_store_id ON quarantined_offers (store_id);
+CREATE INDEX IF NOT EXISTS idx_scrape_run_stores_store_id ON scrape_run_stores (store_id);
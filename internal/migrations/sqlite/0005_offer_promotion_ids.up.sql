@@ -0,0 +1,39 @@
+-- Offers are identified by their store, source, promotion ID and validity period
+-- instead of their name and URL, so a product renamed by ICA updates its offer and
+-- two offers with the same title stay apart. Existing rows carry the promotion ID in
+-- their product URL: https://www.ica.se/erbjudanden/<slug>?id=<promotion ID>&action=details
+ALTER TABLE offers ADD COLUMN source varchar(20);
+ALTER TABLE offers ADD COLUMN promotion_id varchar(100);
+ALTER TABLE quarantined_offers ADD COLUMN source varchar(20);
+ALTER TABLE quarantined_offers ADD COLUMN promotion_id varchar(100);
+
+-- The ID runs from after "?id=" to the next "&" or the end of the URL
+UPDATE offers SET source = 'ica', promotion_id = (
+    SELECT CASE WHEN instr(rest, '&') > 0 THEN substr(rest, 1, instr(rest, '&') - 1) ELSE rest END
+    FROM (SELECT substr(product_url, instr(product_url, '?id=') + 4) AS rest)
+) WHERE instr(product_url, '?id=') > 0;
+UPDATE offers SET source = 'ica' WHERE source IS NULL;
+UPDATE quarantined_offers SET source = 'ica', promotion_id = (
+    SELECT CASE WHEN instr(rest, '&') > 0 THEN substr(rest, 1, instr(rest, '&') - 1) ELSE rest END
+    FROM (SELECT substr(product_url, instr(product_url, '?id=') + 4) AS rest)
+) WHERE instr(product_url, '?id=') > 0;
+UPDATE quarantined_offers SET source = 'ica' WHERE source IS NULL;
+
+-- A renamed product has the same promotion twice; keep the latest row of each and
+-- move the history of the others onto it. Rows without a promotion ID are kept.
+CREATE TEMPORARY TABLE duplicate_promotions AS
+    SELECT id, keep_id FROM (
+        SELECT id, first_value(id) OVER (
+            PARTITION BY store_id, source, promotion_id, valid_from, valid_to
+            ORDER BY updated_at DESC, id DESC
+        ) AS keep_id
+        FROM offers
+        WHERE promotion_id IS NOT NULL
+    )
+    WHERE id <> keep_id;
+UPDATE offer_observations SET offer_id = d.keep_id FROM duplicate_promotions d WHERE offer_observations.offer_id = d.id;
+DELETE FROM offers WHERE id IN (SELECT id FROM duplicate_promotions);
+DROP TABLE duplicate_promotions;
+
+DROP INDEX IF EXISTS idx_offers_store_product;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_promotion ON offers (store_id, source, promotion_id, valid_from, valid_to);
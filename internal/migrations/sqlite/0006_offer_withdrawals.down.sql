@@ -0,0 +1,3 @@
+ALTER TABLE scrape_run_stores DROP COLUMN withdrawn;
+DROP INDEX IF EXISTS idx_offers_withdrawn_at;
+ALTER TABLE offers DROP COLUMN withdrawn_at;
@@ -0,0 +1,5 @@
+-- Offers that a complete scrape of their store no longer found are withdrawn before
+-- the end of their validity period; scrape runs count them per store.
+ALTER TABLE offers ADD COLUMN withdrawn_at datetime;
+CREATE INDEX IF NOT EXISTS idx_offers_withdrawn_at ON offers (withdrawn_at);
+ALTER TABLE scrape_run_stores ADD COLUMN withdrawn bigint;
@@ -0,0 +1,16 @@
+ALTER TABLE product_categories DROP COLUMN confidence;
+ALTER TABLE product_categories DROP COLUMN source;
+
+ALTER TABLE offers ADD COLUMN categories text;
+UPDATE offers SET categories = (
+    SELECT json_group_array(key) FROM (
+        SELECT categories.key
+        FROM offer_categories JOIN categories ON categories.id = offer_categories.category_id
+        WHERE offer_categories.offer_id = offers.id
+        ORDER BY categories.key
+    )
+)
+WHERE id IN (SELECT offer_id FROM offer_categories);
+
+DROP TABLE IF EXISTS offer_categories;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,41 @@
+-- Categories move from the JSON column of offers into their own table, linked to
+-- the offers through offer_categories. Every assignment records who made it and how
+-- sure it was; the existing ones predate that and are marked legacy. The parents of
+-- the categories are filled in from the taxonomy when the parser or the API starts.
+CREATE TABLE IF NOT EXISTS categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    key varchar(100),
+    name varchar(255),
+    parent_id integer REFERENCES categories (id) ON DELETE SET NULL,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_key ON categories (key);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+CREATE TABLE IF NOT EXISTS offer_categories (
+    offer_id integer NOT NULL REFERENCES offers (id) ON DELETE CASCADE,
+    category_id integer NOT NULL REFERENCES categories (id) ON DELETE CASCADE,
+    source varchar(20) NOT NULL,
+    confidence real,
+    created_at datetime,
+    PRIMARY KEY (offer_id, category_id)
+);
+CREATE INDEX IF NOT EXISTS idx_offer_categories_category_id ON offer_categories (category_id);
+
+INSERT OR IGNORE INTO categories (key, name, created_at, updated_at)
+    SELECT DISTINCT c.value, c.value, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+    FROM offers, json_each(offers.categories) AS c
+    WHERE offers.categories LIKE '[%' AND c.value <> '';
+
+INSERT OR IGNORE INTO offer_categories (offer_id, category_id, source, created_at)
+    SELECT DISTINCT offers.id, categories.id, 'legacy', CURRENT_TIMESTAMP
+    FROM offers, json_each(offers.categories) AS c
+    JOIN categories ON categories.key = c.value
+    WHERE offers.categories LIKE '[%';
+
+ALTER TABLE offers DROP COLUMN categories;
+
+-- The category cache remembers who categorized a product as well
+ALTER TABLE product_categories ADD COLUMN source varchar(20);
+ALTER TABLE product_categories ADD COLUMN confidence real;
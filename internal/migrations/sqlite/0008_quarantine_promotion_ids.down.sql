@@ -0,0 +1,15 @@
+-- Quarantined cards of the same product in several weeks share a name and URL; only
+-- the latest row of each is kept so the old unique index can be built again.
+DELETE FROM quarantined_offers WHERE id IN (
+    SELECT id FROM (
+        SELECT id, first_value(id) OVER (
+            PARTITION BY store_name, name, product_url
+            ORDER BY updated_at DESC, id DESC
+        ) AS keep_id
+        FROM quarantined_offers
+    )
+    WHERE id <> keep_id
+);
+
+DROP INDEX IF EXISTS idx_quarantine_promotion;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantine_store_product ON quarantined_offers (store_name, name, product_url);
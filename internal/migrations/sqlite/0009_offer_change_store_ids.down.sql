@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_offer_changes_store_id;
+ALTER TABLE offer_changes DROP COLUMN store_id;
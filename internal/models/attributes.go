@@ -0,0 +1,35 @@
+package models
+
+// Certification labels an offer can carry.
+const (
+	LabelOrganic   = "organic"
+	LabelKRAV      = "krav"
+	LabelFairtrade = "fairtrade"
+)
+
+// Dietary tags an offer can carry.
+const (
+	DietVegan       = "vegan"
+	DietLactoseFree = "lactose_free"
+	DietGlutenFree  = "gluten_free"
+)
+
+// OfferAttributes are the structured attributes extracted from a product name and card text.
+type OfferAttributes struct {
+	Brand         string   `json:"brand"`
+	NetQuantity   float64  `json:"netQuantity"`
+	NetUnit       string   `json:"netUnit"`
+	Labels        []string `json:"labels"`
+	SwedishOrigin bool     `json:"swedishOrigin"`
+	DietaryTags   []string `json:"dietaryTags"`
+}
+
+// Apply copies the attributes to the offer.
+func (a OfferAttributes) Apply(offer *Offer) {
+	offer.Brand = a.Brand
+	offer.NetQuantity = a.NetQuantity
+	offer.NetUnit = a.NetUnit
+	offer.Labels = a.Labels
+	offer.SwedishOrigin = a.SwedishOrigin
+	offer.DietaryTags = a.DietaryTags
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+)
+
+// Sources of a category assignment.
+const (
+	CategorySourceAI     = "ai"
+	CategorySourceRule   = "rule"
+	CategorySourceManual = "manual"
+	// CategorySourceLegacy marks assignments whose source was not recorded, like the
+	// ones made before sources were
+	CategorySourceLegacy = "legacy"
+)
+
+// Category is a category offers can be assigned to. With a taxonomy the key is the
+// taxonomy ID and the parent follows the taxonomy; without one the key is the label
+// the categorizer returned and categories have no parent.
+//
+// swagger:model Category
+type Category struct {
+	ID  uint   `json:"id" gorm:"primaryKey"`
+	Key string `json:"key" gorm:"type:varchar(100);uniqueIndex"`
+	// the Swedish label
+	Name string `json:"name" gorm:"type:varchar(255)"`
+	// the parent category, if any
+	ParentID  *uint     `json:"parentId,omitempty" gorm:"index"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OfferCategory assigns a category to an offer, recording who assigned it.
+type OfferCategory struct {
+	OfferID    uint `gorm:"primaryKey"`
+	CategoryID uint `gorm:"primaryKey;index"`
+	// ai, rule or manual
+	Source string `gorm:"type:varchar(20);not null"`
+	// how sure the categorizer was, between 0 and 1; nil when it did not say
+	Confidence *float64 `gorm:"type:numeric(4, 3)"`
+	CreatedAt  time.Time
+}
+
+// CategoryCount is a category with the number of offers advertised in it.
+//
+// swagger:model CategoryCount
+type CategoryCount struct {
+	Category
+	// offers in the category itself
+	Offers int64 `json:"offers"`
+	// offers in the category or one of its subcategories, each counted once
+	TotalOffers int64 `json:"totalOffers"`
+}
+
+// ProductCategory caches the categories assigned to a product, keyed by its
+// normalized name, so products that reappear week after week are categorized once.
+type ProductCategory struct {
+	NormalizedName string      `json:"normalizedName" gorm:"type:varchar(255);primaryKey"`
+	Categories     StringArray `json:"categories" gorm:"type:text[]"`
+	// who categorized the product and how sure it was
+	Source     string    `json:"source" gorm:"type:varchar(20)"`
+	Confidence *float64  `json:"confidence,omitempty" gorm:"type:numeric(4, 3)"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt" gorm:"index"`
+}
+
+// CategoryOverride is a manual correction of a product's categories. It always wins
+// over the categorizer. The key is "product:<id>" for a canonical product or
+// "name:<normalized name>" for a product name.
+//
+// swagger:model CategoryOverride
+type CategoryOverride struct {
+	ID  uint   `json:"id" gorm:"primaryKey"`
+	Key string `json:"key" gorm:"type:varchar(300);uniqueIndex"`
+	// the canonical product the override applies to, if keyed by product
+	ProductID *uint `json:"productId,omitempty"`
+	// the product name as entered, used as an example for later categorization runs
+	ProductName string `json:"productName" gorm:"type:varchar(255)"`
+	// the categories the product gets
+	Categories StringArray `json:"categories" gorm:"type:text[]"`
+	// why the categorizer was wrong
+	Reason    string    `json:"reason,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"index"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of offer change events.
+const (
+	OfferChangeNew              = "new_offer"
+	OfferChangeEnded            = "offer_ended"
+	OfferChangePrice            = "price_changed"
+	OfferChangeDiscountImproved = "discount_improved"
+	OfferChangeDiscountWorsened = "discount_worsened"
+	OfferChangeType             = "type_changed"
+)
+
+// OfferChange is an event describing how a store's offers changed between two scrapes.
+//
+// swagger:model OfferChange
+type OfferChange struct {
+	gorm.Model
+
+	// the store the change belongs to
+	StoreID *uint `json:"storeId,omitempty" gorm:"index"`
+	// the name of the store when the change was detected
+	StoreName string `json:"storeName" gorm:"type:varchar(100);index"`
+	// the name of the product
+	Name string `json:"name" gorm:"type:varchar(255)"`
+	// the url of the offer the change refers to (the new one, or the ended one)
+	ProductURL string `json:"productURL" gorm:"type:varchar(2048)"`
+	// the canonical product, if it was matched
+	ProductID *uint `json:"productId" gorm:"index"`
+	// what changed: new_offer, offer_ended, price_changed, discount_improved, discount_worsened or type_changed
+	Kind string `json:"kind" gorm:"type:varchar(30);index"`
+
+	OldType               string  `json:"oldType,omitempty" gorm:"type:varchar(50)"`
+	NewType               string  `json:"newType,omitempty" gorm:"type:varchar(50)"`
+	OldPrice              float64 `json:"oldPrice,omitempty" gorm:"type:numeric(10, 2)"`
+	NewPrice              float64 `json:"newPrice,omitempty" gorm:"type:numeric(10, 2)"`
+	OldDiscountPercentage float64 `json:"oldDiscountPercentage,omitempty" gorm:"type:numeric(5, 2)"`
+	NewDiscountPercentage float64 `json:"newDiscountPercentage,omitempty" gorm:"type:numeric(5, 2)"`
+
+	// when the change was detected
+	DetectedAt time.Time `json:"detectedAt" gorm:"index"`
+}
+
+// OfferChangeFilter selects change events. Zero values are ignored.
+type OfferChangeFilter struct {
+	StoreID   uint
+	StoreName string
+	Kind      string
+	Since     time.Time
+	Limit     int
+}
@@ -1,15 +1,21 @@
 package models
 
 import (
+	"context"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"grocery_scraper/internal/database"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// StringArray is a custom type to handle []string mapping to Postgres text[]
+// StringArray is a custom type to handle []string mapping to Postgres text[].
+// SQLite has no arrays, so there the list is stored as a JSON array in a text column.
 type StringArray []string
 
 // Scan implements the sql.Scanner interface
@@ -30,31 +36,76 @@ func (a *StringArray) Scan(value interface{}) error {
 		return errors.New("failed to scan StringArray: value is not string or []byte")
 	}
 
-	// Basic parsing for Postgres array format: "{a,b,c}"
-	// This is a simplified parser. For robust parsing of complex strings with commas/quotes,
-	// a full parser is needed. However, for simple categories, this might suffice.
-	// Alternatively, we can use JSON serialization if we change the column type to jsonb,
-	// but the schema is text[].
-
-	// Trim curly braces
-	strVal = strings.Trim(strVal, "{}")
-	if strVal == "" {
-		*a = []string{}
+	// SQLite stores the list as JSON
+	if strings.HasPrefix(strVal, "[") {
+		var parts []string
+		if err := json.Unmarshal([]byte(strVal), &parts); err != nil {
+			return fmt.Errorf("failed to scan StringArray: %w", err)
+		}
+		*a = StringArray(parts)
 		return nil
 	}
 
-	// Split by comma (Note: this fails if categories contain commas)
-	// A more robust way without lib/pq is tricky.
-	// Let's try to handle quoted strings if possible, but for now simple split.
-	parts := strings.Split(strVal, ",")
-	for i, part := range parts {
-		// Trim quotes if present (Postgres adds quotes if needed)
-		parts[i] = strings.Trim(part, "\"")
+	parts, err := parseTextArray(strVal)
+	if err != nil {
+		return fmt.Errorf("failed to scan StringArray: %w", err)
 	}
 	*a = StringArray(parts)
 	return nil
 }
 
+// parseTextArray parses a one-dimensional Postgres text[] literal such as
+// {a,"b, c","d \"e\""}. Quoted elements may contain commas, quotes and backslashes.
+// NULL elements are left out, a list of strings has no place for them; a quoted
+// "NULL" is the string.
+func parseTextArray(literal string) ([]string, error) {
+	if len(literal) < 2 || literal[0] != '{' || literal[len(literal)-1] != '}' {
+		return nil, fmt.Errorf("%q is not an array literal", literal)
+	}
+	body := literal[1 : len(literal)-1]
+	parts := []string{}
+	if body == "" {
+		return parts, nil
+	}
+	var element strings.Builder
+	quoted, escaped, wasQuoted := false, false, false
+	for _, r := range body {
+		switch {
+		case escaped:
+			element.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case r == ',' && !quoted:
+			parts = appendArrayElement(parts, element.String(), wasQuoted)
+			element.Reset()
+			wasQuoted = false
+		default:
+			element.WriteRune(r)
+		}
+	}
+	if quoted || escaped {
+		return nil, fmt.Errorf("%q has an unterminated element", literal)
+	}
+	return appendArrayElement(parts, element.String(), wasQuoted), nil
+}
+
+// appendArrayElement appends an element of an array literal to parts. Unquoted
+// elements lose their surrounding whitespace, and an unquoted NULL is skipped.
+func appendArrayElement(parts []string, element string, quoted bool) []string {
+	if quoted {
+		return append(parts, element)
+	}
+	element = strings.TrimSpace(element)
+	if strings.EqualFold(element, "NULL") {
+		return parts
+	}
+	return append(parts, element)
+}
+
 // Value implements the driver.Valuer interface
 func (a StringArray) Value() (driver.Value, error) {
 	if len(a) == 0 {
@@ -75,31 +126,54 @@ func (a StringArray) Value() (driver.Value, error) {
 	return "{" + strings.Join(parts, ",") + "}", nil
 }
 
+// GormValue writes the array in the format of the database: a text[] literal for
+// Postgres, a JSON array for SQLite.
+func (a StringArray) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	if database.Dialect(db) != database.SQLite || len(a) == 0 {
+		value, _ := a.Value()
+		return clause.Expr{SQL: "?", Vars: []interface{}{value}}
+	}
+	data, _ := json.Marshal([]string(a))
+	return clause.Expr{SQL: "?", Vars: []interface{}{string(data)}}
+}
+
 // Store struct holds the display name and the unique URL slug for the store.
 type Store struct {
 	Name    string `mapstructure:"name"`
 	URLSlug string `mapstructure:"url_slug"`
+	// ID is the store's row in the stores table, set when the parser registers the store
+	ID uint `mapstructure:"-"`
 }
 
-// Offer represents an offer for a product.
+// OfferSourceICA is the source of offers scraped from the ICA offers pages.
+const OfferSourceICA = "ica"
+
+// Offer represents an offer for a product. An offer is identified by its store, its
+// source, the source's promotion ID and its validity period.
 //
 // swagger:model Offer
 type Offer struct {
 	// GORM will automatically add ID, CreatedAt, UpdatedAt, DeletedAt
 	gorm.Model
 
-	// the name of the store
+	// the store the offer belongs to
+	StoreID *uint `json:"storeId,omitempty" gorm:"uniqueIndex:idx_offers_promotion"`
+	// where the offer was scraped from, e.g. ica
+	Source string `json:"source" gorm:"type:varchar(20);uniqueIndex:idx_offers_promotion"`
+	// the source's ID of the promotion, e.g. the data-promotion-id of an ICA offer card
+	PromotionID string `json:"promotionId" gorm:"type:varchar(100);uniqueIndex:idx_offers_promotion"`
+	// the name of the store when the offer was scraped
 	//
 	// required: true
-	StoreName string `json:"storeName" gorm:"type:varchar(100);uniqueIndex:idx_store_name_product_name"`
+	StoreName string `json:"storeName" gorm:"type:varchar(100);index"`
 	// the name of the product
 	//
 	// required: true
-	Name string `json:"name" gorm:"type:varchar(255);uniqueIndex:idx_store_name_product_name"`
+	Name string `json:"name" gorm:"type:varchar(255)"`
 	// the url of the product
 	//
 	// required: true
-	ProductURL string `json:"productURL" gorm:"type:varchar(2048);uniqueIndex:idx_store_name_product_name"`
+	ProductURL string `json:"productURL" gorm:"type:varchar(2048)"`
 	// the type of the offer
 	//
 	// required: true
@@ -121,10 +195,52 @@ type Offer struct {
 	// the discount percentage of the product
 	DiscountPercentage float64 `json:"discountPercentage" gorm:"type:numeric(5, 2)"`
 
-	// Categories for the product
-	Categories StringArray `json:"categories" gorm:"type:text[]"`
+	// Categories for the product, stored in offer_categories
+	Categories []string `json:"categories" gorm:"-"`
+	// who assigned the categories and how sure it was, saved with them
+	CategorySource     string   `json:"-" gorm:"-"`
+	CategoryConfidence *float64 `json:"-" gorm:"-"`
+
+	// Attributes extracted from the product name and card text
+	// the brand of the product
+	Brand string `json:"brand,omitempty" gorm:"type:varchar(100);index"`
+	// the net quantity in NetUnit (g, ml or st)
+	NetQuantity float64 `json:"netQuantity,omitempty" gorm:"type:numeric(10, 3)"`
+	NetUnit     string  `json:"netUnit,omitempty" gorm:"type:varchar(10)"`
+	// certification labels: organic, krav, fairtrade
+	Labels StringArray `json:"labels" gorm:"type:text[]"`
+	// whether the product is produced in Sweden
+	SwedishOrigin bool `json:"swedishOrigin" gorm:"index"`
+	// dietary tags: vegan, lactose_free, gluten_free
+	DietaryTags StringArray `json:"dietaryTags" gorm:"type:text[]"`
+
+	// the canonical product shared with other stores and weeks
+	ProductID *uint `json:"productId" gorm:"index"`
+	// the identity key the product was matched on
+	ProductKey string `json:"-" gorm:"type:varchar(512);index"`
+
+	// the scrape run that last saw the offer
+	RunID *uint `json:"runId,omitempty" gorm:"index"`
+	// when a complete scrape of the store no longer found the offer; a withdrawn
+	// offer is no longer advertised, even though its validity period has not ended
+	WithdrawnAt *time.Time `json:"withdrawnAt,omitempty" gorm:"index"`
 
 	// Validity period of the offer
-	ValidFrom time.Time `json:"validFrom" gorm:"index"`
-	ValidTo   time.Time `json:"validTo" gorm:"index"`
+	ValidFrom time.Time `json:"validFrom" gorm:"index;uniqueIndex:idx_offers_promotion"`
+	ValidTo   time.Time `json:"validTo" gorm:"index;uniqueIndex:idx_offers_promotion"`
+}
+
+// ValidityPeriod is the time from which until which an offer is advertised.
+type ValidityPeriod struct {
+	From, To time.Time
+}
+
+// Period returns the validity period of the offer.
+func (o Offer) Period() ValidityPeriod {
+	return ValidityPeriod{From: o.ValidFrom, To: o.ValidTo}
+}
+
+// Equal reports whether both periods start and end at the same time.
+func (p ValidityPeriod) Equal(other ValidityPeriod) bool {
+	return p.From.Equal(other.From) && p.To.Equal(other.To)
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTextArray(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    []string
+		wantErr bool
+	}{
+		{literal: "{}", want: []string{}},
+		{literal: "{a,b,c}", want: []string{"a", "b", "c"}},
+		{literal: "{ a , b }", want: []string{"a", "b"}},
+		{literal: `{"b, c",d}`, want: []string{"b, c", "d"}},
+		{literal: `{"d \"e\""}`, want: []string{`d "e"`}},
+		{literal: `{"back\\slash"}`, want: []string{`back\slash`}},
+		{literal: `{"{braces}"}`, want: []string{"{braces}"}},
+		{literal: `{" padded "}`, want: []string{" padded "}},
+		{literal: `{""}`, want: []string{""}},
+		{literal: "{a,NULL,b}", want: []string{"a", "b"}},
+		{literal: "{null}", want: []string{}},
+		{literal: `{"NULL"}`, want: []string{"NULL"}},
+		{literal: "{nullable}", want: []string{"nullable"}},
+		{literal: "{mejeri.ost,Frukt & grönt}", want: []string{"mejeri.ost", "Frukt & grönt"}},
+		{literal: "a,b", wantErr: true},
+		{literal: "{", wantErr: true},
+		{literal: `{"unterminated}`, wantErr: true},
+		{literal: `{trailing\}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.literal, func(t *testing.T) {
+			got, err := parseTextArray(tt.literal)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTextArray(%q) = %q, want an error", tt.literal, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) || got == nil {
+				t.Errorf("parseTextArray(%q) = %q, want %q", tt.literal, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringArrayRoundTrip(t *testing.T) {
+	for _, array := range []StringArray{{"a"}, {"b, c", `d "e"`, `back\slash`, "NULL", ""}} {
+		value, err := array.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var scanned StringArray
+		if err := scanned.Scan(value); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(scanned, array) {
+			t.Errorf("%q was scanned back as %q", array, scanned)
+		}
+	}
+
+	var scanned StringArray
+	if err := scanned.Scan([]byte(`["vegan","gluten_free"]`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (StringArray{"vegan", "gluten_free"}); !slices.Equal(scanned, want) {
+		t.Errorf("the SQLite JSON array was scanned as %q, want %q", scanned, want)
+	}
+}
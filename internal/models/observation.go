@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// OfferObservation is what an offer looked like in one scrape. The offers table only
+// holds the latest state; observations are appended on every scrape and never
+// updated, so they form the price history of an offer and its product.
+//
+// swagger:model OfferObservation
+type OfferObservation struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// the current-state offer row this observation belongs to
+	OfferID uint `json:"offerId" gorm:"not null;index:idx_offer_observations_offer,priority:1"`
+	// the canonical product, if the offer was matched
+	ProductID *uint `json:"productId,omitempty" gorm:"index:idx_offer_observations_product,priority:1"`
+	// the scrape run that made the observation
+	RunID *uint `json:"runId,omitempty" gorm:"index"`
+	// the name of the store
+	StoreName string `json:"storeName" gorm:"type:varchar(100)"`
+	// the name of the product
+	Name string `json:"name" gorm:"type:varchar(255)"`
+
+	Type               string  `json:"type" gorm:"type:varchar(50)"`
+	OriginalPrice      float64 `json:"originalPrice" gorm:"type:numeric(10, 2)"`
+	SalePrice          float64 `json:"salePrice" gorm:"type:numeric(10, 2)"`
+	SaleQuantity       int     `json:"saleQuantity"`
+	SalePriceTotal     float64 `json:"salePriceTotal" gorm:"type:numeric(10, 2)"`
+	Discount           int     `json:"discount"`
+	DiscountPercentage float64 `json:"discountPercentage" gorm:"type:numeric(5, 2)"`
+
+	ValidFrom time.Time `json:"validFrom"`
+	ValidTo   time.Time `json:"validTo"`
+	// when the scrape saw the offer
+	ObservedAt time.Time `json:"observedAt" gorm:"not null;index;index:idx_offer_observations_offer,priority:2;index:idx_offer_observations_product,priority:2"`
+}
+
+// NewOfferObservation records the current state of a saved offer.
+func NewOfferObservation(offer Offer, observedAt time.Time) OfferObservation {
+	return OfferObservation{
+		OfferID:            offer.ID,
+		ProductID:          offer.ProductID,
+		RunID:              offer.RunID,
+		StoreName:          offer.StoreName,
+		Name:               offer.Name,
+		Type:               offer.Type,
+		OriginalPrice:      offer.OriginalPrice,
+		SalePrice:          offer.SalePrice,
+		SaleQuantity:       offer.SaleQuantity,
+		SalePriceTotal:     offer.SalePriceTotal,
+		Discount:           offer.Discount,
+		DiscountPercentage: offer.DiscountPercentage,
+		ValidFrom:          offer.ValidFrom,
+		ValidTo:            offer.ValidTo,
+		ObservedAt:         observedAt,
+	}
+}
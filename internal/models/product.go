@@ -0,0 +1,56 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Product is a canonical product shared by offers across stores and weeks.
+type Product struct {
+	gorm.Model
+
+	// normalized product name without brand and size
+	CanonicalName string `json:"canonicalName" gorm:"type:varchar(255);index"`
+	// the brand, when it could be extracted
+	Brand string `json:"brand" gorm:"type:varchar(100)"`
+	// net size in the base unit (g, ml or st)
+	Size float64 `json:"size" gorm:"type:numeric(10, 2)"`
+	Unit string  `json:"unit" gorm:"type:varchar(10)"`
+	// the EAN/GTIN, when known
+	EAN string `json:"ean" gorm:"type:varchar(14);index"`
+}
+
+// ProductKey maps an identity key computed from an offer to its product.
+// Keys are created automatically the first time an identity is seen.
+type ProductKey struct {
+	Key       string `gorm:"type:varchar(512);primaryKey"`
+	ProductID uint   `gorm:"index;not null"`
+}
+
+// ProductOverride is a manual merge or split decision. An override always wins
+// over the automatically created ProductKey for the same identity key.
+type ProductOverride struct {
+	gorm.Model
+
+	Key       string `json:"key" gorm:"type:varchar(512);uniqueIndex"`
+	ProductID uint   `json:"productId" gorm:"index;not null"`
+	// merge or split
+	Action string `json:"action" gorm:"type:varchar(10)"`
+	Reason string `json:"reason" gorm:"type:text"`
+}
+
+// Product override actions.
+const (
+	ProductOverrideMerge = "merge"
+	ProductOverrideSplit = "split"
+)
+
+// ProductIdentity is what the matcher extracted from an offer. Key decides which
+// product the offer belongs to; the other fields describe a newly created product.
+type ProductIdentity struct {
+	Key           string
+	CanonicalName string
+	Brand         string
+	Size          float64
+	Unit          string
+	EAN           string
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Quarantine statuses for offers that failed validation.
+const (
+	QuarantineStatusPending   = "pending"
+	QuarantineStatusReleased  = "released"
+	QuarantineStatusDiscarded = "discarded"
+)
+
+// QuarantinedOffer holds an offer that failed validation together with the raw
+// card text it was parsed from and the rule that rejected it. Rows stay here
+// until they are fixed and released into the offers table, or discarded.
+type QuarantinedOffer struct {
+	gorm.Model
+
+	// The offer's identity, see Offer
+	StoreID     *uint  `json:"storeId,omitempty" gorm:"index;uniqueIndex:idx_quarantine_promotion"`
+	Source      string `json:"source" gorm:"type:varchar(20);uniqueIndex:idx_quarantine_promotion"`
+	PromotionID string `json:"promotionId" gorm:"type:varchar(100);uniqueIndex:idx_quarantine_promotion"`
+
+	StoreName  string `json:"storeName" gorm:"type:varchar(100)"`
+	Name       string `json:"name" gorm:"type:varchar(255)"`
+	ProductURL string `json:"productURL" gorm:"type:varchar(2048)"`
+	Type       string `json:"type" gorm:"type:varchar(50)"`
+
+	OriginalPrice      float64 `json:"originalPrice" gorm:"type:numeric(10, 2)"`
+	SalePrice          float64 `json:"salePrice" gorm:"type:numeric(10, 2)"`
+	SaleQuantity       int     `json:"saleQuantity"`
+	SalePriceTotal     float64 `json:"salePriceTotal" gorm:"type:numeric(10, 2)"`
+	Discount           int     `json:"discount"`
+	DiscountPercentage float64 `json:"discountPercentage" gorm:"type:numeric(5, 2)"`
+
+	ValidFrom time.Time `json:"validFrom" gorm:"uniqueIndex:idx_quarantine_promotion"`
+	ValidTo   time.Time `json:"validTo" gorm:"uniqueIndex:idx_quarantine_promotion"`
+
+	// The raw card text the offer was parsed from
+	RawOriginalText string `json:"rawOriginalText" gorm:"type:text"`
+	RawDealText     string `json:"rawDealText" gorm:"type:text"`
+
+	// The validation rule that failed and why
+	Rule   string `json:"rule" gorm:"type:varchar(50)"`
+	Reason string `json:"reason" gorm:"type:text"`
+
+	Status     string     `json:"status" gorm:"type:varchar(20);index;default:pending"`
+	ReleasedAt *time.Time `json:"releasedAt"`
+}
+
+// NewQuarantinedOffer copies the parsed offer fields into a pending quarantine row.
+func NewQuarantinedOffer(offer Offer, rawOriginalText, rawDealText, rule, reason string) QuarantinedOffer {
+	return QuarantinedOffer{
+		StoreID:            offer.StoreID,
+		Source:             offer.Source,
+		PromotionID:        offer.PromotionID,
+		StoreName:          offer.StoreName,
+		Name:               offer.Name,
+		ProductURL:         offer.ProductURL,
+		Type:               offer.Type,
+		OriginalPrice:      offer.OriginalPrice,
+		SalePrice:          offer.SalePrice,
+		SaleQuantity:       offer.SaleQuantity,
+		SalePriceTotal:     offer.SalePriceTotal,
+		Discount:           offer.Discount,
+		DiscountPercentage: offer.DiscountPercentage,
+		ValidFrom:          offer.ValidFrom,
+		ValidTo:            offer.ValidTo,
+		RawOriginalText:    rawOriginalText,
+		RawDealText:        rawDealText,
+		Rule:               rule,
+		Reason:             reason,
+		Status:             QuarantineStatusPending,
+	}
+}
+
+// ToOffer converts the (possibly fixed) quarantined row back into an Offer.
+func (q QuarantinedOffer) ToOffer() Offer {
+	return Offer{
+		StoreID:            q.StoreID,
+		Source:             q.Source,
+		PromotionID:        q.PromotionID,
+		StoreName:          q.StoreName,
+		Name:               q.Name,
+		ProductURL:         q.ProductURL,
+		Type:               q.Type,
+		OriginalPrice:      q.OriginalPrice,
+		SalePrice:          q.SalePrice,
+		SaleQuantity:       q.SaleQuantity,
+		SalePriceTotal:     q.SalePriceTotal,
+		Discount:           q.Discount,
+		DiscountPercentage: q.DiscountPercentage,
+		ValidFrom:          q.ValidFrom,
+		ValidTo:            q.ValidTo,
+	}
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numeric fields offers can be sorted on, named as in the JSON of an offer.
+const (
+	OfferSortID                 = "id"
+	OfferSortSalePrice          = "salePrice"
+	OfferSortOriginalPrice      = "originalPrice"
+	OfferSortSalePriceTotal     = "salePriceTotal"
+	OfferSortSaleQuantity       = "saleQuantity"
+	OfferSortDiscount           = "discount"
+	OfferSortDiscountPercentage = "discountPercentage"
+	OfferSortNetQuantity        = "netQuantity"
+)
+
+// OfferQuery selects, sorts and pages offers. Empty fields do not filter; list
+// fields match offers with any of their values unless noted otherwise.
+type OfferQuery struct {
+	// store names
+	Stores []string
+	// store IDs in the stores table
+	StoreIDs []uint
+	// the chain of the stores, e.g. ICA, as recorded in the stores table
+	Chain string
+	// category keys; the offer needs at least one of them or of their subcategories
+	Categories []string
+	// offer types, e.g. "percentage" or "single"
+	Types []string
+	// range of the discount percentage, inclusive
+	MinDiscount *float64
+	MaxDiscount *float64
+	// range of the sale price, inclusive
+	MinPrice *float64
+	MaxPrice *float64
+	// ValidAt selects the offers valid at that time; zero means now
+	ValidAt time.Time
+	// Text is searched for in the product name and brand, in any Swedish inflection
+	// and allowing for typos
+	Text string
+
+	Brand string
+	// Labels and DietaryTags must all be present on the offer
+	Labels        []string
+	DietaryTags   []string
+	SwedishOrigin *bool
+
+	// Sort is one of the OfferSort fields; ties are broken by ID. Empty sorts by ID.
+	Sort       string
+	Descending bool
+	// Limit is the page size; 0 returns every match
+	Limit int
+	// After continues after the last offer of the previous page
+	After *OfferCursor
+}
+
+// OfferPage is one page of a query result.
+type OfferPage struct {
+	Offers []Offer
+	// Next continues the query after this page; nil on the last page
+	Next *OfferCursor
+}
+
+// OfferSearchResult is an offer found by a text search.
+//
+// swagger:model OfferSearchResult
+type OfferSearchResult struct {
+	Offer
+	// how well the offer matches, higher is better
+	Rank float64 `json:"rank"`
+	// the product name with the matched words wrapped in <mark></mark>
+	Highlight string `json:"highlight"`
+}
+
+// OfferCursor marks the position of the last offer of a page: its sort value and ID.
+// It is only valid for the sort it was created with.
+type OfferCursor struct {
+	Sort       string
+	Descending bool
+	Value      float64
+	ID         uint
+}
+
+var (
+	// ErrUnknownSort is returned for a sort field that is not one of the OfferSort fields.
+	ErrUnknownSort = errors.New("unknown sort field")
+	// ErrInvalidCursor is returned for cursors that cannot be decoded or belong to another sort.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// SortValue returns the value of a sortable field of the offer.
+func (o Offer) SortValue(field string) float64 {
+	switch field {
+	case OfferSortSalePrice:
+		return o.SalePrice
+	case OfferSortOriginalPrice:
+		return o.OriginalPrice
+	case OfferSortSalePriceTotal:
+		return o.SalePriceTotal
+	case OfferSortSaleQuantity:
+		return float64(o.SaleQuantity)
+	case OfferSortDiscount:
+		return float64(o.Discount)
+	case OfferSortDiscountPercentage:
+		return o.DiscountPercentage
+	case OfferSortNetQuantity:
+		return o.NetQuantity
+	default:
+		return float64(o.ID)
+	}
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c OfferCursor) String() string {
+	raw := fmt.Sprintf("%s|%t|%s|%d", c.Sort, c.Descending, strconv.FormatFloat(c.Value, 'g', -1, 64), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseOfferCursor decodes a token created by OfferCursor.String.
+func ParseOfferCursor(token string) (*OfferCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return nil, ErrInvalidCursor
+	}
+	descending, err1 := strconv.ParseBool(parts[1])
+	value, err2 := strconv.ParseFloat(parts[2], 64)
+	id, err3 := strconv.ParseUint(parts[3], 10, 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &OfferCursor{Sort: parts[0], Descending: descending, Value: value, ID: uint(id)}, nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Statuses of scrape runs and of the stores in a run.
+const (
+	ScrapeRunRunning   = "running"
+	ScrapeRunSucceeded = "succeeded"
+	// ScrapeRunPartial is a run in which some stores failed
+	ScrapeRunPartial = "partial"
+	ScrapeRunFailed  = "failed"
+)
+
+// ScrapeRun is one invocation of the parser.
+//
+// swagger:model ScrapeRun
+type ScrapeRun struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	StartedAt  time.Time  `json:"startedAt" gorm:"not null;index"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// running, succeeded, partial or failed
+	Status string `json:"status" gorm:"type:varchar(20);not null;index"`
+	// hash of the configuration the run used, without secrets
+	ConfigHash string `json:"configHash" gorm:"type:varchar(64)"`
+	// the version of the parser binary
+	Version string `json:"version" gorm:"type:varchar(100)"`
+	// why the run failed as a whole, e.g. a failing run stage
+	Error string `json:"error,omitempty" gorm:"type:text"`
+	// the outcome of every store
+	Stores []ScrapeRunStore `json:"stores,omitempty" gorm:"foreignKey:RunID"`
+}
+
+// ScrapeRunStore is the outcome of one store in a scrape run.
+//
+// swagger:model ScrapeRunStore
+type ScrapeRunStore struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	RunID     uint   `json:"runId" gorm:"not null;index"`
+	StoreID   *uint  `json:"storeId,omitempty" gorm:"index"`
+	StoreName string `json:"storeName" gorm:"type:varchar(100);not null;index:idx_scrape_run_stores_store,priority:1"`
+	// succeeded or failed
+	Status string `json:"status" gorm:"type:varchar(20);not null;index:idx_scrape_run_stores_store,priority:2"`
+
+	// offer cards found on the page
+	Fetched int `json:"fetched"`
+	// offers that made it through the pipeline
+	Parsed int `json:"parsed"`
+	// offers dropped on the way, e.g. quarantined by validation
+	Skipped  int `json:"skipped"`
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	// offers of the store no longer on its page; only complete scrapes withdraw offers
+	Withdrawn int `json:"withdrawn"`
+	// products categorized and products the categorizer failed on
+	Categorized          int `json:"categorized"`
+	CategorizationFailed int `json:"categorizationFailed"`
+
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt" gorm:"index:idx_scrape_run_stores_store,priority:3"`
+	// DurationMS is the time spent on the store, in milliseconds
+	DurationMS int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty" gorm:"type:text"`
+}
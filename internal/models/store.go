@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store chains and profiles known to the store catalogue.
+const (
+	ChainICA = "ICA"
+
+	StoreProfileMaxi        = "Maxi"
+	StoreProfileKvantum     = "Kvantum"
+	StoreProfileSupermarket = "Supermarket"
+	StoreProfileNara        = "Nära"
+)
+
+// OpeningHours holds the regular opening hours of a store, one entry per day.
+// It is stored as a JSON document.
+type OpeningHours []DailyHours
+
+// DailyHours are the opening hours for a single weekday, e.g. {"day": "mon", "opens": "07:00", "closes": "22:00"}.
+type DailyHours struct {
+	Day    string `json:"day"`
+	Opens  string `json:"opens"`
+	Closes string `json:"closes"`
+}
+
+// Scan implements the sql.Scanner interface
+func (h *OpeningHours) Scan(value interface{}) error {
+	if value == nil {
+		*h = nil
+		return nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	default:
+		return errors.New("failed to scan OpeningHours: value is not string or []byte")
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (h OpeningHours) Value() (driver.Value, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// StoreInfo is the catalogue entry of a physical store, identified by its chain
+// and the chain's own store ID.
+//
+// swagger:model StoreInfo
+type StoreInfo struct {
+	gorm.Model
+
+	// the chain the store belongs to, e.g. ICA
+	Chain string `json:"chain" gorm:"type:varchar(20);uniqueIndex:idx_store_chain_external_id"`
+	// the chain's own store ID
+	ExternalID string `json:"externalId" gorm:"type:varchar(50);uniqueIndex:idx_store_chain_external_id"`
+	// the display name of the store
+	Name string `json:"name" gorm:"type:varchar(100)"`
+	// the slug of the store's offers page
+	URLSlug string `json:"urlSlug" gorm:"type:varchar(255)"`
+	// the store profile, e.g. Maxi, Kvantum, Supermarket or Nära
+	Profile string `json:"profile" gorm:"type:varchar(20)"`
+
+	Address    string  `json:"address" gorm:"type:varchar(255)"`
+	PostalCode string  `json:"postalCode" gorm:"type:varchar(10);index"`
+	City       string  `json:"city" gorm:"type:varchar(100);index"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+
+	OpeningHours OpeningHours `json:"openingHours" gorm:"type:text"`
+}
+
+// TableName overrides the table name used by GORM.
+func (StoreInfo) TableName() string {
+	return "stores"
+}
+
+// ScrapeTarget returns the store as an entry for the scrape list.
+func (s StoreInfo) ScrapeTarget() Store {
+	return Store{Name: s.Name, URLSlug: s.URLSlug, ID: s.ID}
+}
+
+// StoreSummary is a catalogue store with the number of its offers and when it was
+// last scraped.
+//
+// swagger:model StoreSummary
+type StoreSummary struct {
+	StoreInfo
+
+	// the offers of the store, past ones included
+	Offers int64 `json:"offers"`
+	// the offers of the store that are valid now
+	CurrentOffers int64 `json:"currentOffers"`
+	// when the last successful scrape of the store finished
+	LastScrapedAt *time.Time `json:"lastScrapedAt,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// TaxonomyCategory is one node of the category taxonomy. The ID is what offers
+// store; labels and aliases are only used to display and to recognize the category.
+type TaxonomyCategory struct {
+	ID      string   `yaml:"id" json:"id"`
+	Parent  string   `yaml:"parent" json:"parent,omitempty"`
+	LabelSV string   `yaml:"sv" json:"sv"`
+	LabelEN string   `yaml:"en" json:"en"`
+	Aliases []string `yaml:"aliases" json:"aliases,omitempty"`
+}
+
+// Taxonomy is the versioned, hierarchical list of categories offers can be assigned.
+type Taxonomy struct {
+	Version    int                `yaml:"version" json:"version"`
+	Categories []TaxonomyCategory `yaml:"categories" json:"categories"`
+}
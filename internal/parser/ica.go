@@ -14,15 +14,24 @@ import (
 // unparsed string data from the scraper to the service's business logic.
 type RawOffer struct {
 	PromotionID  string
+	EAN          string
 	Name         string
 	OriginalText string
 	DealText     string
 }
 
+// ParseResult is what the parser found on an offers page.
+type ParseResult struct {
+	Offers []RawOffer
+	// Skipped holds the promotion IDs of the offer cards that could not be read, e.g.
+	// for a missing name. The offers are still on the page, so they are not withdrawn.
+	Skipped []string
+}
+
 // OfferParser defines the contract for scraping and extracting raw offer data
 // from the HTML source. It knows how to read the HTML structure.
 type OfferParser interface {
-	ParseRawOffers(ctx context.Context, reader io.Reader) ([]RawOffer, error)
+	ParseRawOffers(ctx context.Context, reader io.Reader) (ParseResult, error)
 }
 
 // icaDealParser is the concrete implementation of the scraping logic.
@@ -36,7 +45,7 @@ func NewOfferParser() OfferParser {
 
 // ParseRawOffers fetches the rendered HTML and extracts only the required string data
 // (name, original price text, deal price text) for each offer card.
-func (p *icaDealParser) ParseRawOffers(ctx context.Context, reader io.Reader) ([]RawOffer, error) {
+func (p *icaDealParser) ParseRawOffers(ctx context.Context, reader io.Reader) (ParseResult, error) {
 	// 1. Fetch the HTML content
 	htmlReader := reader
 
@@ -47,31 +56,37 @@ func (p *icaDealParser) ParseRawOffers(ctx context.Context, reader io.Reader) ([
 		if closer, ok := htmlReader.(io.Closer); ok {
 			closer.Close()
 		}
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return ParseResult{}, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
-	var rawOffers []RawOffer
+	var result ParseResult
 	// 3. Use goquery to traverse and extract raw strings
 	goquery.NewDocumentFromNode(doc).Find("article").Each(func(i int, sel *goquery.Selection) {
 		promotionID, exists := sel.Attr("data-promotion-id")
-		if !exists {
-			// Skip this article if it's not an offer card
+		promotionID = strings.TrimSpace(promotionID)
+		if !exists || promotionID == "" {
+			// Skip this article if it's not an offer card; the promotion ID identifies the offer
 			return
 		}
 
 		name := strings.TrimSpace(sel.Find(".offer-card__title").Text())
 		if name == "" {
 			log.Printf("Missing name for promotion ID: %s. Skipping.", promotionID)
+			result.Skipped = append(result.Skipped, promotionID)
 			return
 		}
 
-		rawOffers = append(rawOffers, RawOffer{
+		// Not every card carries an EAN; it is only used for product matching when present
+		ean, _ := sel.Attr("data-ean")
+
+		result.Offers = append(result.Offers, RawOffer{
 			PromotionID:  promotionID,
+			EAN:          strings.TrimSpace(ean),
 			Name:         name,
 			OriginalText: sel.Find(".offer-card__text").Text(),
 			DealText:     strings.ToLower(sel.Find(".price-splash__text").Text()),
 		})
 	})
 
-	return rawOffers, nil
+	return result, nil
 }
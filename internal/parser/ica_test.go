@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const offersPage = `<html><body>
+<article data-promotion-id="1001" data-ean="7310865004703">
+  <h2 class="offer-card__title"> Kaffe </h2>
+  <p class="offer-card__text">Gevalia. 450 g. Jfr-pris 88,67 kr/kg.</p>
+  <div class="price-splash__text">2 för 79 KR</div>
+</article>
+<article data-promotion-id="1002">
+  <h2 class="offer-card__title"></h2>
+  <div class="price-splash__text">25 kr/st</div>
+</article>
+<article>
+  <h2 class="offer-card__title">Recept</h2>
+</article>
+<article data-promotion-id=" 1003 ">
+  <h2 class="offer-card__title">Mjölk</h2>
+</article>
+</body></html>`
+
+func TestParseRawOffers(t *testing.T) {
+	result, err := NewOfferParser().ParseRawOffers(context.Background(), strings.NewReader(offersPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RawOffer{
+		{PromotionID: "1001", EAN: "7310865004703", Name: "Kaffe", OriginalText: "Gevalia. 450 g. Jfr-pris 88,67 kr/kg.", DealText: "2 för 79 kr"},
+		{PromotionID: "1003", Name: "Mjölk"},
+	}
+	if !slices.Equal(result.Offers, want) {
+		t.Errorf("got offers\n%+v\nwant\n%+v", result.Offers, want)
+	}
+	// The card without a name is still an offer on the page; the article without a
+	// promotion ID is not an offer card
+	if want := []string{"1002"}; !slices.Equal(result.Skipped, want) {
+		t.Errorf("got skipped cards %v, want %v", result.Skipped, want)
+	}
+}
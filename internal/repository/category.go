@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CategoryCacheRepository defines the interface for the persistent categorization cache.
+type CategoryCacheRepository interface {
+	// GetCachedCategories returns the cached entries for the given normalized names
+	// that were stored at or after notBefore, by name. Names without a fresh entry are left out.
+	GetCachedCategories(ctx context.Context, names []string, notBefore time.Time) (map[string]models.ProductCategory, error)
+	SaveCachedCategories(ctx context.Context, entries []models.ProductCategory) error
+	InvalidateCachedCategories(ctx context.Context, names []string) (int, error)
+	InvalidateCachedCategoriesBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// PostgresCategoryCacheRepository implements CategoryCacheRepository for PostgreSQL using GORM.
+type PostgresCategoryCacheRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresCategoryCacheRepository creates a new instance.
+func NewPostgresCategoryCacheRepository(db *gorm.DB) *PostgresCategoryCacheRepository {
+	return &PostgresCategoryCacheRepository{
+		db: db,
+	}
+}
+
+// GetCachedCategories reads the fresh cache entries for the given names.
+func (r *PostgresCategoryCacheRepository) GetCachedCategories(ctx context.Context, names []string, notBefore time.Time) (map[string]models.ProductCategory, error) {
+	cached := make(map[string]models.ProductCategory)
+	if len(names) == 0 {
+		return cached, nil
+	}
+
+	var rows []models.ProductCategory
+	query := r.db.WithContext(ctx).Where("normalized_name IN ?", names)
+	if !notBefore.IsZero() {
+		query = query.Where("updated_at >= ?", notBefore)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read category cache: %w", err)
+	}
+	for _, row := range rows {
+		cached[row.NormalizedName] = row
+	}
+	return cached, nil
+}
+
+// SaveCachedCategories upserts cache entries, refreshing their timestamp.
+func (r *PostgresCategoryCacheRepository) SaveCachedCategories(ctx context.Context, entries []models.ProductCategory) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "normalized_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"categories", "source", "confidence", "updated_at"}),
+	}).CreateInBatches(&entries, 100)
+	if result.Error != nil {
+		return fmt.Errorf("failed to write category cache: %w", result.Error)
+	}
+	return nil
+}
+
+// InvalidateCachedCategories removes the entries for the given normalized names.
+func (r *PostgresCategoryCacheRepository) InvalidateCachedCategories(ctx context.Context, names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+	result := r.db.WithContext(ctx).Where("normalized_name IN ?", names).Delete(&models.ProductCategory{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to invalidate category cache: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// InvalidateCachedCategoriesBefore removes all entries last stored before the given time.
+// Pass time.Now() to clear the whole cache.
+func (r *PostgresCategoryCacheRepository) InvalidateCachedCategoriesBefore(ctx context.Context, before time.Time) (int, error) {
+	result := r.db.WithContext(ctx).Where("updated_at < ?", before).Delete(&models.ProductCategory{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to invalidate category cache: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// CategoryOverrideRepository stores manual category corrections.
+type CategoryOverrideRepository interface {
+	// SetOverride creates or replaces the override with the same key
+	SetOverride(ctx context.Context, override *models.CategoryOverride) error
+	// DeleteOverride removes an override and reports whether it existed
+	DeleteOverride(ctx context.Context, key string) (bool, error)
+	// GetOverrides returns the overrides for the given keys, keyed by key
+	GetOverrides(ctx context.Context, keys []string) (map[string]models.CategoryOverride, error)
+	// ListOverrides returns the most recently changed overrides first; limit 0 returns all
+	ListOverrides(ctx context.Context, limit int) ([]models.CategoryOverride, error)
+}
+
+// PostgresCategoryOverrideRepository implements CategoryOverrideRepository for PostgreSQL using GORM.
+type PostgresCategoryOverrideRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresCategoryOverrideRepository creates a new instance.
+func NewPostgresCategoryOverrideRepository(db *gorm.DB) *PostgresCategoryOverrideRepository {
+	return &PostgresCategoryOverrideRepository{
+		db: db,
+	}
+}
+
+// SetOverride upserts an override by key.
+func (r *PostgresCategoryOverrideRepository) SetOverride(ctx context.Context, override *models.CategoryOverride) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"product_id", "product_name", "categories", "reason", "updated_at"}),
+	}).Create(override)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save category override %s: %w", override.Key, result.Error)
+	}
+	return nil
+}
+
+// DeleteOverride removes the override with the given key.
+func (r *PostgresCategoryOverrideRepository) DeleteOverride(ctx context.Context, key string) (bool, error) {
+	result := r.db.WithContext(ctx).Where("key = ?", key).Delete(&models.CategoryOverride{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete category override %s: %w", key, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetOverrides reads the overrides for the given keys.
+func (r *PostgresCategoryOverrideRepository) GetOverrides(ctx context.Context, keys []string) (map[string]models.CategoryOverride, error) {
+	overrides := make(map[string]models.CategoryOverride)
+	if len(keys) == 0 {
+		return overrides, nil
+	}
+	var rows []models.CategoryOverride
+	if err := r.db.WithContext(ctx).Where("key IN ?", keys).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read category overrides: %w", err)
+	}
+	for _, row := range rows {
+		overrides[row.Key] = row
+	}
+	return overrides, nil
+}
+
+// ListOverrides returns overrides, most recently changed first.
+func (r *PostgresCategoryOverrideRepository) ListOverrides(ctx context.Context, limit int) ([]models.CategoryOverride, error) {
+	var rows []models.CategoryOverride
+	query := r.db.WithContext(ctx).Order("updated_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list category overrides: %w", err)
+	}
+	return rows, nil
+}
+
+// CategoryRepository defines the interface for the categories offers are assigned to.
+type CategoryRepository interface {
+	// SyncTaxonomy creates or renames a category for every taxonomy category and links
+	// it to its parent
+	SyncTaxonomy(ctx context.Context, categories []models.TaxonomyCategory) error
+	// CountOffers returns every category with the number of offers advertised in it
+	// and in its subtree at the given time, by key
+	CountOffers(ctx context.Context, at time.Time) ([]models.CategoryCount, error)
+}
+
+// PostgresCategoryRepository implements CategoryRepository for PostgreSQL using GORM.
+type PostgresCategoryRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresCategoryRepository creates a new instance.
+func NewPostgresCategoryRepository(db *gorm.DB) *PostgresCategoryRepository {
+	return &PostgresCategoryRepository{
+		db: db,
+	}
+}
+
+// SyncTaxonomy upserts the taxonomy categories by key, then sets their parents.
+// Categories no longer in the taxonomy are kept, since offers may still use them.
+func (r *PostgresCategoryRepository) SyncTaxonomy(ctx context.Context, categories []models.TaxonomyCategory) error {
+	if len(categories) == 0 {
+		return nil
+	}
+	rows := make([]models.Category, 0, len(categories))
+	for _, category := range categories {
+		rows = append(rows, models.Category{Key: category.ID, Name: category.LabelSV})
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+		}).CreateInBatches(&rows, 100)
+		if result.Error != nil {
+			return fmt.Errorf("failed to save taxonomy categories: %w", result.Error)
+		}
+		for _, category := range categories {
+			var parent interface{}
+			if category.Parent != "" {
+				parent = tx.Model(&models.Category{}).Select("id").Where("key = ?", category.Parent)
+			}
+			err := tx.Model(&models.Category{}).Where("key = ?", category.ID).Update("parent_id", parent).Error
+			if err != nil {
+				return fmt.Errorf("failed to link category %s to its parent: %w", category.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CountOffers counts the advertised offers of every category. An offer in several
+// categories of a subtree counts once towards the subtree's total.
+func (r *PostgresCategoryRepository) CountOffers(ctx context.Context, at time.Time) ([]models.CategoryCount, error) {
+	var counts []models.CategoryCount
+	err := r.db.WithContext(ctx).Raw(`WITH RECURSIVE subtree (root_id, id) AS (
+			SELECT id, id FROM categories
+			UNION
+			SELECT subtree.root_id, categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+		),
+		assigned AS (
+			SELECT offer_categories.offer_id, offer_categories.category_id
+			FROM offer_categories JOIN offers ON offers.id = offer_categories.offer_id
+			WHERE offers.deleted_at IS NULL AND `+advertisedAt+`
+		)
+		SELECT categories.*,
+			(SELECT COUNT(*) FROM assigned WHERE assigned.category_id = categories.id) AS offers,
+			(SELECT COUNT(DISTINCT assigned.offer_id) FROM subtree JOIN assigned ON assigned.category_id = subtree.id
+				WHERE subtree.root_id = categories.id) AS total_offers
+		FROM categories
+		ORDER BY categories.key`, at, at, at).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count offers per category: %w", err)
+	}
+	return counts, nil
+}
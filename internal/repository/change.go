@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// OfferChangeRepository defines the interface for persisting offer change events.
+type OfferChangeRepository interface {
+	InsertChanges(ctx context.Context, changes []models.OfferChange) error
+	ListChanges(ctx context.Context, filter models.OfferChangeFilter) ([]models.OfferChange, error)
+}
+
+// PostgresOfferChangeRepository implements OfferChangeRepository for PostgreSQL using GORM.
+type PostgresOfferChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresOfferChangeRepository creates a new instance.
+func NewPostgresOfferChangeRepository(db *gorm.DB) *PostgresOfferChangeRepository {
+	return &PostgresOfferChangeRepository{
+		db: db,
+	}
+}
+
+// InsertChanges appends change events. Events are never updated.
+func (r *PostgresOfferChangeRepository) InsertChanges(ctx context.Context, changes []models.OfferChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).CreateInBatches(&changes, 100).Error; err != nil {
+		return fmt.Errorf("gorm insert of offer changes failed: %w", err)
+	}
+	return nil
+}
+
+// ListChanges returns change events matching the filter, newest first.
+func (r *PostgresOfferChangeRepository) ListChanges(ctx context.Context, filter models.OfferChangeFilter) ([]models.OfferChange, error) {
+	var changes []models.OfferChange
+	query := r.db.WithContext(ctx).Order("detected_at DESC, id")
+	if filter.StoreID != 0 {
+		query = query.Where("store_id = ?", filter.StoreID)
+	}
+	if filter.StoreName != "" {
+		query = query.Where("store_name = ?", filter.StoreName)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("detected_at >= ?", filter.Since)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve offer changes: %w", err)
+	}
+	return changes, nil
+}
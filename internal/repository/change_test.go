@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"testing"
+	"time"
+)
+
+func TestListChanges(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresOfferChangeRepository(db)
+	store := newTestStore(t, db, "1001")
+	other := newTestStore(t, db, "1002")
+
+	detected := time.Now().Truncate(time.Second)
+	err := repo.InsertChanges(ctx, []models.OfferChange{
+		{StoreID: &store, StoreName: "ICA Nära Kalmar", Name: "Kaffe", Kind: models.OfferChangeNew, DetectedAt: detected.Add(-48 * time.Hour)},
+		// The store was renamed between the scrapes
+		{StoreID: &store, StoreName: "ICA Supermarket Kalmar", Name: "Kaffe", Kind: models.OfferChangePrice, DetectedAt: detected},
+		{StoreID: &other, StoreName: "ICA Kvantum", Name: "Mjölk", Kind: models.OfferChangeNew, DetectedAt: detected},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.OfferChangeFilter
+		want   []string // kinds, newest first
+	}{
+		{name: "store ID across a rename", filter: models.OfferChangeFilter{StoreID: store},
+			want: []string{models.OfferChangePrice, models.OfferChangeNew}},
+		{name: "store name", filter: models.OfferChangeFilter{StoreName: "ICA Nära Kalmar"}, want: []string{models.OfferChangeNew}},
+		{name: "kind and since", filter: models.OfferChangeFilter{StoreID: store, Kind: models.OfferChangeNew, Since: detected.Add(-time.Hour)}},
+		{name: "limit", filter: models.OfferChangeFilter{StoreID: other, Limit: 1}, want: []string{models.OfferChangeNew}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := repo.ListChanges(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, change := range changes {
+				got = append(got, change.Kind)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,66 +1,212 @@
 package repository
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"grocery_scraper/internal/database"
 	"grocery_scraper/internal/models"
+	"slices"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"        // GORM library
 	"gorm.io/gorm/clause" // Required for Upsert logic (OnConflict)
 )
 
-// OfferRepository defines the interface for persisting offer data. (Remains the same)
+// OfferRepository defines the interface for persisting offer data.
 type OfferRepository interface {
-	InsertOffers(ctx context.Context, offers []models.Offer) (int, error)
+	InsertOffers(ctx context.Context, offers []models.Offer) (InsertResult, error)
+	// ReplaceStoreOffers saves the offers of a complete scrape of a store and withdraws
+	// the store's other offers of the scraped validity periods. seen holds the promotion
+	// IDs found on the page but not saved, e.g. quarantined ones, which stay as they are.
+	// periods are the validity periods the scrape covered; those of the offers are added,
+	// so a scrape without a single offer to save still withdraws the missing ones.
+	ReplaceStoreOffers(ctx context.Context, storeID uint, offers []models.Offer, seen []string, periods []models.ValidityPeriod) (InsertResult, error)
 	CountOffers(ctx context.Context) (int, error)
 	GetAllOffers(ctx context.Context) ([]models.Offer, error)
-	// Init method for GORM AutoMigrate
-	Init(ctx context.Context) error
+	// QueryOffers returns a page of the offers matching the query
+	QueryOffers(ctx context.Context, q models.OfferQuery) (models.OfferPage, error)
+	// SearchOffers returns the offers matching the search text and the filters of
+	// the query, best match first; the sort and cursor of the query are ignored
+	SearchOffers(ctx context.Context, text string, q models.OfferQuery) ([]models.OfferSearchResult, error)
+	GetLatestStoreOffers(ctx context.Context, storeID uint) ([]models.Offer, error)
+	// GetOfferHistory returns every observation of an offer, oldest first
+	GetOfferHistory(ctx context.Context, offerID uint) ([]models.OfferObservation, error)
+	// GetProductHistory returns the observations of a product's offers in all stores
+	// since the given time (zero for all), oldest first
+	GetProductHistory(ctx context.Context, productID uint, since time.Time) ([]models.OfferObservation, error)
+}
+
+// InsertResult counts the offers of an InsertOffers call by what happened to them.
+type InsertResult struct {
+	Inserted  int
+	Updated   int
+	Withdrawn int
+}
+
+// Total is the number of offers written.
+func (r InsertResult) Total() int {
+	return r.Inserted + r.Updated
+}
+
+// NewOfferRepository returns the OfferRepository for the backend of the database.
+func NewOfferRepository(db *gorm.DB) OfferRepository {
+	if database.Dialect(db) == database.SQLite {
+		return NewSQLiteOfferRepository(db)
+	}
+	return NewPostgresOfferRepository(db)
+}
+
+// offerStore implements the parts of OfferRepository that are portable SQL. The
+// backends embed it and provide the filters that need arrays or full-text search.
+type offerStore struct {
+	db *gorm.DB // Use *gorm.DB instead of *sql.DB
+	// match applies the array and text filters of a query
+	match func(query *gorm.DB, q models.OfferQuery) *gorm.DB
 }
 
 // PostgresOfferRepository implements the OfferRepository interface for PostgreSQL using GORM.
 type PostgresOfferRepository struct {
-	db *gorm.DB // Use *gorm.DB instead of *sql.DB
+	offerStore
 }
 
 // NewPostgresOfferRepository creates a new instance.
 func NewPostgresOfferRepository(db *gorm.DB) *PostgresOfferRepository {
-	return &PostgresOfferRepository{
-		db: db,
+	r := &PostgresOfferRepository{}
+	r.offerStore = offerStore{db: db, match: r.match}
+	return r
+}
+
+// InsertOffers uses GORM to perform a bulk UPSERT (Insert or Update) operation and
+// appends an observation of every offer to its price history, in one transaction.
+func (r *offerStore) InsertOffers(ctx context.Context, offers []models.Offer) (InsertResult, error) {
+	var counts InsertResult
+	if len(offers) == 0 {
+		return counts, nil
+	}
+	if err := checkOfferIdentity(offers); err != nil {
+		return counts, err
 	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		counts, err = upsertOffers(tx, offers, time.Now())
+		return err
+	})
+	if err != nil {
+		return InsertResult{}, err
+	}
+	return counts, nil
 }
 
-// Init handles GORM's automatic table creation/migration.
-func (r *PostgresOfferRepository) Init(ctx context.Context) error {
-	// AutoMigrate creates tables/columns based on the struct if they don't exist
-	return r.db.WithContext(ctx).AutoMigrate(&models.Offer{})
+// ReplaceStoreOffers upserts the offers like InsertOffers, then marks the offers of
+// the store that share a validity period with them, but were neither saved nor seen,
+// as withdrawn. An offer that shows up again is no longer withdrawn after the upsert.
+func (r *offerStore) ReplaceStoreOffers(ctx context.Context, storeID uint, offers []models.Offer, seen []string, periods []models.ValidityPeriod) (InsertResult, error) {
+	var counts InsertResult
+	if err := checkOfferIdentity(offers); err != nil {
+		return counts, err
+	}
+	periods = slices.Clone(periods)
+	keep := append([]string{}, seen...)
+	for _, offer := range offers {
+		if *offer.StoreID != storeID {
+			return counts, fmt.Errorf("offer %q belongs to store %d, not %d", offer.Name, *offer.StoreID, storeID)
+		}
+		if p := offer.Period(); !slices.ContainsFunc(periods, p.Equal) {
+			periods = append(periods, p)
+		}
+		keep = append(keep, offer.PromotionID)
+	}
+	if len(periods) == 0 {
+		return counts, nil
+	}
+
+	observedAt := time.Now()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(offers) > 0 {
+			var err error
+			if counts, err = upsertOffers(tx, offers, observedAt); err != nil {
+				return err
+			}
+		}
+		for _, p := range periods {
+			withdraw := tx.Model(&models.Offer{}).
+				Where("store_id = ? AND valid_from = ? AND valid_to = ? AND withdrawn_at IS NULL", storeID, p.From, p.To)
+			if len(keep) > 0 {
+				withdraw = withdraw.Where("promotion_id IS NULL OR promotion_id NOT IN ?", keep)
+			}
+			result := withdraw.Update("withdrawn_at", observedAt)
+			if result.Error != nil {
+				return fmt.Errorf("failed to withdraw offers of store %d: %w", storeID, result.Error)
+			}
+			counts.Withdrawn += int(result.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return InsertResult{}, err
+	}
+	return counts, nil
 }
 
-// InsertOffers uses GORM to perform a bulk UPSERT (Insert or Update) operation.
-func (r *PostgresOfferRepository) InsertOffers(ctx context.Context, offers []models.Offer) (int, error) {
-	if len(offers) == 0 {
-		return 0, nil
+// checkOfferIdentity makes sure every offer can be saved. Offers are unique per store
+// and promotion; without them every scrape would add a new row.
+func checkOfferIdentity(offers []models.Offer) error {
+	for _, offer := range offers {
+		if offer.StoreID == nil {
+			return fmt.Errorf("offer %q of %s has no store ID", offer.Name, offer.StoreName)
+		}
+		if offer.Source == "" || offer.PromotionID == "" {
+			return fmt.Errorf("offer %q of %s has no promotion ID", offer.Name, offer.StoreName)
+		}
 	}
-	// Use CreateInBatches for high performance. GORM manages the transactions.
+	return nil
+}
+
+// upsertOffers writes the offers, an observation of each and their categories within
+// a transaction.
+func upsertOffers(tx *gorm.DB, offers []models.Offer, observedAt time.Time) (InsertResult, error) {
+	var counts InsertResult
+	// Use CreateInBatches for high performance.
 	// We wrap the operation with OnConflict clause to perform an UPSERT.
-	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
-		// Target the unique index we defined on (StoreName, Name)
-		Columns: []clause.Column{{Name: "store_name"}, {Name: "name"}, {Name: "product_url"}},
+	result := tx.Clauses(clause.OnConflict{
+		// Target the unique index we defined on (StoreID, Source, PromotionID, ValidFrom, ValidTo)
+		Columns: []clause.Column{{Name: "store_id"}, {Name: "source"}, {Name: "promotion_id"}, {Name: "valid_from"}, {Name: "valid_to"}},
 		// If a conflict occurs, update all columns.
 		// We use pq.StringArray in the model which handles the array serialization correctly.
 		UpdateAll: true,
-	}).CreateInBatches(&offers, 100) // Insert in batches of 100
-
+	}, clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "created_at"}}}).CreateInBatches(&offers, 100) // Insert in batches of 100
 	if result.Error != nil {
-		return 0, fmt.Errorf("gorm bulk upsert failed: %w", result.Error)
+		return counts, fmt.Errorf("gorm bulk upsert failed: %w", result.Error)
+	}
+
+	// Updated rows return the created_at of their first insert
+	insertedSince := observedAt.Truncate(time.Millisecond)
+	for _, offer := range offers {
+		if offer.CreatedAt.Before(insertedSince) {
+			counts.Updated++
+		} else {
+			counts.Inserted++
+		}
 	}
 
-	return int(result.RowsAffected), nil
+	// The upsert returned the IDs of the inserted and the updated rows
+	observations := make([]models.OfferObservation, 0, len(offers))
+	for _, offer := range offers {
+		observations = append(observations, models.NewOfferObservation(offer, observedAt))
+	}
+	if err := tx.CreateInBatches(&observations, 100).Error; err != nil {
+		return counts, fmt.Errorf("failed to record offer history: %w", err)
+	}
+	if err := saveOfferCategories(tx, offers); err != nil {
+		return counts, err
+	}
+	return counts, nil
 }
 
 // CountOffers returns the total number of offers in the table.
-func (r *PostgresOfferRepository) CountOffers(ctx context.Context) (int, error) {
+func (r *offerStore) CountOffers(ctx context.Context) (int, error) {
 	var count int64
 	// Use GORM's Model() and Count() methods
 	result := r.db.WithContext(ctx).Model(&models.Offer{}).Count(&count)
@@ -69,14 +215,223 @@ func (r *PostgresOfferRepository) CountOffers(ctx context.Context) (int, error)
 	}
 	return int(count), nil
 }
-func (r *PostgresOfferRepository) GetAllOffers(ctx context.Context) ([]models.Offer, error) {
+func (r *offerStore) GetAllOffers(ctx context.Context) ([]models.Offer, error) {
 	var offers []models.Offer
 	now := time.Now()
-	// Fetches all records from the 'offers' table where valid_from <= now <= valid_to
-	result := r.db.WithContext(ctx).Where("valid_from <= ? AND valid_to >= ?", now, now).Find(&offers)
+	// Fetches all records from the 'offers' table where valid_from <= now <= valid_to,
+	// leaving out the offers the store no longer advertises
+	result := r.db.WithContext(ctx).Where(advertisedAt, now, now, now).Find(&offers)
 
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to retrieve offers: %w", result.Error)
 	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), offerPointers(offers)); err != nil {
+		return nil, err
+	}
 	return offers, nil
 }
+
+// GetLatestStoreOffers returns the offers of the most recent validity period scraped
+// for a store, i.e. what the previous run left in the table. Withdrawn offers already
+// ended and are left out.
+func (r *offerStore) GetLatestStoreOffers(ctx context.Context, storeID uint) ([]models.Offer, error) {
+	var offers []models.Offer
+	latest := r.db.Model(&models.Offer{}).Select("MAX(valid_to)").Where("store_id = ?", storeID)
+	result := r.db.WithContext(ctx).Where("store_id = ? AND valid_to = (?) AND withdrawn_at IS NULL", storeID, latest).Find(&offers)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve latest offers for store %d: %w", storeID, result.Error)
+	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), offerPointers(offers)); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// advertisedAt selects the offers a store advertised at a time: valid then, and not
+// withdrawn before. It takes the time three times.
+const advertisedAt = "valid_from <= ? AND valid_to >= ? AND (withdrawn_at IS NULL OR withdrawn_at > ?)"
+
+// offerSortColumns maps the sortable offer fields to their columns.
+var offerSortColumns = map[string]string{
+	models.OfferSortID:                 "id",
+	models.OfferSortSalePrice:          "sale_price",
+	models.OfferSortOriginalPrice:      "original_price",
+	models.OfferSortSalePriceTotal:     "sale_price_total",
+	models.OfferSortSaleQuantity:       "sale_quantity",
+	models.OfferSortDiscount:           "discount",
+	models.OfferSortDiscountPercentage: "discount_percentage",
+	// offers scraped before attributes were extracted have no net quantity
+	models.OfferSortNetQuantity: "COALESCE(net_quantity, 0)",
+}
+
+// filterOffers applies the filters of an offer query, without its sort and page.
+func (r *offerStore) filterOffers(ctx context.Context, q models.OfferQuery) *gorm.DB {
+	validAt := q.ValidAt
+	if validAt.IsZero() {
+		validAt = time.Now()
+	}
+	query := r.db.WithContext(ctx).Where(advertisedAt, validAt, validAt, validAt)
+	if len(q.Stores) > 0 {
+		query = query.Where("store_name IN ?", q.Stores)
+	}
+	if len(q.StoreIDs) > 0 {
+		query = query.Where("store_id IN ?", q.StoreIDs)
+	}
+	if q.Chain != "" {
+		query = query.Where("store_id IN (?)", r.db.Model(&models.StoreInfo{}).Select("id").Where("chain = ?", q.Chain))
+	}
+	if len(q.Categories) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM offer_categories WHERE offer_categories.offer_id = offers.id AND offer_categories.category_id IN (?))",
+			categorySubtree(r.db, q.Categories))
+	}
+	if len(q.Types) > 0 {
+		query = query.Where("type IN ?", q.Types)
+	}
+	if q.MinDiscount != nil {
+		query = query.Where("discount_percentage >= ?", *q.MinDiscount)
+	}
+	if q.MaxDiscount != nil {
+		query = query.Where("discount_percentage <= ?", *q.MaxDiscount)
+	}
+	if q.MinPrice != nil {
+		query = query.Where("sale_price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		query = query.Where("sale_price <= ?", *q.MaxPrice)
+	}
+	if q.SwedishOrigin != nil {
+		query = query.Where("swedish_origin = ?", *q.SwedishOrigin)
+	}
+	return r.match(query, q)
+}
+
+// match applies the filters on the text[] columns and the full-text search.
+func (r *PostgresOfferRepository) match(query *gorm.DB, q models.OfferQuery) *gorm.DB {
+	if q.Text != "" {
+		query = query.Where(offerSearchMatch, q.Text, q.Text)
+	}
+	if q.Brand != "" {
+		query = query.Where(`brand ILIKE ? ESCAPE '\'`, likeEscape(q.Brand))
+	}
+	if len(q.Labels) > 0 {
+		query = query.Where("labels @> ?", models.StringArray(q.Labels))
+	}
+	if len(q.DietaryTags) > 0 {
+		query = query.Where("dietary_tags @> ?", models.StringArray(q.DietaryTags))
+	}
+	return query
+}
+
+// offerSearchMatch matches the offers whose name or brand contain the words of the
+// search text in any Swedish inflection, or whose name contains a word similar to it.
+const offerSearchMatch = "(search_vector @@ websearch_to_tsquery('swedish', ?) OR ? <% name)"
+
+// SearchOffers ranks the offers matching the search text and the filters of the
+// query. Full-text matches rank above typo matches.
+func (r *PostgresOfferRepository) SearchOffers(ctx context.Context, text string, q models.OfferQuery) ([]models.OfferSearchResult, error) {
+	q.Text = text
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var results []models.OfferSearchResult
+	err := r.filterOffers(ctx, q).Model(&models.Offer{}).
+		Select(`offers.*,
+			ts_rank(search_vector, websearch_to_tsquery('swedish', ?)) + word_similarity(?, name) AS rank,
+			ts_headline('swedish', name, websearch_to_tsquery('swedish', ?), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS highlight`,
+			text, text, text).
+		Order("rank DESC, id").Limit(limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search offers for %q: %w", text, err)
+	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), searchResultOffers(results)); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryOffers returns a page of the offers matching the query. Pages are keyset
+// paginated on the sort field and the ID, so they stay stable while offers are added.
+func (r *offerStore) QueryOffers(ctx context.Context, q models.OfferQuery) (models.OfferPage, error) {
+	sort := cmp.Or(q.Sort, models.OfferSortID)
+	column, ok := offerSortColumns[sort]
+	if !ok {
+		return models.OfferPage{}, fmt.Errorf("%w: %q", models.ErrUnknownSort, q.Sort)
+	}
+
+	query := r.filterOffers(ctx, q)
+
+	direction, after := "ASC", ">"
+	if q.Descending {
+		direction, after = "DESC", "<"
+	}
+	if q.After != nil {
+		if q.After.Sort != sort || q.After.Descending != q.Descending {
+			return models.OfferPage{}, models.ErrInvalidCursor
+		}
+		if column == "id" {
+			query = query.Where("id "+after+" ?", q.After.ID)
+		} else {
+			query = query.Where("("+column+", id) "+after+" (?, ?)", q.After.Value, q.After.ID)
+		}
+	}
+	if column != "id" {
+		query = query.Order(column + " " + direction)
+	}
+	query = query.Order("id " + direction)
+	// One extra row tells whether there is a next page
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit + 1)
+	}
+
+	var page models.OfferPage
+	if err := query.Find(&page.Offers).Error; err != nil {
+		return models.OfferPage{}, fmt.Errorf("failed to query offers: %w", err)
+	}
+	if q.Limit > 0 && len(page.Offers) > q.Limit {
+		page.Offers = page.Offers[:q.Limit]
+		last := page.Offers[q.Limit-1]
+		page.Next = &models.OfferCursor{Sort: sort, Descending: q.Descending, Value: last.SortValue(sort), ID: last.ID}
+	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), offerPointers(page.Offers)); err != nil {
+		return models.OfferPage{}, err
+	}
+	return page, nil
+}
+
+// GetOfferHistory returns the observations of an offer, oldest first.
+func (r *offerStore) GetOfferHistory(ctx context.Context, offerID uint) ([]models.OfferObservation, error) {
+	var observations []models.OfferObservation
+	result := r.db.WithContext(ctx).Where("offer_id = ?", offerID).Order("observed_at ASC, id ASC").Find(&observations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve history of offer %d: %w", offerID, result.Error)
+	}
+	return observations, nil
+}
+
+// GetProductHistory returns the observations of a product's offers in all stores, oldest first.
+func (r *offerStore) GetProductHistory(ctx context.Context, productID uint, since time.Time) ([]models.OfferObservation, error) {
+	var observations []models.OfferObservation
+	query := r.db.WithContext(ctx).Where("product_id = ?", productID)
+	if !since.IsZero() {
+		query = query.Where("observed_at >= ?", since)
+	}
+	if result := query.Order("observed_at ASC, id ASC").Find(&observations); result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve history of product %d: %w", productID, result.Error)
+	}
+	return observations, nil
+}
+
+// likePattern matches text containing the word, with the LIKE wildcards escaped.
+func likePattern(word string) string {
+	return "%" + likeEscape(word) + "%"
+}
+
+// likeEscape escapes the LIKE wildcards in text, so it only matches itself with
+// ESCAPE '\'.
+func likeEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
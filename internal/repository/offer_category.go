@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"fmt"
+	"grocery_scraper/internal/models"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categoryLoadBatch limits the offer IDs per query when loading categories.
+const categoryLoadBatch = 1000
+
+// saveOfferCategories replaces the category assignments of the saved offers with
+// their current categories. Categories missing from the categories table are added
+// without a parent; the taxonomy sync links them later.
+func saveOfferCategories(tx *gorm.DB, offers []models.Offer) error {
+	offerIDs := make([]uint, 0, len(offers))
+	var keys []string
+	for _, offer := range offers {
+		offerIDs = append(offerIDs, offer.ID)
+		for _, key := range offer.Categories {
+			if key != "" && !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if err := tx.Where("offer_id IN ?", offerIDs).Delete(&models.OfferCategory{}).Error; err != nil {
+		return fmt.Errorf("failed to clear offer categories: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	categoryIDs, err := ensureCategories(tx, keys)
+	if err != nil {
+		return err
+	}
+	var rows []models.OfferCategory
+	for _, offer := range offers {
+		source := offer.CategorySource
+		if source == "" {
+			source = models.CategorySourceLegacy
+		}
+		var assigned []uint
+		for _, key := range offer.Categories {
+			id, ok := categoryIDs[key]
+			if !ok || slices.Contains(assigned, id) {
+				continue
+			}
+			assigned = append(assigned, id)
+			rows = append(rows, models.OfferCategory{OfferID: offer.ID, CategoryID: id, Source: source, Confidence: offer.CategoryConfidence})
+		}
+	}
+	if err := tx.CreateInBatches(&rows, 100).Error; err != nil {
+		return fmt.Errorf("failed to save offer categories: %w", err)
+	}
+	return nil
+}
+
+// ensureCategories adds the categories that do not exist yet and returns the IDs of
+// all of them, by key.
+func ensureCategories(tx *gorm.DB, keys []string) (map[string]uint, error) {
+	missing := make([]models.Category, 0, len(keys))
+	for _, key := range keys {
+		missing = append(missing, models.Category{Key: key, Name: key})
+	}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoNothing: true,
+	}).CreateInBatches(&missing, 100)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to add categories: %w", result.Error)
+	}
+
+	var categories []models.Category
+	if err := tx.Where("key IN ?", keys).Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to read categories: %w", err)
+	}
+	ids := make(map[string]uint, len(categories))
+	for _, category := range categories {
+		ids[category.Key] = category.ID
+	}
+	return ids, nil
+}
+
+// loadOfferCategories fills in the category keys of the offers, in key order.
+func loadOfferCategories(db *gorm.DB, offers []*models.Offer) error {
+	byID := make(map[uint]*models.Offer, len(offers))
+	ids := make([]uint, 0, len(offers))
+	for _, offer := range offers {
+		byID[offer.ID] = offer
+		ids = append(ids, offer.ID)
+	}
+	for batch := range slices.Chunk(ids, categoryLoadBatch) {
+		var rows []struct {
+			OfferID uint
+			Key     string
+		}
+		err := db.Model(&models.OfferCategory{}).
+			Select("offer_categories.offer_id, categories.key").
+			Joins("JOIN categories ON categories.id = offer_categories.category_id").
+			Where("offer_categories.offer_id IN ?", batch).
+			Order("offer_categories.offer_id, categories.key").
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to load offer categories: %w", err)
+		}
+		for _, row := range rows {
+			offer := byID[row.OfferID]
+			offer.Categories = append(offer.Categories, row.Key)
+		}
+	}
+	return nil
+}
+
+// categorySubtree selects the IDs of the categories with the given keys and of all
+// their subcategories.
+func categorySubtree(db *gorm.DB, keys []string) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE subtree (id) AS (
+			SELECT id FROM categories WHERE key IN ?
+			UNION
+			SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+		)
+		SELECT id FROM subtree`, keys)
+}
+
+// offerPointers returns a pointer to every offer of the slice.
+func offerPointers(offers []models.Offer) []*models.Offer {
+	pointers := make([]*models.Offer, len(offers))
+	for i := range offers {
+		pointers[i] = &offers[i]
+	}
+	return pointers
+}
+
+// searchResultOffers returns a pointer to the offer of every search result.
+func searchResultOffers(results []models.OfferSearchResult) []*models.Offer {
+	pointers := make([]*models.Offer, len(results))
+	for i := range results {
+		pointers[i] = &results[i].Offer
+	}
+	return pointers
+}
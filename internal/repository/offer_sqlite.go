@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SQLiteOfferRepository implements the OfferRepository interface for SQLite using GORM.
+// The array columns hold JSON arrays, and search matches words with LIKE.
+type SQLiteOfferRepository struct {
+	offerStore
+}
+
+// NewSQLiteOfferRepository creates a new instance.
+func NewSQLiteOfferRepository(db *gorm.DB) *SQLiteOfferRepository {
+	r := &SQLiteOfferRepository{}
+	r.offerStore = offerStore{db: db, match: r.match}
+	return r
+}
+
+// match applies the filters on the JSON array columns and the word search.
+func (r *SQLiteOfferRepository) match(query *gorm.DB, q models.OfferQuery) *gorm.DB {
+	// Every word must be in the name or the brand
+	for _, word := range searchWords(q.Text) {
+		pattern := likePattern(word)
+		query = query.Where(`(name LIKE ? ESCAPE '\' OR brand LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if q.Brand != "" {
+		query = query.Where(`brand LIKE ? ESCAPE '\'`, likeEscape(q.Brand))
+	}
+	for _, label := range q.Labels {
+		query = query.Where("EXISTS (SELECT 1 FROM json_each(offers.labels) WHERE value = ?)", label)
+	}
+	for _, tag := range q.DietaryTags {
+		query = query.Where("EXISTS (SELECT 1 FROM json_each(offers.dietary_tags) WHERE value = ?)", tag)
+	}
+	return query
+}
+
+// SearchOffers ranks the offers containing every word of the search text by how
+// many of the words are in their name, then in their brand. LIKE only folds ASCII
+// letters, and there is no stemming or typo tolerance as on Postgres.
+func (r *SQLiteOfferRepository) SearchOffers(ctx context.Context, text string, q models.OfferQuery) ([]models.OfferSearchResult, error) {
+	words := searchWords(text)
+	if len(words) == 0 {
+		return []models.OfferSearchResult{}, nil
+	}
+	q.Text = text
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	terms := make([]string, 0, 2*len(words))
+	vars := make([]interface{}, 0, 2*len(words))
+	for _, word := range words {
+		pattern := likePattern(word)
+		terms = append(terms, `(name LIKE ? ESCAPE '\')`, `0.5 * (brand LIKE ? ESCAPE '\')`)
+		vars = append(vars, pattern, pattern)
+	}
+
+	var results []models.OfferSearchResult
+	err := r.filterOffers(ctx, q).Model(&models.Offer{}).
+		Select("offers.*, "+strings.Join(terms, " + ")+" AS rank", vars...).
+		Order("rank DESC, id").Limit(limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search offers for %q: %w", text, err)
+	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), searchResultOffers(results)); err != nil {
+		return nil, err
+	}
+	highlight := highlighter(words)
+	for i := range results {
+		results[i].Highlight = highlight.ReplaceAllString(results[i].Name, "<mark>$0</mark>")
+	}
+	return results, nil
+}
+
+// searchWords splits search text into words, dropping the quotes and operators
+// of the web search syntax Postgres understands.
+func searchWords(text string) []string {
+	var words []string
+	for _, word := range strings.Fields(text) {
+		word = strings.Trim(word, `"-`)
+		if word != "" && !strings.EqualFold(word, "or") {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// highlighter matches any of the words, ignoring case.
+func highlighter(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
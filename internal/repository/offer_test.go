@@ -0,0 +1,511 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/database"
+	"grocery_scraper/internal/migrations"
+	"grocery_scraper/internal/models"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated SQLite database in a temporary directory.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open("sqlite://"+filepath.Join(t.TempDir(), "offers.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := migrations.Prepare(context.Background(), db, true); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestStore adds a store to the stores table and returns its ID.
+func newTestStore(t *testing.T, db *gorm.DB, externalID string) uint {
+	t.Helper()
+	store := models.StoreInfo{Chain: models.ChainICA, ExternalID: externalID, Name: "ICA " + externalID, URLSlug: "ica-" + externalID}
+	if err := db.Create(&store).Error; err != nil {
+		t.Fatal(err)
+	}
+	return store.ID
+}
+
+// testWeek is the validity period of the test offers; it includes now.
+var testWeek = struct{ from, to time.Time }{
+	from: time.Now().Add(-48 * time.Hour).Truncate(time.Second).UTC(),
+	to:   time.Now().Add(120 * time.Hour).Truncate(time.Second).UTC(),
+}
+
+// testOffer returns an offer of the store valid this week.
+func testOffer(storeID uint, promotionID, name string, salePrice float64) models.Offer {
+	return models.Offer{
+		StoreID:     &storeID,
+		Source:      "ica",
+		PromotionID: promotionID,
+		StoreName:   fmt.Sprintf("Store %d", storeID),
+		Name:        name,
+		ProductURL:  "https://www.ica.se/erbjudanden/store?id=" + promotionID,
+		Type:        "regular",
+		SalePrice:   salePrice,
+		ValidFrom:   testWeek.from,
+		ValidTo:     testWeek.to,
+	}
+}
+
+func offerNames(offers []models.Offer) []string {
+	names := make([]string, len(offers))
+	for i, offer := range offers {
+		names[i] = offer.Name
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestInsertOffers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	result, err := repo.InsertOffers(ctx, []models.Offer{
+		testOffer(store, "p1", "Kaffe", 39.90),
+		testOffer(store, "p2", "Mjölk", 14.50),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (InsertResult{Inserted: 2}) {
+		t.Errorf("first insert: got %+v, want 2 inserted", result)
+	}
+
+	// The same promotions again update their rows, even under a new name
+	time.Sleep(5 * time.Millisecond)
+	renamed := testOffer(store, "p1", "Bryggkaffe", 35)
+	result, err = repo.InsertOffers(ctx, []models.Offer{renamed, testOffer(store, "p2", "Mjölk", 14.50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (InsertResult{Updated: 2}) {
+		t.Errorf("second insert: got %+v, want 2 updated", result)
+	}
+
+	offers, err := repo.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offerNames(offers), []string{"Bryggkaffe", "Mjölk"}; !slices.Equal(got, want) {
+		t.Fatalf("got offers %v, want %v", got, want)
+	}
+	history, err := repo.GetOfferHistory(ctx, offers[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Errorf("got %d observations of %s, want 2", len(history), offers[0].Name)
+	}
+
+	noPromotion := testOffer(store, "", "Bröd", 20)
+	if _, err := repo.InsertOffers(ctx, []models.Offer{noPromotion}); err == nil {
+		t.Error("an offer without a promotion ID was saved")
+	}
+}
+
+func TestReplaceStoreOffers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+	other := newTestStore(t, db, "1002")
+
+	_, err := repo.InsertOffers(ctx, []models.Offer{
+		testOffer(store, "p1", "Kaffe", 39.90),
+		testOffer(store, "p2", "Mjölk", 14.50),
+		testOffer(store, "p3", "Ost", 89),
+		testOffer(other, "p4", "Smör", 45),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mjölk is gone from the page, Ost is still there but was not saved
+	result, err := repo.ReplaceStoreOffers(ctx, store, []models.Offer{testOffer(store, "p1", "Kaffe", 39.90)}, []string{"p3"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 1 || result.Withdrawn != 1 {
+		t.Errorf("got %+v, want 1 updated and 1 withdrawn", result)
+	}
+	offers, err := repo.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offerNames(offers), []string{"Kaffe", "Ost", "Smör"}; !slices.Equal(got, want) {
+		t.Errorf("advertised after the replace: got %v, want %v", got, want)
+	}
+	latest, err := repo.GetLatestStoreOffers(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offerNames(latest), []string{"Kaffe", "Ost"}; !slices.Equal(got, want) {
+		t.Errorf("latest store offers: got %v, want %v", got, want)
+	}
+
+	// An offer that is back on the page is advertised again
+	_, err = repo.ReplaceStoreOffers(ctx, store, []models.Offer{
+		testOffer(store, "p1", "Kaffe", 39.90),
+		testOffer(store, "p2", "Mjölk", 14.50),
+		testOffer(store, "p3", "Ost", 89),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := repo.CountOffers(ctx); err != nil || count != 4 {
+		t.Errorf("got %d offers (%v), want 4", count, err)
+	}
+	offers, err = repo.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers) != 4 {
+		t.Errorf("got %d advertised offers after the restore, want 4", len(offers))
+	}
+
+	if _, err := repo.ReplaceStoreOffers(ctx, store, []models.Offer{testOffer(other, "p4", "Smör", 45)}, nil, nil); err == nil {
+		t.Error("an offer of another store replaced the store's offers")
+	}
+
+	// A complete scrape where every card was quarantined saves nothing, but still
+	// withdraws the offers that are gone from the page
+	week := []models.ValidityPeriod{{From: testWeek.from, To: testWeek.to}}
+	result, err = repo.ReplaceStoreOffers(ctx, store, nil, []string{"p1"}, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (InsertResult{Withdrawn: 2}) {
+		t.Errorf("got %+v, want 2 withdrawn", result)
+	}
+	offers, err = repo.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offerNames(offers), []string{"Kaffe", "Smör"}; !slices.Equal(got, want) {
+		t.Errorf("advertised after an empty scrape: got %v, want %v", got, want)
+	}
+
+	// An empty page withdraws every offer of the period
+	if result, err = repo.ReplaceStoreOffers(ctx, store, nil, nil, week); err != nil || result.Withdrawn != 1 {
+		t.Errorf("an empty page withdrew %d offers (%v), want 1", result.Withdrawn, err)
+	}
+}
+
+func TestQueryOffersPaging(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	// Several offers share a price, so the pages must break ties by ID
+	prices := []float64{10, 20, 20, 20, 5, 20, 30}
+	var offers []models.Offer
+	for i, price := range prices {
+		offers = append(offers, testOffer(store, fmt.Sprintf("p%d", i), fmt.Sprintf("Vara %d", i), price))
+	}
+	if _, err := repo.InsertOffers(ctx, offers); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, descending := range []bool{false, true} {
+		t.Run(fmt.Sprintf("descending=%t", descending), func(t *testing.T) {
+			q := models.OfferQuery{Sort: models.OfferSortSalePrice, Descending: descending, Limit: 2}
+			var seen []models.Offer
+			for pages := 0; ; pages++ {
+				if pages > len(prices) {
+					t.Fatal("the pages do not end")
+				}
+				page, err := repo.QueryOffers(ctx, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				seen = append(seen, page.Offers...)
+				if page.Next == nil {
+					break
+				}
+				q.After = page.Next
+			}
+
+			if len(seen) != len(prices) {
+				t.Fatalf("got %d offers over all pages, want %d", len(seen), len(prices))
+			}
+			ordered := slices.IsSortedFunc(seen, func(a, b models.Offer) int {
+				order := cmpOffers(a, b)
+				if descending {
+					return -order
+				}
+				return order
+			})
+			if !ordered {
+				t.Errorf("the pages are not in (price, id) order: %v", seen)
+			}
+			ids := make(map[uint]bool)
+			for _, offer := range seen {
+				if ids[offer.ID] {
+					t.Errorf("offer %d is on two pages", offer.ID)
+				}
+				ids[offer.ID] = true
+			}
+		})
+	}
+
+	q := models.OfferQuery{Sort: models.OfferSortDiscount, After: &models.OfferCursor{Sort: models.OfferSortSalePrice}}
+	if _, err := repo.QueryOffers(ctx, q); err == nil {
+		t.Error("a cursor of another sort was accepted")
+	}
+}
+
+func cmpOffers(a, b models.Offer) int {
+	if a.SalePrice != b.SalePrice {
+		if a.SalePrice < b.SalePrice {
+			return -1
+		}
+		return 1
+	}
+	return int(a.ID) - int(b.ID)
+}
+
+func TestSearchOffers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	coffee := testOffer(store, "p1", "Bryggkaffe mellanrost", 39.90)
+	coffee.Brand = "Gevalia"
+	beans := testOffer(store, "p2", "Kaffebönor", 69)
+	beans.Brand = "Zoégas"
+	cream := testOffer(store, "p3", "Kaffegrädde", 15)
+	cream.Brand = "Arla"
+	milk := testOffer(store, "p4", "Mjölk 100%", 14.50)
+	milk.Brand = "Arla_Ko"
+	if _, err := repo.InsertOffers(ctx, []models.Offer{coffee, beans, cream, milk}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := repo.SearchOffers(ctx, "kaffe", models.OfferQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results for kaffe, want 3", len(results))
+	}
+	highlights := map[string]string{
+		"Bryggkaffe mellanrost": "Brygg<mark>kaffe</mark> mellanrost",
+		"Kaffebönor":            "<mark>Kaffe</mark>bönor",
+	}
+	for _, result := range results {
+		if want, ok := highlights[result.Name]; ok && result.Highlight != want {
+			t.Errorf("got highlight %q, want %q", result.Highlight, want)
+		}
+	}
+
+	// A word in the brand ranks below a word in the name
+	results, err = repo.SearchOffers(ctx, "arla", models.OfferQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Rank != 0.5 {
+		t.Errorf("got %d results for arla ranked %v, want 2 ranked 0.5", len(results), results)
+	}
+
+	// Filters apply to the search, and LIKE wildcards in the text are literal
+	maxPrice := 20.0
+	results, err = repo.SearchOffers(ctx, "kaffe", models.OfferQuery{MaxPrice: &maxPrice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "Kaffegrädde" {
+		t.Errorf("got %v for kaffe under 20 kr, want Kaffegrädde", results)
+	}
+	results, err = repo.SearchOffers(ctx, "100%", models.OfferQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "Mjölk 100%" {
+		t.Errorf("got %v for 100%%, want Mjölk 100%%", results)
+	}
+}
+
+func TestOfferCategories(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	categories := NewPostgresCategoryRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	err := categories.SyncTaxonomy(ctx, []models.TaxonomyCategory{
+		{ID: "mejeri", LabelSV: "Mejeri"},
+		{ID: "mejeri.ost", Parent: "mejeri", LabelSV: "Ost"},
+		{ID: "dryck", LabelSV: "Dryck"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cheese := testOffer(store, "p1", "Hushållsost", 89)
+	cheese.Categories = []string{"mejeri.ost", "mejeri"}
+	cheese.CategorySource = models.CategorySourceRule
+	juice := testOffer(store, "p2", "Apelsinjuice", 25)
+	juice.Categories = []string{"dryck", "frukost"}
+	if _, err := repo.InsertOffers(ctx, []models.Offer{cheese, juice}); err != nil {
+		t.Fatal(err)
+	}
+
+	offers, err := repo.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, offer := range offers {
+		got[offer.Name] = offer.Categories
+	}
+	if want := []string{"mejeri", "mejeri.ost"}; !slices.Equal(got["Hushållsost"], want) {
+		t.Errorf("got categories %v for the cheese, want %v", got["Hushållsost"], want)
+	}
+	// A category missing from the taxonomy is added on the fly
+	if want := []string{"dryck", "frukost"}; !slices.Equal(got["Apelsinjuice"], want) {
+		t.Errorf("got categories %v for the juice, want %v", got["Apelsinjuice"], want)
+	}
+	var sources []string
+	if err := db.Model(&models.OfferCategory{}).Distinct().Order("source").Pluck("source", &sources).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{models.CategorySourceLegacy, models.CategorySourceRule}; !slices.Equal(sources, want) {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+
+	// A parent category matches the offers of its subcategories
+	page, err := repo.QueryOffers(ctx, models.OfferQuery{Categories: []string{"mejeri"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offerNames(page.Offers); !slices.Equal(got, []string{"Hushållsost"}) {
+		t.Errorf("got %v in mejeri, want the cheese", got)
+	}
+
+	// Saving an offer again replaces its categories
+	juice.Categories = []string{"dryck"}
+	if _, err := repo.InsertOffers(ctx, []models.Offer{juice}); err != nil {
+		t.Fatal(err)
+	}
+	page, err = repo.QueryOffers(ctx, models.OfferQuery{Categories: []string{"frukost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Offers) != 0 {
+		t.Errorf("got %v in frukost after the juice left it", offerNames(page.Offers))
+	}
+
+	counts, err := categories.CountOffers(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]int64)
+	for _, count := range counts {
+		totals[count.Key] = count.TotalOffers
+	}
+	if totals["mejeri"] != 1 || totals["mejeri.ost"] != 1 || totals["dryck"] != 1 || totals["frukost"] != 0 {
+		t.Errorf("got category totals %v", totals)
+	}
+}
+
+func TestCategoryCache(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	cache := NewPostgresCategoryCacheRepository(db)
+
+	confidence := 0.75
+	err := cache.SaveCachedCategories(ctx, []models.ProductCategory{
+		{NormalizedName: "kaffe", Categories: models.StringArray{"dryck.kaffe-te"}, Source: models.CategorySourceAI, Confidence: &confidence},
+		{NormalizedName: "ost", Categories: models.StringArray{"mejeri.ost"}, Source: models.CategorySourceRule},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := cache.GetCachedCategories(ctx, []string{"kaffe", "ost", "mjölk"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 2 {
+		t.Fatalf("got %d cache entries, want 2", len(cached))
+	}
+	coffee := cached["kaffe"]
+	if !slices.Equal(coffee.Categories, models.StringArray{"dryck.kaffe-te"}) || coffee.Source != models.CategorySourceAI ||
+		coffee.Confidence == nil || *coffee.Confidence != confidence {
+		t.Errorf("got cache entry %+v for kaffe", coffee)
+	}
+
+	// Saving again overwrites the entry and refreshes it
+	err = cache.SaveCachedCategories(ctx, []models.ProductCategory{
+		{NormalizedName: "ost", Categories: models.StringArray{"mejeri", "mejeri.ost"}, Source: models.CategorySourceManual},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err = cache.GetCachedCategories(ctx, []string{"ost"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cached["ost"]; len(got.Categories) != 2 || got.Source != models.CategorySourceManual {
+		t.Errorf("got cache entry %+v for ost after the update", got)
+	}
+
+	removed, err := cache.InvalidateCachedCategories(ctx, []string{"kaffe"})
+	if err != nil || removed != 1 {
+		t.Errorf("invalidated %d entries (%v), want 1", removed, err)
+	}
+}
+
+func TestQueryOffersBrand(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	var offers []models.Offer
+	for i, brand := range []string{"Arla_Ko", "ArlaXKo", "Arla"} {
+		offer := testOffer(store, fmt.Sprintf("p%d", i), "Mjölk "+brand, 15)
+		offer.Brand = brand
+		offers = append(offers, offer)
+	}
+	if _, err := repo.InsertOffers(ctx, offers); err != nil {
+		t.Fatal(err)
+	}
+
+	// The brand matches whole and case-insensitively; LIKE wildcards are literal
+	for brand, want := range map[string][]string{
+		"arla_ko": {"Mjölk Arla_Ko"},
+		"ARLA":    {"Mjölk Arla"},
+		"%":       {},
+		"Arla%":   {},
+	} {
+		page, err := repo.QueryOffers(ctx, models.OfferQuery{Brand: brand})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := offerNames(page.Offers); !slices.Equal(got, want) {
+			t.Errorf("brand %q: got %v, want %v", brand, got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// effectivePriceSQL is the price of a single unit for every offer type.
+const effectivePriceSQL = `CASE type
+	WHEN 'multibuy' THEN sale_price_total / NULLIF(sale_quantity, 0)
+	WHEN 'percentage' THEN NULLIF(original_price, 0) * (100 - discount) / 100
+	ELSE NULLIF(sale_price, 0)
+END`
+
+// ProductRepository defines the interface for canonical products and their identity keys.
+type ProductRepository interface {
+	ResolveProduct(ctx context.Context, identity models.ProductIdentity) (uint, error)
+	GetProduct(ctx context.Context, id uint) (*models.Product, error)
+	FindProducts(ctx context.Context, name string) ([]models.Product, error)
+	ListProductKeys(ctx context.Context, productID uint) ([]string, error)
+	MergeProducts(ctx context.Context, fromID, intoID uint, reason string) error
+	SplitProductKey(ctx context.Context, key, reason string) (*models.Product, error)
+	CheapestOffers(ctx context.Context, productID uint, at time.Time) ([]models.Offer, error)
+}
+
+// PostgresProductRepository implements ProductRepository for PostgreSQL using GORM.
+type PostgresProductRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresProductRepository creates a new instance.
+func NewPostgresProductRepository(db *gorm.DB) *PostgresProductRepository {
+	return &PostgresProductRepository{
+		db: db,
+	}
+}
+
+// ResolveProduct returns the product ID for an identity key: a manual override wins,
+// then a known key, otherwise a new product is created and the key registered.
+func (r *PostgresProductRepository) ResolveProduct(ctx context.Context, identity models.ProductIdentity) (uint, error) {
+	var productID uint
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var override models.ProductOverride
+		err := tx.Where("key = ?", identity.Key).First(&override).Error
+		if err == nil {
+			productID = override.ProductID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var key models.ProductKey
+		err = tx.Where("key = ?", identity.Key).First(&key).Error
+		if err == nil {
+			productID = key.ProductID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Another store may register the same key concurrently, so insert the key
+		// with DO NOTHING and read back whichever product won.
+		product := productFromIdentity(identity)
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ProductKey{Key: identity.Key, ProductID: product.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Unscoped().Delete(&product).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("key = ?", identity.Key).First(&key).Error; err != nil {
+				return err
+			}
+			productID = key.ProductID
+			return nil
+		}
+		productID = product.ID
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve product for key %q: %w", identity.Key, err)
+	}
+	return productID, nil
+}
+
+// GetProduct returns a single product by ID.
+func (r *PostgresProductRepository) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	var product models.Product
+	if err := r.db.WithContext(ctx).First(&product, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve product %d: %w", id, err)
+	}
+	return &product, nil
+}
+
+// FindProducts returns products whose canonical name or brand contains the given text.
+func (r *PostgresProductRepository) FindProducts(ctx context.Context, name string) ([]models.Product, error) {
+	var products []models.Product
+	pattern := likePattern(name)
+	result := r.db.WithContext(ctx).
+		Where(`LOWER(canonical_name) LIKE LOWER(?) ESCAPE '\' OR LOWER(brand) LIKE LOWER(?) ESCAPE '\'`, pattern, pattern).
+		Order("canonical_name").Limit(100).Find(&products)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find products: %w", result.Error)
+	}
+	return products, nil
+}
+
+// ListProductKeys returns the identity keys that currently resolve to a product.
+func (r *PostgresProductRepository) ListProductKeys(ctx context.Context, productID uint) ([]string, error) {
+	var keys []string
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT key FROM product_keys
+		WHERE product_id = ? AND key NOT IN (SELECT key FROM product_overrides WHERE deleted_at IS NULL)
+		UNION
+		SELECT key FROM product_overrides WHERE product_id = ? AND deleted_at IS NULL
+		ORDER BY key`, productID, productID).Scan(&keys)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve keys for product %d: %w", productID, result.Error)
+	}
+	return keys, nil
+}
+
+// MergeProducts moves every key and offer of product fromID to intoID and records
+// the decision as overrides, so later scrapes keep matching into the merged product.
+func (r *PostgresProductRepository) MergeProducts(ctx context.Context, fromID, intoID uint, reason string) error {
+	if fromID == intoID {
+		return fmt.Errorf("cannot merge product %d into itself", fromID)
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Product{}, intoID).Error; err != nil {
+			return fmt.Errorf("target product %d: %w", intoID, err)
+		}
+
+		var keys []string
+		if err := tx.Model(&models.ProductKey{}).Where("product_id = ?", fromID).Pluck("key", &keys).Error; err != nil {
+			return err
+		}
+		var overridden []string
+		if err := tx.Model(&models.ProductOverride{}).Where("product_id = ?", fromID).Pluck("key", &overridden).Error; err != nil {
+			return err
+		}
+		keys = append(keys, overridden...)
+
+		for _, key := range keys {
+			override := models.ProductOverride{Key: key, ProductID: intoID, Action: models.ProductOverrideMerge, Reason: reason}
+			if err := upsertOverride(tx, &override); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.ProductKey{}).Where("product_id = ?", fromID).Update("product_id", intoID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Offer{}).Where("product_id = ?", fromID).Update("product_id", intoID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Product{}, fromID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge product %d into %d: %w", fromID, intoID, err)
+	}
+	return nil
+}
+
+// SplitProductKey detaches an identity key from its current product into a new
+// product of its own, and re-points the offers that were matched on that key.
+func (r *PostgresProductRepository) SplitProductKey(ctx context.Context, key, reason string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		currentID, err := currentProductID(tx, key)
+		if err != nil {
+			return err
+		}
+		var source models.Product
+		if err := tx.Unscoped().First(&source, currentID).Error; err != nil {
+			return err
+		}
+
+		product = models.Product{
+			CanonicalName: source.CanonicalName,
+			Brand:         source.Brand,
+			Size:          source.Size,
+			Unit:          source.Unit,
+		}
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+
+		override := models.ProductOverride{Key: key, ProductID: product.ID, Action: models.ProductOverrideSplit, Reason: reason}
+		if err := upsertOverride(tx, &override); err != nil {
+			return err
+		}
+		return tx.Model(&models.Offer{}).Where("product_key = ?", key).Update("product_id", product.ID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to split product key %q: %w", key, err)
+	}
+	return &product, nil
+}
+
+// CheapestOffers returns the offers for a product that are advertised at the given
+// time, cheapest unit price first.
+func (r *PostgresProductRepository) CheapestOffers(ctx context.Context, productID uint, at time.Time) ([]models.Offer, error) {
+	var offers []models.Offer
+	result := r.db.WithContext(ctx).
+		Where("product_id = ?", productID).Where(advertisedAt, at, at, at).
+		Order(clause.Expr{SQL: effectivePriceSQL + " ASC NULLS LAST"}).
+		Find(&offers)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve offers for product %d: %w", productID, result.Error)
+	}
+	if err := loadOfferCategories(r.db.WithContext(ctx), offerPointers(offers)); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// currentProductID returns the product an identity key resolves to. Like
+// ResolveProduct an override wins, and a key may only be known by its override.
+func currentProductID(tx *gorm.DB, key string) (uint, error) {
+	var override models.ProductOverride
+	err := tx.Where("key = ?", key).First(&override).Error
+	if err == nil {
+		return override.ProductID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	var current models.ProductKey
+	if err := tx.Where("key = ?", key).First(&current).Error; err != nil {
+		return 0, fmt.Errorf("unknown product key %q: %w", key, err)
+	}
+	return current.ProductID, nil
+}
+
+func upsertOverride(tx *gorm.DB, override *models.ProductOverride) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "deleted_at", "product_id", "action", "reason"}),
+	}).Create(override).Error
+}
+
+func productFromIdentity(identity models.ProductIdentity) models.Product {
+	return models.Product{
+		CanonicalName: identity.CanonicalName,
+		Brand:         identity.Brand,
+		Size:          identity.Size,
+		Unit:          identity.Unit,
+		EAN:           identity.EAN,
+	}
+}
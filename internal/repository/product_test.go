@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestSplitProductKey(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresProductRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	resolve := func(key, name string) uint {
+		t.Helper()
+		id, err := repo.ResolveProduct(ctx, models.ProductIdentity{Key: key, CanonicalName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	coffeeKey := "name:kaffe|brand:gevalia|size:450g"
+	coffee := resolve(coffeeKey, "kaffe")
+	milk := resolve("name:mellanmjölk|brand:arla|size:1500ml", "mellanmjölk")
+
+	// A key known only by its override, e.g. one merged in by hand before it was scraped
+	override := models.ProductOverride{Key: "ean:7310050001234", ProductID: coffee, Action: models.ProductOverrideMerge}
+	if err := db.Create(&override).Error; err != nil {
+		t.Fatal(err)
+	}
+	offer := testOffer(store, "p1", "Bryggkaffe", 39.90)
+	offer.ProductKey, offer.ProductID = override.Key, &coffee
+	if err := db.Create(&offer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	split, err := repo.SplitProductKey(ctx, override.Key, "own product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if split.ID == coffee || split.CanonicalName != "kaffe" {
+		t.Errorf("split into %+v, want a new copy of product %d", split, coffee)
+	}
+	if got := resolve(override.Key, ""); got != split.ID {
+		t.Errorf("the key resolves to product %d, want %d", got, split.ID)
+	}
+	if err := db.First(&offer, offer.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if offer.ProductID == nil || *offer.ProductID != split.ID {
+		t.Errorf("the offer belongs to product %v, want %d", offer.ProductID, split.ID)
+	}
+	keys, err := repo.ListProductKeys(ctx, coffee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{coffeeKey}; !slices.Equal(keys, want) {
+		t.Errorf("product %d keeps the keys %v, want %v", coffee, keys, want)
+	}
+
+	// A key whose override points elsewhere is split off the overriding product
+	if err := repo.MergeProducts(ctx, split.ID, milk, "same milk"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := repo.SplitProductKey(ctx, override.Key, "not milk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.CanonicalName != "mellanmjölk" {
+		t.Errorf("split a copy of %q, want one of the merged product", again.CanonicalName)
+	}
+
+	// A deleted override no longer decides the product, and a new split restores one
+	if err := db.Where("key = ?", override.Key).Delete(&models.ProductOverride{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SplitProductKey(ctx, override.Key, ""); err == nil {
+		t.Error("a key without a product key or override was split")
+	}
+	if _, err := repo.SplitProductKey(ctx, coffeeKey, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("key = ?", coffeeKey).Delete(&models.ProductOverride{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	restored, err := repo.SplitProductKey(ctx, coffeeKey, "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resolve(coffeeKey, ""); got != restored.ID {
+		t.Errorf("the key resolves to product %d after the split, want %d", got, restored.ID)
+	}
+}
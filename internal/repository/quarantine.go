@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuarantineRepository defines the interface for persisting offers that failed validation.
+type QuarantineRepository interface {
+	QuarantineOffers(ctx context.Context, offers []models.QuarantinedOffer) (int, error)
+	ListQuarantined(ctx context.Context, status string) ([]models.QuarantinedOffer, error)
+	GetQuarantined(ctx context.Context, id uint) (*models.QuarantinedOffer, error)
+	UpdateQuarantined(ctx context.Context, offer *models.QuarantinedOffer) error
+}
+
+// PostgresQuarantineRepository implements QuarantineRepository for PostgreSQL using GORM.
+type PostgresQuarantineRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresQuarantineRepository creates a new instance.
+func NewPostgresQuarantineRepository(db *gorm.DB) *PostgresQuarantineRepository {
+	return &PostgresQuarantineRepository{
+		db: db,
+	}
+}
+
+// quarantineChanged is true when a card quarantined again differs from its row in the
+// raw card text or in the rule it failed. Fixes made during review do not count.
+const quarantineChanged = `(quarantined_offers.rule IS DISTINCT FROM excluded.rule
+	OR quarantined_offers.raw_original_text IS DISTINCT FROM excluded.raw_original_text
+	OR quarantined_offers.raw_deal_text IS DISTINCT FROM excluded.raw_deal_text)`
+
+// quarantinedData are the columns a changed card overwrites.
+var quarantinedData = []string{
+	"name", "product_url", "type", "original_price", "sale_price", "sale_quantity", "sale_price_total",
+	"discount", "discount_percentage", "raw_original_text", "raw_deal_text", "rule", "reason",
+}
+
+// pendingReview matches the offers whose identity is quarantined and waiting for review.
+const pendingReview = `EXISTS (SELECT 1 FROM quarantined_offers q
+	WHERE q.store_id = offers.store_id AND q.source = offers.source AND q.promotion_id = offers.promotion_id
+		AND q.valid_from = offers.valid_from AND q.valid_to = offers.valid_to
+		AND q.status = ? AND q.deleted_at IS NULL)`
+
+// QuarantineOffers upserts failed offers, identified like offers by their store,
+// source, promotion ID and validity period. A row that is quarantined again on a
+// later scrape with the same card text and rule keeps its data, which may have been
+// fixed, and its review status. A changed card replaces the data and goes back to
+// pending review, even if the row was released or discarded.
+//
+// An offer saved by an earlier scrape is withdrawn while its identity waits for
+// review, so the offers table only shows clean data. Releasing the quarantined
+// offer saves it again, which ends the withdrawal.
+func (r *PostgresQuarantineRepository) QuarantineOffers(ctx context.Context, offers []models.QuarantinedOffer) (int, error) {
+	if len(offers) == 0 {
+		return 0, nil
+	}
+	var storeIDs []uint
+	for _, offer := range offers {
+		if offer.StoreID != nil && !slices.Contains(storeIDs, *offer.StoreID) {
+			storeIDs = append(storeIDs, *offer.StoreID)
+		}
+	}
+	updates := clause.AssignmentColumns([]string{"updated_at", "store_name"})
+	for _, column := range quarantinedData {
+		updates = append(updates, clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr("CASE WHEN " + quarantineChanged + " THEN excluded." + column + " ELSE quarantined_offers." + column + " END"),
+		})
+	}
+	updates = append(updates,
+		clause.Assignment{
+			Column: clause.Column{Name: "status"},
+			Value:  gorm.Expr("CASE WHEN "+quarantineChanged+" THEN ? ELSE quarantined_offers.status END", models.QuarantineStatusPending),
+		},
+		clause.Assignment{
+			Column: clause.Column{Name: "released_at"},
+			Value:  gorm.Expr("CASE WHEN " + quarantineChanged + " THEN NULL ELSE quarantined_offers.released_at END"),
+		},
+	)
+	var count int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "store_id"}, {Name: "source"}, {Name: "promotion_id"}, {Name: "valid_from"}, {Name: "valid_to"}},
+			DoUpdates: updates,
+		}).CreateInBatches(&offers, 100)
+		if result.Error != nil {
+			return fmt.Errorf("gorm quarantine upsert failed: %w", result.Error)
+		}
+		count = int(result.RowsAffected)
+
+		if len(storeIDs) == 0 {
+			return nil
+		}
+		result = tx.Model(&models.Offer{}).
+			Where("store_id IN ? AND withdrawn_at IS NULL", storeIDs).
+			Where(pendingReview, models.QuarantineStatusPending).
+			Update("withdrawn_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to withdraw quarantined offers: %w", result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ListQuarantined returns quarantined offers, optionally filtered by status.
+func (r *PostgresQuarantineRepository) ListQuarantined(ctx context.Context, status string) ([]models.QuarantinedOffer, error) {
+	var offers []models.QuarantinedOffer
+	query := r.db.WithContext(ctx).Order("store_name, name")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&offers).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve quarantined offers: %w", err)
+	}
+	return offers, nil
+}
+
+// GetQuarantined returns a single quarantined offer by ID.
+func (r *PostgresQuarantineRepository) GetQuarantined(ctx context.Context, id uint) (*models.QuarantinedOffer, error) {
+	var offer models.QuarantinedOffer
+	if err := r.db.WithContext(ctx).First(&offer, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve quarantined offer %d: %w", id, err)
+	}
+	return &offer, nil
+}
+
+// UpdateQuarantined saves all fields of a quarantined offer.
+func (r *PostgresQuarantineRepository) UpdateQuarantined(ctx context.Context, offer *models.QuarantinedOffer) error {
+	if err := r.db.WithContext(ctx).Save(offer).Error; err != nil {
+		return fmt.Errorf("failed to update quarantined offer %d: %w", offer.ID, err)
+	}
+	return nil
+}
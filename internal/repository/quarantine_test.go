@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestQuarantineOffers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresQuarantineRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	quarantine := func(offers ...models.Offer) {
+		t.Helper()
+		rows := make([]models.QuarantinedOffer, len(offers))
+		for i, offer := range offers {
+			rows[i] = models.NewQuarantinedOffer(offer, offer.Name+". 450 g.", "39,90 kr", "positive_sale_price", "sale price is 0")
+		}
+		if _, err := repo.QuarantineOffers(ctx, rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Two cards with the same title are different promotions
+	quarantine(testOffer(store, "p1", "Kaffe", 0), testOffer(store, "p2", "Kaffe", 0))
+	// A card renamed on a later scrape is the same promotion
+	quarantine(testOffer(store, "p1", "Bryggkaffe", 0))
+
+	rows, err := repo.ListQuarantined(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d quarantined offers, want 2", len(rows))
+	}
+	names := map[string]string{}
+	for _, row := range rows {
+		names[row.PromotionID] = row.Name
+	}
+	if names["p1"] != "Bryggkaffe" || names["p2"] != "Kaffe" {
+		t.Errorf("got quarantined offers %v", names)
+	}
+}
+
+func TestQuarantineOffersReview(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresQuarantineRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	quarantine := func(rule, dealText string) models.QuarantinedOffer {
+		t.Helper()
+		row := models.NewQuarantinedOffer(testOffer(store, "p1", "Kaffe", 0), "Kaffe. 450 g.", dealText, rule, "failed "+rule)
+		if _, err := repo.QuarantineOffers(ctx, []models.QuarantinedOffer{row}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := repo.ListQuarantined(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("got %d quarantined offers, want 1", len(rows))
+		}
+		return rows[0]
+	}
+
+	row := quarantine("positive_sale_price", "kr")
+	// A reviewer fixes the price and releases the offer
+	row.SalePrice = 39.90
+	row.Status = models.QuarantineStatusReleased
+	if err := repo.UpdateQuarantined(ctx, &row); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same card fails the same way: the review stands
+	row = quarantine("positive_sale_price", "kr")
+	if row.Status != models.QuarantineStatusReleased || row.SalePrice != 39.90 {
+		t.Errorf("an unchanged card reset the review: status %s, sale price %v", row.Status, row.SalePrice)
+	}
+
+	// The card text changed: the row is reviewed again with the new data
+	row = quarantine("positive_sale_price", "0 kr")
+	if row.Status != models.QuarantineStatusPending || row.SalePrice != 0 || row.RawDealText != "0 kr" {
+		t.Errorf("a changed card kept the review: status %s, sale price %v, deal text %q", row.Status, row.SalePrice, row.RawDealText)
+	}
+
+	row.Status = models.QuarantineStatusDiscarded
+	if err := repo.UpdateQuarantined(ctx, &row); err != nil {
+		t.Fatal(err)
+	}
+	// The card now fails another rule
+	row = quarantine("name_required", "0 kr")
+	if row.Status != models.QuarantineStatusPending || row.Rule != "name_required" || row.Reason != "failed name_required" {
+		t.Errorf("a new rule kept the review: status %s, rule %s, reason %q", row.Status, row.Rule, row.Reason)
+	}
+}
+
+func TestQuarantineWithdrawsOffer(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresQuarantineRepository(db)
+	offers := NewOfferRepository(db)
+	store := newTestStore(t, db, "1001")
+
+	advertised := func() []string {
+		t.Helper()
+		all, err := offers.GetAllOffers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return offerNames(all)
+	}
+	quarantine := func() models.QuarantinedOffer {
+		t.Helper()
+		row := models.NewQuarantinedOffer(testOffer(store, "p1", "Kaffe", 0), "Kaffe. 450 g.", "kr", "positive_sale_price", "sale price is 0")
+		if _, err := repo.QuarantineOffers(ctx, []models.QuarantinedOffer{row}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := repo.ListQuarantined(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows[0]
+	}
+
+	// Clean on the first scrape
+	if _, err := offers.InsertOffers(ctx, []models.Offer{testOffer(store, "p1", "Kaffe", 39.90), testOffer(store, "p2", "Mjölk", 14.50)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quarantined on the next one: the old price is no longer shown
+	row := quarantine()
+	if got, want := advertised(), []string{"Mjölk"}; !slices.Equal(got, want) {
+		t.Fatalf("got offers %v while Kaffe is quarantined, want %v", got, want)
+	}
+
+	// Released with a fixed price, as QuarantineService.Release does
+	row.SalePrice = 35
+	if _, err := offers.InsertOffers(ctx, []models.Offer{row.ToOffer()}); err != nil {
+		t.Fatal(err)
+	}
+	row.Status = models.QuarantineStatusReleased
+	if err := repo.UpdateQuarantined(ctx, &row); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := advertised(), []string{"Kaffe", "Mjölk"}; !slices.Equal(got, want) {
+		t.Fatalf("got offers %v after the release, want %v", got, want)
+	}
+
+	// The same card quarantined again keeps its release and its offer
+	quarantine()
+	all, err := offers.GetAllOffers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offerNames(all), []string{"Kaffe", "Mjölk"}; !slices.Equal(got, want) {
+		t.Fatalf("got offers %v after an unchanged card, want %v", got, want)
+	}
+	for _, offer := range all {
+		if offer.Name == "Kaffe" && offer.SalePrice != 35 {
+			t.Errorf("Kaffe costs %v, want the released price 35", offer.SalePrice)
+		}
+	}
+}
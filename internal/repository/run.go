@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ScrapeRunRepository records parser runs and the outcome of every store.
+type ScrapeRunRepository interface {
+	// StartRun saves a new run and sets its ID
+	StartRun(ctx context.Context, run *models.ScrapeRun) error
+	// FinishRun saves the final status of a run
+	FinishRun(ctx context.Context, run *models.ScrapeRun) error
+	// SaveRunStore saves the outcome of a store in a run
+	SaveRunStore(ctx context.Context, store *models.ScrapeRunStore) error
+	// ListRuns returns the most recent runs first, with their stores
+	ListRuns(ctx context.Context, limit int) ([]models.ScrapeRun, error)
+	// GetRun returns a run with its stores
+	GetRun(ctx context.Context, id uint) (*models.ScrapeRun, error)
+	// LastSuccessfulStoreRuns returns the latest successful scrape of every store, keyed by store ID
+	LastSuccessfulStoreRuns(ctx context.Context) (map[uint]models.ScrapeRunStore, error)
+}
+
+// PostgresScrapeRunRepository implements ScrapeRunRepository for PostgreSQL using GORM.
+type PostgresScrapeRunRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresScrapeRunRepository creates a new instance.
+func NewPostgresScrapeRunRepository(db *gorm.DB) *PostgresScrapeRunRepository {
+	return &PostgresScrapeRunRepository{
+		db: db,
+	}
+}
+
+// StartRun inserts the run.
+func (r *PostgresScrapeRunRepository) StartRun(ctx context.Context, run *models.ScrapeRun) error {
+	if err := r.db.WithContext(ctx).Omit("Stores").Create(run).Error; err != nil {
+		return fmt.Errorf("failed to save scrape run: %w", err)
+	}
+	return nil
+}
+
+// FinishRun updates the status, end time and error of the run.
+func (r *PostgresScrapeRunRepository) FinishRun(ctx context.Context, run *models.ScrapeRun) error {
+	result := r.db.WithContext(ctx).Model(run).Select("FinishedAt", "Status", "Error").Updates(run)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update scrape run %d: %w", run.ID, result.Error)
+	}
+	return nil
+}
+
+// SaveRunStore inserts the outcome of a store.
+func (r *PostgresScrapeRunRepository) SaveRunStore(ctx context.Context, store *models.ScrapeRunStore) error {
+	if err := r.db.WithContext(ctx).Create(store).Error; err != nil {
+		return fmt.Errorf("failed to save scrape result of %s: %w", store.StoreName, err)
+	}
+	return nil
+}
+
+// ListRuns returns the latest runs with their stores.
+func (r *PostgresScrapeRunRepository) ListRuns(ctx context.Context, limit int) ([]models.ScrapeRun, error) {
+	var runs []models.ScrapeRun
+	query := r.db.WithContext(ctx).Preload("Stores", func(db *gorm.DB) *gorm.DB {
+		return db.Order("store_name")
+	}).Order("started_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list scrape runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetRun returns a single run with its stores.
+func (r *PostgresScrapeRunRepository) GetRun(ctx context.Context, id uint) (*models.ScrapeRun, error) {
+	var run models.ScrapeRun
+	err := r.db.WithContext(ctx).Preload("Stores", func(db *gorm.DB) *gorm.DB {
+		return db.Order("store_name")
+	}).First(&run, id).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve scrape run %d: %w", id, err)
+	}
+	return &run, nil
+}
+
+// LastSuccessfulStoreRuns returns the most recent successful result of every store.
+// Stores are told apart by ID, so a renamed store keeps its history.
+func (r *PostgresScrapeRunRepository) LastSuccessfulStoreRuns(ctx context.Context) (map[uint]models.ScrapeRunStore, error) {
+	rows, err := lastSuccessfulStoreRuns(r.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[uint]models.ScrapeRunStore, len(rows))
+	for _, row := range rows {
+		last[*row.StoreID] = row
+	}
+	return last, nil
+}
+
+// lastSuccessfulStoreRuns returns the latest successful result of every store with an ID.
+func lastSuccessfulStoreRuns(db *gorm.DB) ([]models.ScrapeRunStore, error) {
+	var rows []models.ScrapeRunStore
+	err := db.Raw(`SELECT * FROM scrape_run_stores s
+			WHERE store_id IS NOT NULL AND status = ? AND finished_at = (
+				SELECT MAX(finished_at) FROM scrape_run_stores
+				WHERE store_id = s.store_id AND status = s.status
+			)`, models.ScrapeRunSucceeded).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the last successful scrapes: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"testing"
+	"time"
+)
+
+func TestLastSuccessfulStoreRuns(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewPostgresScrapeRunRepository(db)
+	store := newTestStore(t, db, "1001")
+	other := newTestStore(t, db, "1002")
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	save := func(storeID uint, name, status string, finished time.Duration) {
+		t.Helper()
+		run := models.ScrapeRun{StartedAt: start, Status: models.ScrapeRunSucceeded}
+		if err := repo.StartRun(ctx, &run); err != nil {
+			t.Fatal(err)
+		}
+		result := models.ScrapeRunStore{RunID: run.ID, StoreID: &storeID, StoreName: name, Status: status,
+			StartedAt: start, FinishedAt: start.Add(finished)}
+		if err := repo.SaveRunStore(ctx, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(store, "ICA Nära Kalmar", models.ScrapeRunSucceeded, time.Minute)
+	// The store was renamed in config.yaml before the next runs
+	save(store, "ICA Supermarket Kalmar", models.ScrapeRunSucceeded, 2*time.Minute)
+	save(store, "ICA Supermarket Kalmar", models.ScrapeRunFailed, 3*time.Minute)
+	save(other, "ICA Kvantum", models.ScrapeRunSucceeded, time.Minute)
+
+	last, err := repo.LastSuccessfulStoreRuns(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 {
+		t.Fatalf("got the last runs of %d stores, want 2: %+v", len(last), last)
+	}
+	if run := last[store]; run.StoreName != "ICA Supermarket Kalmar" || !run.FinishedAt.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("the last successful run of the renamed store is %+v", run)
+	}
+	if run := last[other]; run.StoreName != "ICA Kvantum" {
+		t.Errorf("the last successful run of the other store is %+v", run)
+	}
+
+	summaries, err := NewPostgresStoreRepository(db).ListStoreSummaries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, summary := range summaries {
+		if summary.ID == store && (summary.LastScrapedAt == nil || !summary.LastScrapedAt.Equal(start.Add(2*time.Minute))) {
+			t.Errorf("the store summary was last scraped at %v", summary.LastScrapedAt)
+		}
+	}
+}
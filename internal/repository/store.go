@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StoreLookup is a source of store metadata that can be searched by name, city or
+// postal code. It is pluggable so tests can use a local fixture instead of the network.
+type StoreLookup interface {
+	SearchStores(ctx context.Context, query string) ([]models.StoreInfo, error)
+}
+
+// jsonStoreLookup searches a local JSON file holding an array of stores.
+type jsonStoreLookup struct {
+	path string
+}
+
+// NewJSONStoreLookup creates a lookup backed by a JSON file, e.g. an export of the
+// search endpoint or a test fixture.
+func NewJSONStoreLookup(path string) StoreLookup {
+	return &jsonStoreLookup{path: path}
+}
+
+func (l *jsonStoreLookup) SearchStores(ctx context.Context, query string) ([]models.StoreInfo, error) {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store fixture %s: %w", l.path, err)
+	}
+	var stores []models.StoreInfo
+	if err := json.Unmarshal(data, &stores); err != nil {
+		return nil, fmt.Errorf("failed to decode store fixture %s: %w", l.path, err)
+	}
+
+	var matches []models.StoreInfo
+	for _, store := range stores {
+		if storeMatches(store, query) {
+			matches = append(matches, store)
+		}
+	}
+	return matches, nil
+}
+
+// storeMatches reports whether every word of the query appears in the store's
+// name, city, postal code or external ID.
+func storeMatches(store models.StoreInfo, query string) bool {
+	haystack := strings.ToLower(strings.Join([]string{
+		store.Name, store.City, strings.ReplaceAll(store.PostalCode, " ", ""), store.ExternalID,
+	}, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// httpStoreLookup queries an HTTP endpoint that answers ?q=<query> with a JSON
+// array in the same format as the fixture file.
+type httpStoreLookup struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPStoreLookup creates a lookup backed by a JSON search endpoint.
+func NewHTTPStoreLookup(endpoint string) StoreLookup {
+	return &httpStoreLookup{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (l *httpStoreLookup) SearchStores(ctx context.Context, query string) ([]models.StoreInfo, error) {
+	u, err := url.Parse(l.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store lookup endpoint %q: %w", l.endpoint, err)
+	}
+	params := u.Query()
+	params.Set("q", query)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("store lookup request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("store lookup returned %s", resp.Status)
+	}
+
+	var stores []models.StoreInfo
+	if err := json.NewDecoder(resp.Body).Decode(&stores); err != nil {
+		return nil, fmt.Errorf("failed to decode store lookup response: %w", err)
+	}
+	return stores, nil
+}
+
+// StoreRepository defines the interface for persisting store metadata.
+type StoreRepository interface {
+	UpsertStores(ctx context.Context, stores []models.StoreInfo) error
+	// RegisterStores inserts the stores of the scrape list and sets their IDs
+	RegisterStores(ctx context.Context, stores []models.StoreInfo) error
+	ListStores(ctx context.Context) ([]models.StoreInfo, error)
+	// ListStoreSummaries returns every store with its offer counts and last scrape
+	ListStoreSummaries(ctx context.Context) ([]models.StoreSummary, error)
+	GetStore(ctx context.Context, chain, externalID string) (*models.StoreInfo, error)
+}
+
+// PostgresStoreRepository implements StoreRepository for PostgreSQL using GORM.
+type PostgresStoreRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresStoreRepository creates a new instance.
+func NewPostgresStoreRepository(db *gorm.DB) *PostgresStoreRepository {
+	return &PostgresStoreRepository{
+		db: db,
+	}
+}
+
+// UpsertStores inserts stores or refreshes the metadata of known ones.
+func (r *PostgresStoreRepository) UpsertStores(ctx context.Context, stores []models.StoreInfo) error {
+	if len(stores) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain"}, {Name: "external_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"updated_at", "name", "url_slug", "profile", "address", "postal_code", "city",
+			"latitude", "longitude", "opening_hours",
+		}),
+	}).Create(&stores)
+	if result.Error != nil {
+		return fmt.Errorf("gorm store upsert failed: %w", result.Error)
+	}
+	return nil
+}
+
+// RegisterStores inserts stores or updates the name and slug of known ones, leaving
+// the metadata found by store discovery as it is. The IDs are set on the stores.
+func (r *PostgresStoreRepository) RegisterStores(ctx context.Context, stores []models.StoreInfo) error {
+	if len(stores) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain"}, {Name: "external_id"}},
+		// a deleted store that is scraped again is restored
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "deleted_at", "name", "url_slug"}),
+	}).Create(&stores)
+	if result.Error != nil {
+		return fmt.Errorf("failed to register stores: %w", result.Error)
+	}
+	return nil
+}
+
+// ListStores returns every store in the catalogue.
+func (r *PostgresStoreRepository) ListStores(ctx context.Context) ([]models.StoreInfo, error) {
+	var stores []models.StoreInfo
+	if err := r.db.WithContext(ctx).Order("chain, city, name").Find(&stores).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve stores: %w", err)
+	}
+	return stores, nil
+}
+
+// ListStoreSummaries returns every store in the catalogue with the number of its
+// offers, in total and valid now, and the end of its last successful scrape.
+func (r *PostgresStoreRepository) ListStoreSummaries(ctx context.Context) ([]models.StoreSummary, error) {
+	stores, err := r.ListStores(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		StoreID       uint
+		Offers        int64
+		CurrentOffers int64
+	}
+	now := time.Now()
+	err = r.db.WithContext(ctx).Model(&models.Offer{}).
+		Select("store_id, COUNT(*) AS offers, COUNT(CASE WHEN "+advertisedAt+" THEN 1 END) AS current_offers", now, now, now).
+		Where("store_id IS NOT NULL").Group("store_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count offers per store: %w", err)
+	}
+
+	lastRuns, err := lastSuccessfulStoreRuns(r.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.StoreSummary, len(stores))
+	byID := make(map[uint]*models.StoreSummary, len(stores))
+	for i, store := range stores {
+		summaries[i].StoreInfo = store
+		byID[store.ID] = &summaries[i]
+	}
+	for _, count := range counts {
+		if summary, ok := byID[count.StoreID]; ok {
+			summary.Offers, summary.CurrentOffers = count.Offers, count.CurrentOffers
+		}
+	}
+	for _, run := range lastRuns {
+		if summary, ok := byID[*run.StoreID]; ok {
+			finished := run.FinishedAt
+			summary.LastScrapedAt = &finished
+		}
+	}
+	return summaries, nil
+}
+
+// GetStore returns a single store by chain and external ID.
+func (r *PostgresStoreRepository) GetStore(ctx context.Context, chain, externalID string) (*models.StoreInfo, error) {
+	var store models.StoreInfo
+	result := r.db.WithContext(ctx).Where("chain = ? AND external_id = ?", chain, externalID).First(&store)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve store %s/%s: %w", chain, externalID, result.Error)
+	}
+	return &store, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestJSONStoreLookup(t *testing.T) {
+	lookup := NewJSONStoreLookup("testdata/ica_stores.json")
+
+	tests := []struct {
+		query string
+		want  []string // external IDs
+	}{
+		{query: "kalmar", want: []string{"1004348", "1003977"}},
+		{query: "KALMAR maxi", want: []string{"1004348"}},
+		{query: "smedby", want: []string{"1003977"}},
+		{query: "392 30", want: nil},
+		{query: "35230", want: []string{"1000001"}},
+		{query: "växjö", want: []string{"1000001"}},
+		{query: "1000001", want: []string{"1000001"}},
+		{query: "", want: []string{"1004348", "1003977", "1000001"}},
+		{query: "stockholm", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stores, err := lookup.SearchStores(context.Background(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, store := range stores {
+				got = append(got, store.ExternalID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SearchStores(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	stores, err := lookup.SearchStores(context.Background(), "stormarknad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stores) != 1 {
+		t.Fatalf("got %d stores for stormarknad, want 1", len(stores))
+	}
+	store := stores[0]
+	if store.Chain != "ICA" || store.URLSlug != "maxi-ica-stormarknad-kalmar-1004348" || store.Latitude == 0 {
+		t.Errorf("the store was not decoded: %+v", store)
+	}
+	if len(store.OpeningHours) != 7 || store.OpeningHours[0].Day != "mon" || store.OpeningHours[0].Opens != "07:00" {
+		t.Errorf("got opening hours %+v", store.OpeningHours)
+	}
+
+	if _, err := NewJSONStoreLookup("testdata/missing.json").SearchStores(context.Background(), "kalmar"); err == nil {
+		t.Error("a missing file was not reported")
+	}
+}
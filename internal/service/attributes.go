@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"grocery_scraper/internal/llm"
+	"grocery_scraper/internal/models"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ProductText is what attributes are extracted from: the product name and the card text.
+type ProductText struct {
+	Name string
+	Text string
+}
+
+// AttributeExtractor extracts structured attributes from product texts. The result
+// is keyed by product name; products without attributes may be left out.
+type AttributeExtractor interface {
+	ExtractAttributes(ctx context.Context, products []ProductText) (map[string]models.OfferAttributes, error)
+}
+
+// labelKeywords and dietKeywords map tags to the words that indicate them. A keyword matches
+// a whole word, or the start of one when it ends with "*".
+var (
+	labelKeywords = map[string][]string{
+		models.LabelOrganic:   {"eko", "ekologisk*", "organic"},
+		models.LabelKRAV:      {"krav", "kravmärkt*"},
+		models.LabelFairtrade: {"fairtrade*"},
+	}
+	dietKeywords = map[string][]string{
+		models.DietVegan:       {"vegan*"},
+		models.DietLactoseFree: {"laktosfri*"},
+		models.DietGlutenFree:  {"glutenfri*"},
+	}
+	swedishKeywords = []string{"sverige", "svensk", "svenska", "svenskt"}
+
+	// originCountries are countries that show up where the card usually has the brand
+	originCountries = []string{
+		"sverige", "danmark", "norge", "finland", "tyskland", "polen", "nederländerna", "holland",
+		"belgien", "frankrike", "spanien", "portugal", "italien", "grekland", "irland", "turkiet",
+		"marocko", "egypten", "israel", "sydafrika", "kenya", "indien", "kina", "thailand", "vietnam",
+		"usa", "chile", "peru", "ecuador", "colombia", "costa rica", "brasilien", "argentina", "nya zeeland",
+	}
+)
+
+// RuleAttributeExtractor extracts attributes with keywords and the size and brand
+// patterns of the product matcher. It needs no network access and always runs.
+type RuleAttributeExtractor struct{}
+
+// NewRuleAttributeExtractor creates a rule-based extractor.
+func NewRuleAttributeExtractor() *RuleAttributeExtractor {
+	return &RuleAttributeExtractor{}
+}
+
+// ExtractAttributes implements AttributeExtractor.
+func (e *RuleAttributeExtractor) ExtractAttributes(ctx context.Context, products []ProductText) (map[string]models.OfferAttributes, error) {
+	result := make(map[string]models.OfferAttributes, len(products))
+	for _, product := range products {
+		result[product.Name] = e.extract(product)
+	}
+	return result, nil
+}
+
+func (e *RuleAttributeExtractor) extract(product ProductText) models.OfferAttributes {
+	attrs := models.OfferAttributes{
+		Brand: extractBrand(product.Text),
+	}
+	attrs.NetQuantity, attrs.NetUnit = extractSize(product.Name, product.Text)
+
+	words := strings.Fields(nonWordRegex.ReplaceAllString(strings.ToLower(product.Name+" "+product.Text), " "))
+	attrs.Labels = matchKeywordTags(words, labelKeywords)
+	attrs.DietaryTags = matchKeywordTags(words, dietKeywords)
+	for _, word := range words {
+		if slices.Contains(swedishKeywords, word) {
+			attrs.SwedishOrigin = true
+			break
+		}
+	}
+	// The card starts with the brand or the country of origin; a country is not a brand
+	if slices.Contains(originCountries, strings.ToLower(attrs.Brand)) {
+		attrs.Brand = ""
+	}
+	return attrs
+}
+
+// matchKeywordTags returns the tags, in sorted order, with a keyword among the words.
+func matchKeywordTags(words []string, keywords map[string][]string) []string {
+	var tags []string
+	for tag, terms := range keywords {
+		if keywordMatches(words, terms) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+func keywordMatches(words []string, terms []string) bool {
+	for _, term := range terms {
+		prefix, isPrefix := strings.CutSuffix(term, "*")
+		for _, word := range words {
+			if word == prefix || (isPrefix && strings.HasPrefix(word, prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AIAttributeExtractor implements AttributeExtractor with a language model.
+type AIAttributeExtractor struct {
+	client      llm.Client
+	batchSize   int
+	concurrency int
+}
+
+// NewAIAttributeExtractor creates an extractor on top of an LLM client. Share the
+// client with the categorizer so both stay within the same rate limits.
+func NewAIAttributeExtractor(client llm.Client, batchSize, concurrency int) *AIAttributeExtractor {
+	if batchSize <= 0 {
+		batchSize = defaultAIBatchSize
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &AIAttributeExtractor{
+		client:      client,
+		batchSize:   batchSize,
+		concurrency: concurrency,
+	}
+}
+
+// aiAttributeResponse is the JSON the model must answer with.
+type aiAttributeResponse struct {
+	Products []struct {
+		ID int `json:"id"`
+		models.OfferAttributes
+	} `json:"products"`
+}
+
+// attributeResponseSchema is the output schema for attribute extraction.
+func attributeResponseSchema() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"products": {
+				Type: "array",
+				Items: &llm.Schema{
+					Type: "object",
+					Properties: map[string]*llm.Schema{
+						"id":          {Type: "integer", Description: "The number of the product in the list"},
+						"brand":       {Type: "string", Description: "The brand, empty if unknown"},
+						"netQuantity": {Type: "number", Description: "The net quantity in netUnit, 0 if unknown"},
+						"netUnit":     {Type: "string", Enum: []string{"g", "ml", "st", ""}},
+						"labels": {
+							Type:  "array",
+							Items: &llm.Schema{Type: "string", Enum: []string{models.LabelOrganic, models.LabelKRAV, models.LabelFairtrade}},
+						},
+						"swedishOrigin": {Type: "boolean", Description: "Whether the product is produced in Sweden"},
+						"dietaryTags": {
+							Type:  "array",
+							Items: &llm.Schema{Type: "string", Enum: []string{models.DietVegan, models.DietLactoseFree, models.DietGlutenFree}},
+						},
+					},
+					Required: []string{"id", "brand", "netQuantity", "netUnit", "labels", "swedishOrigin", "dietaryTags"},
+				},
+			},
+		},
+		Required: []string{"products"},
+	}
+}
+
+// ExtractAttributes implements AttributeExtractor. Failed batches are logged and left out.
+func (e *AIAttributeExtractor) ExtractAttributes(ctx context.Context, products []ProductText) (map[string]models.OfferAttributes, error) {
+	result := make(map[string]models.OfferAttributes, len(products))
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(e.concurrency)
+	failed := 0
+	for i := 0; i < len(products); i += e.batchSize {
+		end := min(i+e.batchSize, len(products))
+		batch := products[i:end]
+		g.Go(func() error {
+			attrs, err := e.extractBatch(ctx, batch)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Warning: extracting attributes for %d products failed: %v", len(batch), err)
+				failed += len(batch)
+				return nil
+			}
+			for name, a := range attrs {
+				result[name] = a
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if len(result) == 0 && failed > 0 {
+		return nil, fmt.Errorf("attribute extraction failed for all %d products", failed)
+	}
+	return result, nil
+}
+
+func (e *AIAttributeExtractor) extractBatch(ctx context.Context, products []ProductText) (map[string]models.OfferAttributes, error) {
+	var list strings.Builder
+	for i, product := range products {
+		fmt.Fprintf(&list, "%d: %s | %s\n", i, product.Name, strings.Join(strings.Fields(product.Text), " "))
+	}
+
+	prompt := fmt.Sprintf(`You extract product attributes from Swedish grocery offers.
+Each line has a product number, the product name and the text of the offer card.
+For every product give:
+- brand: the brand name, empty if none is mentioned
+- netQuantity and netUnit: the net quantity of one package converted to g, ml or st (1,5 l = 1500 ml); 0 and empty if unknown
+- labels: organic (ekologisk/EKO), krav (KRAV-märkt), fairtrade
+- swedishOrigin: true only if the text says the product is from Sweden
+- dietaryTags: vegan, lactose_free, gluten_free, only when stated or certain from the product
+Only use information from the text; do not guess.
+
+Products:
+%s`, list.String())
+
+	resp, err := e.client.Generate(ctx, llm.Request{
+		Prompt: prompt,
+		Schema: attributeResponseSchema(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded aiAttributeResponse
+	if err := json.Unmarshal([]byte(resp.Text), &decoded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON response: %w", err)
+	}
+	result := make(map[string]models.OfferAttributes, len(decoded.Products))
+	for _, p := range decoded.Products {
+		if p.ID < 0 || p.ID >= len(products) {
+			continue
+		}
+		result[products[p.ID].Name] = p.OfferAttributes
+	}
+	return result, nil
+}
+
+// mergeAttributes combines rule and AI attributes. The AI is better at telling the
+// brand apart from the rest of the text, the rules are exact about sizes; labels
+// and tags found by either are kept.
+func mergeAttributes(rules, ai models.OfferAttributes) models.OfferAttributes {
+	merged := rules
+	if ai.Brand != "" {
+		merged.Brand = ai.Brand
+	}
+	if merged.NetQuantity == 0 && ai.NetQuantity > 0 {
+		merged.NetQuantity, merged.NetUnit = ai.NetQuantity, ai.NetUnit
+	}
+	merged.Labels = unionTags(rules.Labels, ai.Labels)
+	merged.DietaryTags = unionTags(rules.DietaryTags, ai.DietaryTags)
+	merged.SwedishOrigin = rules.SwedishOrigin || ai.SwedishOrigin
+	return merged
+}
+
+func unionTags(a, b []string) []string {
+	tags := slices.Clone(a)
+	for _, tag := range b {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// EnrichStage extracts brand, net quantity, labels, origin and dietary tags for
+// every offer. The rules always run; the AI extractor is optional, and when it
+// fails the rule results are kept.
+type EnrichStage struct {
+	Rules AttributeExtractor
+	AI    AttributeExtractor
+}
+
+func (s *EnrichStage) Name() string { return StageEnrich }
+
+func (s *EnrichStage) Process(ctx context.Context, batch *OfferBatch) error {
+	if len(batch.Items) == 0 {
+		return nil
+	}
+
+	products := make([]ProductText, 0, len(batch.Items))
+	seen := make(map[string]bool, len(batch.Items))
+	for _, item := range batch.Items {
+		if seen[item.Offer.Name] {
+			continue
+		}
+		seen[item.Offer.Name] = true
+		products = append(products, ProductText{Name: item.Offer.Name, Text: item.Raw.OriginalText})
+	}
+
+	ruleAttrs, err := s.Rules.ExtractAttributes(ctx, products)
+	if err != nil {
+		return fmt.Errorf("failed to extract attributes: %w", err)
+	}
+	var aiAttrs map[string]models.OfferAttributes
+	if s.AI != nil {
+		aiAttrs, err = s.AI.ExtractAttributes(ctx, products)
+		if err != nil {
+			log.Printf("Warning: AI attribute extraction failed for %s, using rules only: %v", batch.Store.Name, err)
+		}
+	}
+
+	for _, item := range batch.Items {
+		attrs := ruleAttrs[item.Offer.Name]
+		if ai, ok := aiAttrs[item.Offer.Name]; ok {
+			attrs = mergeAttributes(attrs, ai)
+		}
+		attrs.Apply(&item.Offer)
+	}
+	return nil
+}
@@ -4,42 +4,205 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"grocery_scraper/internal/llm"
+	"grocery_scraper/internal/models"
 	"log"
 	"strings"
+	"sync"
 
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"golang.org/x/sync/errgroup"
 )
 
 // Categorizer defines the interface for categorizing products.
 type Categorizer interface {
-	Categorize(ctx context.Context, products []string) (map[string][]string, error)
+	// Categorize returns the categories of the products. Products that could not be
+	// categorized are reported in the result; the error is only set when nothing
+	// could be categorized at all.
+	Categorize(ctx context.Context, products []string) (*CategorizationResult, error)
 }
 
-// AICategorizer implements Categorizer using Google Generative AI.
-type AICategorizer struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+// CategorizationResult lists which products were categorized and which failed and why.
+type CategorizationResult struct {
+	// Categories maps each categorized product to its categories
+	Categories map[string][]string
+	// Sources maps categorized products to who categorized them, when known
+	Sources map[string]CategorySource
+	// Failed maps each product that got no categories to the reason
+	Failed map[string]string
+}
+
+// CategorySource is who assigned the categories of a product and how sure it was.
+type CategorySource struct {
+	// Source is one of the models.CategorySource constants
+	Source string
+	// Confidence is between 0 and 1; nil when the categorizer does not say
+	Confidence *float64
 }
 
-// NewAICategorizer creates a new AICategorizer.
-func NewAICategorizer(ctx context.Context, apiKey string) (*AICategorizer, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key is required for AICategorizer")
+// NewCategorizationResult creates an empty result.
+func NewCategorizationResult() *CategorizationResult {
+	return &CategorizationResult{
+		Categories: make(map[string][]string),
+		Sources:    make(map[string]CategorySource),
+		Failed:     make(map[string]string),
 	}
+}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create genai client: %w", err)
+// SetSource records who categorized a product; call it after Set.
+func (r *CategorizationResult) SetSource(product string, source CategorySource) {
+	if _, ok := r.Categories[product]; ok && source.Source != "" {
+		r.Sources[product] = source
+	}
+}
+
+// Set records the categories of a product and clears an earlier failure.
+// An empty category list is not a result and is ignored.
+func (r *CategorizationResult) Set(product string, categories []string) {
+	if len(categories) == 0 {
+		return
+	}
+	r.Categories[product] = categories
+	delete(r.Failed, product)
+}
+
+// Fail records why a product could not be categorized, unless it already has categories.
+func (r *CategorizationResult) Fail(product, reason string) {
+	if _, ok := r.Categories[product]; ok {
+		return
+	}
+	r.Failed[product] = reason
+}
+
+// FailAll marks every product without categories as failed with the same reason.
+func (r *CategorizationResult) FailAll(products []string, reason string) {
+	for _, product := range products {
+		r.Fail(product, reason)
+	}
+}
+
+// Merge copies the categories and failures of another result into r.
+func (r *CategorizationResult) Merge(other *CategorizationResult) {
+	if other == nil {
+		return
 	}
+	for product, reason := range other.Failed {
+		r.Fail(product, reason)
+	}
+	for product, cats := range other.Categories {
+		r.Set(product, cats)
+		r.SetSource(product, other.Sources[product])
+	}
+}
 
-	model := client.GenerativeModel("gemini-2.5-flash-lite")
-	model.ResponseMIMEType = "application/json"
+// Coverage is the share of products that were categorized, between 0 and 1.
+func (r *CategorizationResult) Coverage() float64 {
+	total := len(r.Categories) + len(r.Failed)
+	if total == 0 {
+		return 1
+	}
+	return float64(len(r.Categories)) / float64(total)
+}
 
+// AICategorizer implements Categorizer with a language model.
+type AICategorizer struct {
+	client llm.Client
+	// categories are the category names the model is asked to choose from
+	categories []string
+	// examples are manually corrected products shown to the model
+	examples []CategoryExample
+	// batchSize is how many products are sent in one request
+	batchSize int
+	// concurrency is how many requests may run at the same time
+	concurrency int
+	// maxAttempts is how often a batch is sent before it is split
+	maxAttempts int
+}
+
+// defaultAICategories is used in the prompt when no taxonomy is configured.
+var defaultAICategories = []string{
+	"Frukt & Grönt", "Mejeri", "Kött", "Chark", "Skafferi", "Dryck", "Bröd & Kakor",
+	"Frys", "Hem & Hushåll", "Hälsa & Skönhet", "Barn", "Husdjur",
+}
+
+// defaultAIBatchSize keeps the prompt and the response within token limits.
+const defaultAIBatchSize = 50
+
+// aiCategoryResponse is the JSON the model must answer with.
+type aiCategoryResponse struct {
+	Products []struct {
+		ID         int      `json:"id"`
+		Categories []string `json:"categories"`
+		Confidence *float64 `json:"confidence"`
+	} `json:"products"`
+}
+
+// aiAssignment is what the model answered for one product.
+type aiAssignment struct {
+	categories []string
+	confidence *float64
+}
+
+// NewAICategorizer creates a new AICategorizer on top of an LLM client. A batchSize
+// of 0 uses the default of 50 products per request, a concurrency of 0 sends one
+// batch at a time. Rate limits are applied by the client (see llm.RateLimitedClient).
+func NewAICategorizer(client llm.Client, batchSize, concurrency int) *AICategorizer {
+	if batchSize <= 0 {
+		batchSize = defaultAIBatchSize
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
 	return &AICategorizer{
-		client: client,
-		model:  model,
-	}, nil
+		client:      client,
+		categories:  defaultAICategories,
+		batchSize:   batchSize,
+		concurrency: concurrency,
+		maxAttempts: 2,
+	}
+}
+
+// SetCategories restricts the model to the given category names, e.g. the labels of the taxonomy.
+func (c *AICategorizer) SetCategories(categories []string) {
+	c.categories = categories
+}
+
+// SetExamples adds correctly categorized products to the prompt as few-shot examples,
+// e.g. the manual category overrides.
+func (c *AICategorizer) SetExamples(examples []CategoryExample) {
+	c.examples = examples
+}
+
+// categoryResponseSchema is the output schema the model must follow: one object per
+// product, referring to the product by its number, with categories from a fixed list.
+func categoryResponseSchema(categories []string) *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"products": {
+				Type: "array",
+				Items: &llm.Schema{
+					Type: "object",
+					Properties: map[string]*llm.Schema{
+						"id": {
+							Type:        "integer",
+							Description: "The number of the product in the list",
+						},
+						"categories": {
+							Type:  "array",
+							Items: &llm.Schema{Type: "string", Enum: categories},
+						},
+						"confidence": {
+							Type:        "number",
+							Description: "How sure you are of the categories, from 0 to 1",
+							Nullable:    true,
+						},
+					},
+					Required: []string{"id", "categories", "confidence"},
+				},
+			},
+		},
+		Required: []string{"products"},
+	}
 }
 
 // Close closes the underlying client.
@@ -48,74 +211,148 @@ func (c *AICategorizer) Close() {
 }
 
 // Categorize categorizes a list of products into Swedish categories.
-func (c *AICategorizer) Categorize(ctx context.Context, products []string) (map[string][]string, error) {
+func (c *AICategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	result := NewCategorizationResult()
 	if len(products) == 0 {
-		return nil, nil
+		return result, nil
 	}
 
-	// Batch processing could be done here if the list is huge, but for now we assume
-	// the caller handles reasonable batch sizes or we do simple batching.
-	// Let's do simple batching of 50 products to avoid token limits.
-	batchSize := 50
-	allCategories := make(map[string][]string)
+	// A name that occurs twice is only sent once
+	unique := make([]string, 0, len(products))
+	seen := make(map[string]bool, len(products))
+	for _, product := range products {
+		if !seen[product] {
+			seen[product] = true
+			unique = append(unique, product)
+		}
+	}
 
-	for i := 0; i < len(products); i += batchSize {
-		end := i + batchSize
-		if end > len(products) {
-			end = len(products)
+	// Batches run in a bounded worker pool; each collects its own result
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(c.concurrency)
+	for i := 0; i < len(unique); i += c.batchSize {
+		end := i + c.batchSize
+		if end > len(unique) {
+			end = len(unique)
 		}
+		batch := unique[i:end]
+		g.Go(func() error {
+			batchResult := NewCategorizationResult()
+			c.categorizeProducts(ctx, batch, batchResult)
+			mu.Lock()
+			result.Merge(batchResult)
+			mu.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
 
-		batch := products[i:end]
-		cats, err := c.categorizeBatch(ctx, batch)
-		if err != nil {
-			log.Printf("Error categorizing batch %d-%d: %v", i, end, err)
-			// Continue with other batches or return error?
-			// Let's return partial results if possible, but for now logging is safer.
-			continue
+	if len(result.Categories) == 0 && len(result.Failed) > 0 {
+		return result, fmt.Errorf("no products could be categorized (%d failed)", len(result.Failed))
+	}
+	return result, nil
+}
+
+// categorizeProducts sends a batch, retrying it when the call or the response is bad.
+// A batch that keeps failing is split in halves, so one product the model chokes on
+// does not cost the whole batch. Products left out of a response are asked for again.
+func (c *AICategorizer) categorizeProducts(ctx context.Context, products []string, result *CategorizationResult) {
+	var assigned map[int]aiAssignment
+	var err error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		assigned, err = c.categorizeBatch(ctx, products)
+		if err == nil || ctx.Err() != nil {
+			break
 		}
+		log.Printf("Warning: categorizing batch of %d products failed (attempt %d/%d): %v", len(products), attempt, c.maxAttempts, err)
+	}
 
-		for k, v := range cats {
-			allCategories[k] = v
+	if err != nil {
+		if len(products) > 1 && ctx.Err() == nil {
+			mid := len(products) / 2
+			c.categorizeProducts(ctx, products[:mid], result)
+			c.categorizeProducts(ctx, products[mid:], result)
+			return
 		}
+		result.FailAll(products, err.Error())
+		return
 	}
 
-	return allCategories, nil
+	var missing []string
+	for i, product := range products {
+		a, ok := assigned[i]
+		switch {
+		case !ok:
+			missing = append(missing, product)
+		case len(a.categories) == 0:
+			result.Fail(product, "the model assigned no category")
+		default:
+			result.Set(product, a.categories)
+			result.SetSource(product, CategorySource{Source: models.CategorySourceAI, Confidence: a.confidence})
+		}
+	}
+	// categorizeBatch fails when nothing was assigned, so this always makes progress
+	if len(missing) > 0 {
+		c.categorizeProducts(ctx, missing, result)
+	}
 }
 
-func (c *AICategorizer) categorizeBatch(ctx context.Context, products []string) (map[string][]string, error) {
-	prompt := fmt.Sprintf(`You are a grocery product categorizer for a Swedish store.
-Categorize the following products into standard Swedish grocery categories (e.g., Frukt & Grönt, Mejeri, Kött, Chark, Skafferi, Dryck, Bröd & Kakor, Frys, Hem & Hushåll, Hälsa & Skönhet, Barn, Husdjur).
-A product can belong to multiple categories.
-Return ONLY a JSON object where keys are product names and values are arrays of category strings.
-Do not include markdown formatting like `+"```json"+`.
+// categorizeBatch asks the model for the categories of the products, keyed by their index.
+func (c *AICategorizer) categorizeBatch(ctx context.Context, products []string) (map[int]aiAssignment, error) {
+	var list strings.Builder
+	for i, product := range products {
+		fmt.Fprintf(&list, "%d: %s\n", i, product)
+	}
+
+	var examples string
+	if len(c.examples) > 0 {
+		var b strings.Builder
+		b.WriteString("\nThese products were categorized by hand; categorize similar products the same way:\n")
+		for _, example := range c.examples {
+			fmt.Fprintf(&b, "- %s: %s\n", example.Product, strings.Join(example.Categories, "; "))
+		}
+		examples = b.String()
+	}
 
+	prompt := fmt.Sprintf(`You are a grocery product categorizer for a Swedish store.
+Categorize the following products using ONLY these Swedish grocery categories, spelled exactly as written:
+%s
+A product can belong to multiple categories. Prefer the most specific category that fits.
+Answer with one entry per product, using the product's number as id, and say how sure you are
+of its categories as a confidence from 0 to 1, or null if you cannot say.
+%s
 Products:
-%s`, strings.Join(products, "\n"))
+%s`, strings.Join(c.categories, "; "), examples, list.String())
 
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := c.client.Generate(ctx, llm.Request{
+		Prompt: prompt,
+		Schema: categoryResponseSchema(c.categories),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %w", err)
+		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
-		return nil, fmt.Errorf("no content generated")
+	var decoded aiCategoryResponse
+	if err := json.Unmarshal([]byte(resp.Text), &decoded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON response: %w", err)
 	}
 
-	var result map[string][]string
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			// Clean up potential markdown code blocks if the model ignores instructions
-			cleanTxt := strings.TrimSpace(string(txt))
-			cleanTxt = strings.TrimPrefix(cleanTxt, "```json")
-			cleanTxt = strings.TrimPrefix(cleanTxt, "```")
-			cleanTxt = strings.TrimSuffix(cleanTxt, "```")
-
-			if err := json.Unmarshal([]byte(cleanTxt), &result); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal JSON response: %w. Response: %s", err, cleanTxt)
-			}
-			break // Only process the first text part
+	assigned := make(map[int]aiAssignment, len(decoded.Products))
+	for _, a := range decoded.Products {
+		if a.ID < 0 || a.ID >= len(products) {
+			continue
 		}
+		entry := assigned[a.ID]
+		entry.categories = append(entry.categories, a.Categories...)
+		if a.Confidence != nil {
+			confidence := min(max(*a.Confidence, 0), 1)
+			entry.confidence = &confidence
+		}
+		assigned[a.ID] = entry
 	}
-
-	return result, nil
+	if len(assigned) == 0 {
+		return nil, fmt.Errorf("response did not categorize any of the %d products", len(products))
+	}
+	return assigned, nil
 }
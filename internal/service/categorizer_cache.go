@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"log"
+	"time"
+)
+
+// CachedCategorizer is a Categorizer decorator that remembers the categories of
+// every product by normalized name. Only products missing from the cache (or whose
+// entry is older than the TTL) are passed on to the wrapped Categorizer.
+type CachedCategorizer struct {
+	next  Categorizer
+	cache repository.CategoryCacheRepository
+	ttl   time.Duration
+}
+
+// NewCachedCategorizer wraps next with a persistent cache. A ttl of 0 keeps entries forever.
+func NewCachedCategorizer(next Categorizer, cache repository.CategoryCacheRepository, ttl time.Duration) *CachedCategorizer {
+	return &CachedCategorizer{
+		next:  next,
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+// Categorize returns categories for all products, keyed by the names as given.
+func (c *CachedCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	result := NewCategorizationResult()
+	if len(products) == 0 {
+		return result, nil
+	}
+
+	// Several spellings of a product share one cache entry
+	keys := make(map[string]string, len(products))
+	seenKeys := make(map[string]bool, len(products))
+	var uniqueKeys []string
+	for _, name := range products {
+		key := NormalizeProductName(name)
+		keys[name] = key
+		if !seenKeys[key] {
+			seenKeys[key] = true
+			uniqueKeys = append(uniqueKeys, key)
+		}
+	}
+
+	var notBefore time.Time
+	if c.ttl > 0 {
+		notBefore = time.Now().Add(-c.ttl)
+	}
+	cached, err := c.cache.GetCachedCategories(ctx, uniqueKeys, notBefore)
+	if err != nil {
+		// The cache is only an optimization; fall back to categorizing everything
+		log.Printf("Warning: category cache lookup failed: %v", err)
+		cached = map[string]models.ProductCategory{}
+	}
+
+	var misses []string
+	missKeys := make(map[string]bool)
+	for _, name := range products {
+		key := keys[name]
+		if _, ok := cached[key]; ok || missKeys[key] {
+			continue
+		}
+		missKeys[key] = true
+		misses = append(misses, name)
+	}
+	log.Printf("Category cache: %d hits, %d misses", len(uniqueKeys)-len(misses), len(misses))
+
+	failed := make(map[string]string)
+	if len(misses) > 0 {
+		fresh, err := c.next.Categorize(ctx, misses)
+		if err != nil {
+			if len(cached) == 0 {
+				return fresh, err
+			}
+			log.Printf("Warning: categorizing cache misses failed: %v", err)
+			for _, name := range misses {
+				failed[keys[name]] = err.Error()
+			}
+		}
+		if fresh != nil {
+			toSave := make([]models.ProductCategory, 0, len(fresh.Categories))
+			for name, cats := range fresh.Categories {
+				key := NormalizeProductName(name)
+				source := fresh.Sources[name]
+				entry := models.ProductCategory{NormalizedName: key, Categories: cats, Source: source.Source, Confidence: source.Confidence}
+				toSave = append(toSave, entry)
+				cached[key] = entry
+			}
+			// Failed products are not cached, so they are retried on the next run
+			for name, reason := range fresh.Failed {
+				failed[NormalizeProductName(name)] = reason
+			}
+			if err := c.cache.SaveCachedCategories(ctx, toSave); err != nil {
+				log.Printf("Warning: could not store categories in cache: %v", err)
+			}
+		}
+	}
+
+	for _, name := range products {
+		key := keys[name]
+		if entry, ok := cached[key]; ok {
+			result.Set(name, entry.Categories)
+			result.SetSource(name, CategorySource{Source: entry.Source, Confidence: entry.Confidence})
+		} else if reason, ok := failed[key]; ok {
+			result.Fail(name, reason)
+		} else {
+			result.Fail(name, "not categorized")
+		}
+	}
+	return result, nil
+}
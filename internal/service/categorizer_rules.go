@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// CategoryRule maps Swedish product terms to a category. A rule matches when one of
+// its terms occurs in the product name or one of its patterns matches, and none of
+// its exclusion terms occur. Single-word terms match whole words and the start or
+// end of compound words ("mjölk" matches "mellanmjölk", "ost" does not match "rostbröd").
+type CategoryRule struct {
+	Category string   `yaml:"category"`
+	Weight   float64  `yaml:"weight"`
+	Terms    []string `yaml:"terms"`
+	Patterns []string `yaml:"patterns"`
+	Exclude  []string `yaml:"exclude"`
+
+	compiled []*regexp.Regexp
+}
+
+// CategoryDictionary is the content of a rules file.
+type CategoryDictionary struct {
+	// MinScore is the score a category needs to be assigned
+	MinScore float64 `yaml:"min_score"`
+	// MaxCategories limits how many categories a product gets (0 = no limit)
+	MaxCategories int            `yaml:"max_categories"`
+	Rules         []CategoryRule `yaml:"rules"`
+}
+
+// RuleCategorizer implements Categorizer with a local keyword/regex dictionary.
+// It needs no network access, so it works in air-gapped deployments and CI.
+type RuleCategorizer struct {
+	dict CategoryDictionary
+}
+
+// LoadRuleCategorizer reads a YAML dictionary file and compiles its patterns.
+func LoadRuleCategorizer(path string) (*RuleCategorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read category rules %s: %w", path, err)
+	}
+	var dict CategoryDictionary
+	if err := yaml.Unmarshal(data, &dict); err != nil {
+		return nil, fmt.Errorf("failed to parse category rules %s: %w", path, err)
+	}
+	return NewRuleCategorizer(dict)
+}
+
+// NewRuleCategorizer creates a categorizer from an in-memory dictionary.
+func NewRuleCategorizer(dict CategoryDictionary) (*RuleCategorizer, error) {
+	if dict.MinScore <= 0 {
+		dict.MinScore = 1
+	}
+	for i := range dict.Rules {
+		rule := &dict.Rules[i]
+		if rule.Category == "" {
+			return nil, fmt.Errorf("category rule %d has no category", i)
+		}
+		if rule.Weight == 0 {
+			rule.Weight = 1
+		}
+		for j, term := range rule.Terms {
+			rule.Terms[j] = strings.ToLower(term)
+		}
+		for j, term := range rule.Exclude {
+			rule.Exclude[j] = strings.ToLower(term)
+		}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q for category %s: %w", pattern, rule.Category, err)
+			}
+			rule.compiled = append(rule.compiled, re)
+		}
+	}
+	return &RuleCategorizer{dict: dict}, nil
+}
+
+// Categorize assigns each product the categories whose rules score at least MinScore,
+// highest score first. Products no rule matches are reported as failed. The confidence
+// grows with the best score: 0.5 at MinScore, 0.67 at twice MinScore and so on.
+func (c *RuleCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	result := NewCategorizationResult()
+	for _, product := range products {
+		if cats, score := c.categorizeOne(product); len(cats) > 0 {
+			confidence := score / (score + c.dict.MinScore)
+			result.Set(product, cats)
+			result.SetSource(product, CategorySource{Source: models.CategorySourceRule, Confidence: &confidence})
+		} else {
+			result.Fail(product, "no category rule matched")
+		}
+	}
+	return result, nil
+}
+
+// categorizeOne returns the categories of a product and the score of the best one.
+func (c *RuleCategorizer) categorizeOne(product string) ([]string, float64) {
+	name := strings.ToLower(product)
+	words := strings.Fields(nonWordRegex.ReplaceAllString(name, " "))
+	scores := make(map[string]float64)
+
+	for _, rule := range c.dict.Rules {
+		if matchesAnyTerm(name, words, rule.Exclude) {
+			continue
+		}
+		hits := 0
+		for _, term := range rule.Terms {
+			if termMatches(name, words, term) {
+				hits++
+			}
+		}
+		for _, re := range rule.compiled {
+			if re.MatchString(product) {
+				hits++
+			}
+		}
+		if hits > 0 {
+			scores[rule.Category] += rule.Weight * float64(hits)
+		}
+	}
+
+	var cats []string
+	for cat, score := range scores {
+		if score >= c.dict.MinScore {
+			cats = append(cats, cat)
+		}
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		if scores[cats[i]] != scores[cats[j]] {
+			return scores[cats[i]] > scores[cats[j]]
+		}
+		return cats[i] < cats[j]
+	})
+	if c.dict.MaxCategories > 0 && len(cats) > c.dict.MaxCategories {
+		cats = cats[:c.dict.MaxCategories]
+	}
+	if len(cats) == 0 {
+		return nil, 0
+	}
+	return cats, scores[cats[0]]
+}
+
+// termMatches reports whether a term occurs in the lower-cased name. Terms with
+// spaces are matched as phrases; single words must be a word or the start or end of one.
+func termMatches(name string, words []string, term string) bool {
+	if term == "" {
+		return false
+	}
+	if strings.Contains(term, " ") {
+		return strings.Contains(name, term)
+	}
+	for _, word := range words {
+		if strings.HasPrefix(word, term) || strings.HasSuffix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyTerm(name string, words []string, terms []string) bool {
+	for _, term := range terms {
+		if termMatches(name, words, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// FallbackCategorizer asks the primary categorizer first and uses the fallback for
+// the whole list if the primary fails, and for the products it left uncategorized.
+type FallbackCategorizer struct {
+	primary  Categorizer
+	fallback Categorizer
+}
+
+// NewFallbackCategorizer creates a categorizer that falls back to another one.
+func NewFallbackCategorizer(primary, fallback Categorizer) *FallbackCategorizer {
+	return &FallbackCategorizer{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+// Categorize implements Categorizer.
+func (c *FallbackCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	result, err := c.primary.Categorize(ctx, products)
+	if err != nil {
+		log.Printf("Warning: primary categorizer failed, using fallback: %v", err)
+		return c.fallback.Categorize(ctx, products)
+	}
+	if result == nil {
+		result = NewCategorizationResult()
+	}
+
+	var missing []string
+	for _, product := range products {
+		if _, ok := result.Categories[product]; !ok {
+			missing = append(missing, product)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	fallback, err := c.fallback.Categorize(ctx, missing)
+	if err != nil {
+		log.Printf("Warning: fallback categorizer failed: %v", err)
+	}
+	if fallback == nil {
+		return result, nil
+	}
+	for product, cats := range fallback.Categories {
+		result.Set(product, cats)
+		result.SetSource(product, fallback.Sources[product])
+	}
+	// Products neither categorizer could handle report both reasons
+	for product, reason := range fallback.Failed {
+		if primary, ok := result.Failed[product]; ok {
+			reason = fmt.Sprintf("%s; fallback: %s", primary, reason)
+		}
+		result.Fail(product, reason)
+	}
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"grocery_scraper/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTermMatches(t *testing.T) {
+	tests := []struct {
+		name, term string
+		want       bool
+	}{
+		{name: "mellanmjölk 1,5l", term: "mjölk", want: true},
+		{name: "mjölkchoklad", term: "mjölk", want: true},
+		{name: "rostbröd", term: "ost", want: false},
+		{name: "ost & skinka", term: "ost", want: true},
+		{name: "ostkaka", term: "ost", want: true},
+		{name: "grevéost", term: "ost", want: true},
+		{name: "lätt creme fraiche", term: "creme fraiche", want: true},
+		{name: "cremefraiche", term: "creme fraiche", want: false},
+		{name: "kaffe", term: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.term, func(t *testing.T) {
+			words := strings.Fields(nonWordRegex.ReplaceAllString(tt.name, " "))
+			if got := termMatches(tt.name, words, tt.term); got != tt.want {
+				t.Errorf("termMatches(%q, %q) = %v, want %v", tt.name, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleCategorizer(t *testing.T) {
+	categorizer, err := NewRuleCategorizer(CategoryDictionary{
+		MinScore:      1,
+		MaxCategories: 2,
+		Rules: []CategoryRule{
+			{Category: "Mejeri", Terms: []string{"Mjölk", "ost", "creme fraiche"}, Exclude: []string{"havre"}},
+			{Category: "Bröd", Terms: []string{"bröd"}},
+			{Category: "Kött", Terms: []string{"fläsk", "skinka"}, Patterns: []string{`^bacon\b`}},
+			{Category: "Växtbaserat", Weight: 2, Terms: []string{"havre"}},
+			{Category: "Skafferi", Weight: 0.5, Terms: []string{"kaffe", "bönor"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		product    string
+		want       []string
+		confidence float64
+	}{
+		{product: "Mellanmjölk 1,5l", want: []string{"Mejeri"}, confidence: 0.5},
+		{product: "Rostbröd", want: []string{"Bröd"}, confidence: 0.5},
+		{product: "Lätt creme fraiche", want: []string{"Mejeri"}, confidence: 0.5},
+		// The exclusion keeps oat milk out of dairy; the weight of 2 gives it a higher confidence
+		{product: "Havremjölk", want: []string{"Växtbaserat"}, confidence: 2.0 / 3},
+		{product: "BACON skivat", want: []string{"Kött"}, confidence: 0.5},
+		// One term of weight 0.5 stays below MinScore, two reach it
+		{product: "Bryggkaffe"},
+		{product: "Kaffebönor hela", want: []string{"Skafferi"}, confidence: 0.5},
+		// Three categories match; the best one first, ties by name, at most two
+		{product: "Skinka & ost fläskbröd", want: []string{"Kött", "Bröd"}, confidence: 2.0 / 3},
+		{product: "Blomkål"},
+	}
+	var products []string
+	for _, tt := range tests {
+		products = append(products, tt.product)
+	}
+	result, err := categorizer.Categorize(context.Background(), products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.product, func(t *testing.T) {
+			got := result.Categories[tt.product]
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got the categories %v, want %v", got, tt.want)
+			}
+			if tt.want == nil {
+				if result.Failed[tt.product] != "no category rule matched" {
+					t.Errorf("failed with %q", result.Failed[tt.product])
+				}
+				return
+			}
+			source := result.Sources[tt.product]
+			if source.Source != models.CategorySourceRule || source.Confidence == nil || *source.Confidence != tt.confidence {
+				t.Errorf("got the source %q with confidence %v, want %v", source.Source, source.Confidence, tt.confidence)
+			}
+		})
+	}
+
+	if _, err := NewRuleCategorizer(CategoryDictionary{Rules: []CategoryRule{{Category: "Kött", Patterns: []string{"(bacon"}}}}); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+	if _, err := NewRuleCategorizer(CategoryDictionary{Rules: []CategoryRule{{Terms: []string{"bacon"}}}}); err == nil {
+		t.Error("a rule without a category was accepted")
+	}
+}
+
+// failingCategorizer fails every request.
+type failingCategorizer struct{ err error }
+
+func (c failingCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	return nil, c.err
+}
+
+func TestFallbackCategorizer(t *testing.T) {
+	products := []string{"Mellanmjölk 1,5l", "Kaffe 450g", "Okänd vara"}
+
+	// The primary fails: the fallback categorizes every product
+	fallback := &recordingCategorizer{categories: map[string][]string{"Mellanmjölk 1,5l": {"Mejeri"}, "Kaffe 450g": {"Skafferi"}}}
+	result, err := NewFallbackCategorizer(failingCategorizer{errors.New("quota exceeded")}, fallback).Categorize(context.Background(), products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fallback.asked, products) {
+		t.Errorf("the fallback was asked for %q, want %q", fallback.asked, products)
+	}
+	if len(result.Categories) != 2 || result.Failed["Okänd vara"] != "unknown product" {
+		t.Errorf("got %v, failed %v", result.Categories, result.Failed)
+	}
+
+	// The primary leaves products uncategorized: only those go to the fallback
+	primary := &recordingCategorizer{categories: map[string][]string{"Mellanmjölk 1,5l": {"Mejeri"}}}
+	fallback = &recordingCategorizer{categories: map[string][]string{"Kaffe 450g": {"Skafferi"}}}
+	result, err = NewFallbackCategorizer(primary, fallback).Categorize(context.Background(), products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Kaffe 450g", "Okänd vara"}; !slices.Equal(fallback.asked, want) {
+		t.Errorf("the fallback was asked for %q, want %q", fallback.asked, want)
+	}
+	if got := result.Categories["Kaffe 450g"]; !slices.Equal(got, []string{"Skafferi"}) {
+		t.Errorf("Kaffe got the categories %v from the fallback", got)
+	}
+	if _, failed := result.Failed["Kaffe 450g"]; failed {
+		t.Error("a product the fallback categorized is still failed")
+	}
+	if got, want := result.Failed["Okänd vara"], "unknown product; fallback: unknown product"; got != want {
+		t.Errorf("Okänd vara failed with %q, want %q", got, want)
+	}
+
+	// A failing fallback keeps what the primary found
+	result, err = NewFallbackCategorizer(primary, failingCategorizer{errors.New("offline")}).Categorize(context.Background(), products)
+	if err != nil || len(result.Categories) != 1 {
+		t.Errorf("got %v, %v", result.Categories, err)
+	}
+}
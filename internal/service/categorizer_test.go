@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/llm"
+	"grocery_scraper/internal/models"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// checkStrictSchema checks a JSON Schema against the rules of OpenAI's strict
+// structured output: every object lists all of its properties as required and
+// allows no others.
+func checkStrictSchema(t *testing.T, path string, schema map[string]any) {
+	t.Helper()
+	if items, ok := schema["items"].(map[string]any); ok {
+		checkStrictSchema(t, path+"[]", items)
+	}
+	if schema["type"] != "object" {
+		return
+	}
+	if schema["additionalProperties"] != false {
+		t.Errorf("%s allows additional properties", path)
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	required, _ := schema["required"].([]string)
+	for name, property := range properties {
+		if !slices.Contains(required, name) {
+			t.Errorf("%s.%s is not required", path, name)
+		}
+		checkStrictSchema(t, path+"."+name, property.(map[string]any))
+	}
+	for _, name := range required {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("%s requires the unknown property %s", path, name)
+		}
+	}
+}
+
+func TestResponseSchemasAreStrict(t *testing.T) {
+	schemas := map[string]*llm.Schema{
+		"categories": categoryResponseSchema([]string{"Mejeri", "Kaffe"}),
+		"attributes": attributeResponseSchema(),
+	}
+	for name, schema := range schemas {
+		t.Run(name, func(t *testing.T) {
+			checkStrictSchema(t, "$", schema.JSONSchema())
+		})
+	}
+
+	products := categoryResponseSchema(nil).JSONSchema()["properties"].(map[string]any)["products"].(map[string]any)
+	confidence := products["items"].(map[string]any)["properties"].(map[string]any)["confidence"].(map[string]any)
+	if got := fmt.Sprint(confidence["type"]); got != "[number null]" {
+		t.Errorf("confidence has type %s, want it to be a nullable number", got)
+	}
+}
+
+// scriptedModel answers like the stub client, but returns malformed JSON for every
+// prompt that lists a poisoned product and for the first failFirst calls.
+type scriptedModel struct {
+	*llm.StubClient
+	poison    string
+	failFirst int
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (m *scriptedModel) Generate(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	m.mu.Lock()
+	m.prompts = append(m.prompts, req.Prompt)
+	calls := len(m.prompts)
+	m.mu.Unlock()
+	if calls <= m.failFirst || (m.poison != "" && strings.Contains(req.Prompt, m.poison)) {
+		return &llm.Response{Text: `{"products": [{"id": 0, "categ`}, nil
+	}
+	return m.StubClient.Generate(ctx, req)
+}
+
+func (m *scriptedModel) calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.prompts)
+}
+
+func TestAICategorizer(t *testing.T) {
+	confidence := 0.9
+	stub := llm.NewStubClient(map[string]map[string]any{
+		"Mellanmjölk 1,5l": {"categories": []string{"Mejeri"}, "confidence": confidence},
+		"Kaffe 450g":       {"categories": []string{"Skafferi"}},
+		"Bananer":          {"categories": []string{"Frukt & Grönt"}},
+		"Fläskfilé":        {"categories": []string{"Kött"}},
+		"Trasig vara":      {"categories": []string{"Skafferi"}},
+		"Presentkort":      {"categories": []string{}},
+	})
+	known := []string{"Mellanmjölk 1,5l", "Kaffe 450g", "Bananer", "Fläskfilé"}
+
+	tests := []struct {
+		name       string
+		model      *scriptedModel
+		batchSize  int
+		products   []string
+		wantCalls  int
+		wantFailed map[string]string // product to a part of the reason
+		wantErr    bool
+	}{
+		{
+			name:      "batches",
+			model:     &scriptedModel{StubClient: stub},
+			batchSize: 2,
+			products:  append(known, "Kaffe 450g"),
+			wantCalls: 2,
+		},
+		{
+			name:      "malformed response retried",
+			model:     &scriptedModel{StubClient: stub, failFirst: 1},
+			batchSize: 4,
+			products:  known,
+			wantCalls: 2,
+		},
+		{
+			// 4 products fail twice, then 2, then the poisoned one alone
+			name:       "malformed batch split until the product that breaks it",
+			model:      &scriptedModel{StubClient: stub, poison: "Trasig vara"},
+			batchSize:  4,
+			products:   []string{"Mellanmjölk 1,5l", "Trasig vara", "Kaffe 450g", "Bananer"},
+			wantCalls:  2 + 2 + 1 + 2 + 1,
+			wantFailed: map[string]string{"Trasig vara": "failed to unmarshal"},
+		},
+		{
+			name:       "left out of the response",
+			model:      &scriptedModel{StubClient: stub},
+			batchSize:  4,
+			products:   []string{"Bananer", "Okänd vara"},
+			wantCalls:  1 + 2,
+			wantFailed: map[string]string{"Okänd vara": "did not categorize any"},
+		},
+		{
+			name:       "no category assigned",
+			model:      &scriptedModel{StubClient: stub},
+			batchSize:  4,
+			products:   []string{"Bananer", "Presentkort"},
+			wantCalls:  1,
+			wantFailed: map[string]string{"Presentkort": "no category"},
+		},
+		{
+			name:       "nothing categorized",
+			model:      &scriptedModel{StubClient: stub, failFirst: 100},
+			batchSize:  4,
+			products:   []string{"Bananer"},
+			wantCalls:  2,
+			wantFailed: map[string]string{"Bananer": "failed to unmarshal"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categorizer := NewAICategorizer(tt.model, tt.batchSize, 2)
+			categorizer.SetCategories([]string{"Mejeri", "Skafferi", "Frukt & Grönt", "Kött"})
+			result, err := categorizer.Categorize(context.Background(), tt.products)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got the error %v, want an error: %v", err, tt.wantErr)
+			}
+			if calls := tt.model.calls(); calls != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", calls, tt.wantCalls)
+			}
+
+			for _, product := range tt.products {
+				if want, failed := tt.wantFailed[product]; failed {
+					if reason, ok := result.Failed[product]; !ok || !strings.Contains(reason, want) {
+						t.Errorf("%s failed with %q, want a reason containing %q", product, reason, want)
+					}
+					continue
+				}
+				if len(result.Categories[product]) == 0 {
+					t.Errorf("%s was not categorized: %q", product, result.Failed[product])
+				}
+				if source := result.Sources[product]; source.Source != models.CategorySourceAI {
+					t.Errorf("%s was categorized by %q, want %q", product, source.Source, models.CategorySourceAI)
+				}
+			}
+			if len(result.Failed) != len(tt.wantFailed) {
+				t.Errorf("got the failures %v, want %d", result.Failed, len(tt.wantFailed))
+			}
+		})
+	}
+
+	result, err := NewAICategorizer(&scriptedModel{StubClient: stub}, 0, 0).Categorize(context.Background(), known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Sources["Mellanmjölk 1,5l"].Confidence; got == nil || *got != confidence {
+		t.Errorf("got the confidence %v, want %v", got, confidence)
+	}
+	if got := result.Sources["Bananer"].Confidence; got != nil {
+		t.Errorf("got the confidence %v for a product the model was not sure about", *got)
+	}
+}
+
+func TestCategorizationResult(t *testing.T) {
+	result := NewCategorizationResult()
+	result.Fail("Kaffe", "timeout")
+	result.Set("Mjölk", []string{"Mejeri"})
+	result.Set("Ost", nil)
+	result.Fail("Mjölk", "ignored, Mjölk has categories")
+
+	other := NewCategorizationResult()
+	other.Set("Kaffe", []string{"Skafferi"})
+	other.SetSource("Kaffe", CategorySource{Source: models.CategorySourceRule})
+	other.Fail("Bröd", "malformed response")
+	result.Merge(other)
+
+	if got := result.Categories["Kaffe"]; !slices.Equal(got, []string{"Skafferi"}) || result.Sources["Kaffe"].Source != models.CategorySourceRule {
+		t.Errorf("Kaffe has the categories %v from %q", got, result.Sources["Kaffe"].Source)
+	}
+	if _, failed := result.Failed["Kaffe"]; failed {
+		t.Error("a categorized product is still failed")
+	}
+	if _, ok := result.Categories["Ost"]; ok {
+		t.Error("an empty category list was recorded")
+	}
+	if want := map[string]string{"Bröd": "malformed response"}; fmt.Sprint(result.Failed) != fmt.Sprint(want) {
+		t.Errorf("got the failures %v, want %v", result.Failed, want)
+	}
+	if got := result.Coverage(); got != 2.0/3 {
+		t.Errorf("Coverage() = %v, want 2/3", got)
+	}
+	if got := NewCategorizationResult().Coverage(); got != 1 {
+		t.Errorf("an empty result has coverage %v, want 1", got)
+	}
+}
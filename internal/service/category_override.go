@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"log"
+	"strings"
+)
+
+// ProductOverrideKey is the override key of a canonical product.
+func ProductOverrideKey(productID uint) string {
+	return fmt.Sprintf("product:%d", productID)
+}
+
+// NameOverrideKey is the override key of a product name; spellings that normalize
+// to the same name share the override.
+func NameOverrideKey(name string) string {
+	return "name:" + NormalizeProductName(name)
+}
+
+// overrideKeys returns the keys an offer can be overridden by, strongest first.
+func overrideKeys(offer models.Offer) []string {
+	var keys []string
+	if offer.ProductID != nil {
+		keys = append(keys, ProductOverrideKey(*offer.ProductID))
+	}
+	return append(keys, NameOverrideKey(offer.Name))
+}
+
+// CategoryExample is a product with its correct categories, shown to the model as
+// a few-shot example.
+type CategoryExample struct {
+	Product    string
+	Categories []string
+}
+
+// OverrideExamples turns manual corrections into few-shot examples. Overrides store
+// taxonomy IDs when a taxonomy is used; the model is shown their Swedish labels.
+func OverrideExamples(overrides []models.CategoryOverride, taxonomy *Taxonomy) []CategoryExample {
+	examples := make([]CategoryExample, 0, len(overrides))
+	for _, override := range overrides {
+		if override.ProductName == "" || len(override.Categories) == 0 {
+			continue
+		}
+		labels := make([]string, 0, len(override.Categories))
+		for _, category := range override.Categories {
+			if taxonomy != nil {
+				if cat, ok := taxonomy.Category(category); ok {
+					category = cat.LabelSV
+				}
+			}
+			labels = append(labels, category)
+		}
+		examples = append(examples, CategoryExample{Product: override.ProductName, Categories: labels})
+	}
+	return examples
+}
+
+// applyCategoryOverrides looks up the overrides for the given items and returns the
+// categories of every overridden item. A failed lookup is logged and overrides nothing.
+func (s *CategorizeStage) applyCategoryOverrides(ctx context.Context, items []*OfferItem) map[*OfferItem][]string {
+	overridden := make(map[*OfferItem][]string)
+	if s.Overrides == nil {
+		return overridden
+	}
+
+	var keys []string
+	for _, item := range items {
+		keys = append(keys, overrideKeys(item.Offer)...)
+	}
+	overrides, err := s.Overrides.GetOverrides(ctx, keys)
+	if err != nil {
+		log.Printf("Warning: could not read category overrides: %v", err)
+		return overridden
+	}
+	for _, item := range items {
+		for _, key := range overrideKeys(item.Offer) {
+			if override, ok := overrides[key]; ok {
+				overridden[item] = override.Categories
+				break
+			}
+		}
+	}
+	return overridden
+}
+
+// categorizationKey identifies what is categorized for an offer: its canonical
+// product when it was matched, otherwise its name and brand. Offers with the same
+// key get the same categories, in every store.
+func categorizationKey(offer models.Offer) string {
+	if offer.ProductID != nil {
+		return ProductOverrideKey(*offer.ProductID)
+	}
+	return "name:" + NormalizeProductName(categorizationText(offer))
+}
+
+// categorizationText is the product text sent to the categorizer. The brand tells
+// apart products with the same name, e.g. coffee or detergent of different makers.
+func categorizationText(offer models.Offer) string {
+	if offer.Brand == "" || strings.Contains(strings.ToLower(offer.Name), strings.ToLower(offer.Brand)) {
+		return offer.Name
+	}
+	return fmt.Sprintf("%s (%s)", offer.Name, offer.Brand)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"math"
+	"time"
+)
+
+// priceTolerance ignores rounding noise when comparing prices and percentages.
+const priceTolerance = 0.005
+
+// unitPrice returns what a single unit costs with the offer, for every offer type.
+func unitPrice(offer models.Offer) float64 {
+	switch offer.Type {
+	case "multibuy":
+		if offer.SaleQuantity == 0 {
+			return 0
+		}
+		return math.Round(offer.SalePriceTotal/float64(offer.SaleQuantity)*100) / 100
+	case "percentage":
+		return math.Round(offer.OriginalPrice*float64(100-offer.Discount)) / 100
+	default:
+		return offer.SalePrice
+	}
+}
+
+// offerIdentity is the key offers are matched on between runs. The product key is
+// stable across weeks, whereas the product URL changes with every new promotion.
+func offerIdentity(offer models.Offer) string {
+	if offer.ProductKey != "" {
+		return offer.ProductKey
+	}
+	return "name:" + NormalizeProductName(offer.Name)
+}
+
+// DiffOffers compares the previous and the current offers of one store and returns
+// the change events between them. Offers with the same identity are paired in order.
+func DiffOffers(previous, current []models.Offer, detectedAt time.Time) []models.OfferChange {
+	remaining := make(map[string][]models.Offer)
+	for _, offer := range previous {
+		key := offerIdentity(offer)
+		remaining[key] = append(remaining[key], offer)
+	}
+
+	var changes []models.OfferChange
+	for _, offer := range current {
+		key := offerIdentity(offer)
+		candidates := remaining[key]
+		if len(candidates) == 0 {
+			change := newChange(offer, models.OfferChangeNew, detectedAt)
+			change.NewType = offer.Type
+			change.NewPrice = unitPrice(offer)
+			change.NewDiscountPercentage = offer.DiscountPercentage
+			changes = append(changes, change)
+			continue
+		}
+		old := candidates[0]
+		remaining[key] = candidates[1:]
+		changes = append(changes, compareOffers(old, offer, detectedAt)...)
+	}
+
+	// Whatever was not matched is no longer advertised
+	for _, offer := range previous {
+		key := offerIdentity(offer)
+		if len(remaining[key]) == 0 {
+			continue
+		}
+		old := remaining[key][0]
+		remaining[key] = remaining[key][1:]
+		change := newChange(old, models.OfferChangeEnded, detectedAt)
+		change.OldType = old.Type
+		change.OldPrice = unitPrice(old)
+		change.OldDiscountPercentage = old.DiscountPercentage
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// compareOffers returns one event per property that differs between two matched offers.
+func compareOffers(old, current models.Offer, detectedAt time.Time) []models.OfferChange {
+	var changes []models.OfferChange
+	fill := func(change models.OfferChange) models.OfferChange {
+		change.OldType, change.NewType = old.Type, current.Type
+		change.OldPrice, change.NewPrice = unitPrice(old), unitPrice(current)
+		change.OldDiscountPercentage, change.NewDiscountPercentage = old.DiscountPercentage, current.DiscountPercentage
+		return change
+	}
+
+	if old.Type != current.Type {
+		changes = append(changes, fill(newChange(current, models.OfferChangeType, detectedAt)))
+	}
+	if math.Abs(unitPrice(old)-unitPrice(current)) > priceTolerance {
+		changes = append(changes, fill(newChange(current, models.OfferChangePrice, detectedAt)))
+	}
+	switch diff := current.DiscountPercentage - old.DiscountPercentage; {
+	case diff > priceTolerance:
+		changes = append(changes, fill(newChange(current, models.OfferChangeDiscountImproved, detectedAt)))
+	case diff < -priceTolerance:
+		changes = append(changes, fill(newChange(current, models.OfferChangeDiscountWorsened, detectedAt)))
+	}
+	return changes
+}
+
+func newChange(offer models.Offer, kind string, detectedAt time.Time) models.OfferChange {
+	return models.OfferChange{
+		StoreID:    offer.StoreID,
+		StoreName:  offer.StoreName,
+		Name:       offer.Name,
+		ProductURL: offer.ProductURL,
+		ProductID:  offer.ProductID,
+		Kind:       kind,
+		DetectedAt: detectedAt,
+	}
+}
+
+// ChangeTracker compares a store's freshly scraped offers with what the previous run stored.
+type ChangeTracker struct {
+	Offers  repository.OfferRepository
+	Changes repository.OfferChangeRepository
+}
+
+// NewChangeTracker creates a new tracker with dependencies.
+func NewChangeTracker(offers repository.OfferRepository, changes repository.OfferChangeRepository) *ChangeTracker {
+	return &ChangeTracker{
+		Offers:  offers,
+		Changes: changes,
+	}
+}
+
+// Previous loads the offers the previous run left for a registered store. It must be
+// called before the new offers are saved, since saving overwrites the previous state.
+func (t *ChangeTracker) Previous(ctx context.Context, store models.Store) ([]models.Offer, error) {
+	previous, err := t.Offers.GetLatestStoreOffers(ctx, store.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load previous offers for %s: %w", store.Name, err)
+	}
+	return previous, nil
+}
+
+// Diff computes the change events between the previous and the current offers of a store.
+func (t *ChangeTracker) Diff(previous, offers []models.Offer) []models.OfferChange {
+	return DiffOffers(previous, offers, time.Now())
+}
+
+// Record stores change events computed by Diff.
+func (t *ChangeTracker) Record(ctx context.Context, changes []models.OfferChange) error {
+	return t.Changes.InsertChanges(ctx, changes)
+}
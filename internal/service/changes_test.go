@@ -0,0 +1,123 @@
+package service
+
+import (
+	"grocery_scraper/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffOffers(t *testing.T) {
+	detectedAt := time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)
+	offer := func(key, name, kind string, salePrice, discountPercentage float64) models.Offer {
+		return models.Offer{StoreName: "ICA Maxi", Name: name, ProductKey: key, Type: kind, SalePrice: salePrice, DiscountPercentage: discountPercentage}
+	}
+	coffee := offer("name:kaffe", "Kaffe", "regular", 39.90, 20)
+
+	// change is the part of an OfferChange the diff decides
+	type change struct {
+		Kind               string
+		Name               string
+		OldType, NewType   string
+		OldPrice, NewPrice float64
+		OldDiscount        float64
+		NewDiscount        float64
+	}
+	tests := []struct {
+		name     string
+		previous []models.Offer
+		current  []models.Offer
+		want     []change
+	}{
+		{
+			name:    "new offer",
+			current: []models.Offer{coffee},
+			want:    []change{{Kind: models.OfferChangeNew, Name: "Kaffe", NewType: "regular", NewPrice: 39.90, NewDiscount: 20}},
+		},
+		{
+			name:     "ended offer",
+			previous: []models.Offer{coffee},
+			want:     []change{{Kind: models.OfferChangeEnded, Name: "Kaffe", OldType: "regular", OldPrice: 39.90, OldDiscount: 20}},
+		},
+		{
+			name:     "unchanged offer",
+			previous: []models.Offer{coffee},
+			current:  []models.Offer{offer("name:kaffe", "Kaffe", "regular", 39.901, 20.001)},
+		},
+		{
+			name:     "price changed",
+			previous: []models.Offer{coffee},
+			current:  []models.Offer{offer("name:kaffe", "Kaffe", "regular", 35, 20)},
+			want: []change{{Kind: models.OfferChangePrice, Name: "Kaffe", OldType: "regular", NewType: "regular",
+				OldPrice: 39.90, NewPrice: 35, OldDiscount: 20, NewDiscount: 20}},
+		},
+		{
+			name:     "discount improved",
+			previous: []models.Offer{coffee},
+			current:  []models.Offer{offer("name:kaffe", "Kaffe", "regular", 39.90, 30)},
+			want: []change{{Kind: models.OfferChangeDiscountImproved, Name: "Kaffe", OldType: "regular", NewType: "regular",
+				OldPrice: 39.90, NewPrice: 39.90, OldDiscount: 20, NewDiscount: 30}},
+		},
+		{
+			name:     "discount worsened",
+			previous: []models.Offer{coffee},
+			current:  []models.Offer{offer("name:kaffe", "Kaffe", "regular", 39.90, 10)},
+			want: []change{{Kind: models.OfferChangeDiscountWorsened, Name: "Kaffe", OldType: "regular", NewType: "regular",
+				OldPrice: 39.90, NewPrice: 39.90, OldDiscount: 20, NewDiscount: 10}},
+		},
+		{
+			name:     "type changed",
+			previous: []models.Offer{coffee},
+			current:  []models.Offer{offer("name:kaffe", "Kaffe", "member", 39.90, 20)},
+			want: []change{{Kind: models.OfferChangeType, Name: "Kaffe", OldType: "regular", NewType: "member",
+				OldPrice: 39.90, NewPrice: 39.90, OldDiscount: 20, NewDiscount: 20}},
+		},
+		{
+			name:     "multibuy compared by unit price",
+			previous: []models.Offer{coffee},
+			current: []models.Offer{{StoreName: "ICA Maxi", Name: "Kaffe", ProductKey: "name:kaffe", Type: "multibuy",
+				SaleQuantity: 2, SalePriceTotal: 70, DiscountPercentage: 20}},
+			want: []change{
+				{Kind: models.OfferChangeType, Name: "Kaffe", OldType: "regular", NewType: "multibuy",
+					OldPrice: 39.90, NewPrice: 35, OldDiscount: 20, NewDiscount: 20},
+				{Kind: models.OfferChangePrice, Name: "Kaffe", OldType: "regular", NewType: "multibuy",
+					OldPrice: 39.90, NewPrice: 35, OldDiscount: 20, NewDiscount: 20},
+			},
+		},
+		{
+			name:     "matched on the product key, not the name",
+			previous: []models.Offer{offer("ean:7310050001234", "Bryggkaffe", "regular", 39.90, 20)},
+			current:  []models.Offer{offer("ean:7310050001234", "Bryggkaffe mellanrost", "regular", 39.90, 20)},
+		},
+		{
+			name:     "offers without a product key matched on the normalized name",
+			previous: []models.Offer{offer("", "Kaffe 500g", "regular", 39.90, 20)},
+			current:  []models.Offer{offer("", "KAFFE 500 g", "regular", 39.90, 20)},
+		},
+		{
+			name:     "duplicates paired in order",
+			previous: []models.Offer{coffee, coffee},
+			current:  []models.Offer{coffee},
+			want:     []change{{Kind: models.OfferChangeEnded, Name: "Kaffe", OldType: "regular", OldPrice: 39.90, OldDiscount: 20}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []change
+			for _, c := range DiffOffers(tt.previous, tt.current, detectedAt) {
+				if !c.DetectedAt.Equal(detectedAt) || c.StoreName != "ICA Maxi" {
+					t.Errorf("change %s has store %q and time %v", c.Kind, c.StoreName, c.DetectedAt)
+				}
+				got = append(got, change{
+					Kind: c.Kind, Name: c.Name,
+					OldType: c.OldType, NewType: c.NewType,
+					OldPrice: c.OldPrice, NewPrice: c.NewPrice,
+					OldDiscount: c.OldDiscountPercentage, NewDiscount: c.NewDiscountPercentage,
+				})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("DiffOffers() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
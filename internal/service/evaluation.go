@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/llm"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// NoCategory is the confusion matrix row and column for a missing category: a
+// product that got no category where one was expected, or got an extra one.
+const NoCategory = "(none)"
+
+// EvaluationCase is a labelled product: its name and the categories it should get.
+type EvaluationCase struct {
+	Product    string   `yaml:"product"`
+	Categories []string `yaml:"categories"`
+}
+
+// EvaluationSet is the content of a labelled dataset file.
+type EvaluationSet struct {
+	Products []EvaluationCase `yaml:"products"`
+}
+
+// LoadEvaluationSet reads a labelled dataset. With a taxonomy, the expected
+// categories may be given as IDs or labels and are resolved to IDs; unknown
+// categories are an error so that a typo does not count against the categorizer.
+func LoadEvaluationSet(path string, taxonomy *Taxonomy) ([]EvaluationCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evaluation dataset: %w", err)
+	}
+	var set EvaluationSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse evaluation dataset %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(set.Products))
+	for i, c := range set.Products {
+		if c.Product == "" || len(c.Categories) == 0 {
+			return nil, fmt.Errorf("evaluation case %d: product and categories are required", i+1)
+		}
+		if seen[c.Product] {
+			return nil, fmt.Errorf("evaluation case %d: duplicate product %q", i+1, c.Product)
+		}
+		seen[c.Product] = true
+		if taxonomy == nil {
+			continue
+		}
+		ids := make([]string, 0, len(c.Categories))
+		for _, category := range c.Categories {
+			id, ok := taxonomy.Resolve(category, false)
+			if !ok {
+				return nil, fmt.Errorf("evaluation case %q: category %q is not in the taxonomy", c.Product, category)
+			}
+			ids = append(ids, id)
+		}
+		set.Products[i].Categories = ids
+	}
+	return set.Products, nil
+}
+
+// EvaluationResult is what the categorizer answered for one labelled product.
+type EvaluationResult struct {
+	Product   string   `json:"product"`
+	Expected  []string `json:"expected"`
+	Predicted []string `json:"predicted"`
+	// Failure is the categorizer's reason when the product got no categories
+	Failure string `json:"failure,omitempty"`
+}
+
+// ExactMatch reports whether the predicted categories are exactly the expected ones.
+func (r EvaluationResult) ExactMatch() bool {
+	if len(r.Expected) != len(r.Predicted) {
+		return false
+	}
+	for _, category := range r.Expected {
+		if !slices.Contains(r.Predicted, category) {
+			return false
+		}
+	}
+	return true
+}
+
+// CategoryScore is the precision and recall of a single category.
+type CategoryScore struct {
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+func (s *CategoryScore) compute() {
+	s.Precision = ratio(s.TruePositives, s.TruePositives+s.FalsePositives)
+	s.Recall = ratio(s.TruePositives, s.TruePositives+s.FalseNegatives)
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+}
+
+// ratio is n/total, or 0 for an empty total.
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// LatencyStats describes how long the categorizer took. Batches are the calls
+// the evaluation made, one per batch of products.
+type LatencyStats struct {
+	Total      time.Duration `json:"total"`
+	PerProduct time.Duration `json:"perProduct"`
+	BatchP50   time.Duration `json:"batchP50"`
+	BatchP95   time.Duration `json:"batchP95"`
+	BatchMax   time.Duration `json:"batchMax"`
+}
+
+// EvaluationReport is the outcome of running a categorizer over a labelled dataset.
+// Reports are saved as JSON so later runs can be compared against them.
+type EvaluationReport struct {
+	// Name identifies the run, e.g. the categorizer and model
+	Name      string    `json:"name"`
+	Dataset   string    `json:"dataset"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Products     int `json:"products"`
+	Categorized  int `json:"categorized"`
+	ExactMatches int `json:"exactMatches"`
+	// Precision, Recall and F1 are micro-averaged over all categories
+	Precision  float64                   `json:"precision"`
+	Recall     float64                   `json:"recall"`
+	F1         float64                   `json:"f1"`
+	Categories map[string]*CategoryScore `json:"categories"`
+	// Confusion counts expected (outer key) against predicted (inner key) categories
+	Confusion map[string]map[string]int `json:"confusion"`
+
+	Latency LatencyStats `json:"latency"`
+	Usage   llm.Usage    `json:"usage"`
+	// Cost is the price of Usage at the prices given to the evaluation
+	Cost float64 `json:"cost"`
+
+	Results []EvaluationResult `json:"results"`
+}
+
+// EvaluateCategorizer runs the categorizer over the cases, batchSize products per
+// call, and scores its answers. A failing call fails only the products of its
+// batch; the evaluation goes on with the next one.
+func EvaluateCategorizer(ctx context.Context, categorizer Categorizer, cases []EvaluationCase, batchSize int) (*EvaluationReport, error) {
+	if batchSize <= 0 {
+		batchSize = len(cases)
+	}
+	report := &EvaluationReport{CreatedAt: time.Now()}
+	var batchTimes []time.Duration
+
+	for i := 0; i < len(cases); i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch := cases[i:min(i+batchSize, len(cases))]
+		products := make([]string, 0, len(batch))
+		for _, c := range batch {
+			products = append(products, c.Product)
+		}
+
+		start := time.Now()
+		result, err := categorizer.Categorize(ctx, products)
+		batchTimes = append(batchTimes, time.Since(start))
+		if result == nil {
+			result = NewCategorizationResult()
+		}
+		if err != nil {
+			result.FailAll(products, fmt.Sprintf("categorizer failed: %v", err))
+		}
+
+		for _, c := range batch {
+			res := EvaluationResult{
+				Product:   c.Product,
+				Expected:  c.Categories,
+				Predicted: result.Categories[c.Product],
+			}
+			if len(res.Predicted) == 0 {
+				res.Failure = result.Failed[c.Product]
+				if res.Failure == "" {
+					res.Failure = "not categorized"
+				}
+			}
+			report.Results = append(report.Results, res)
+		}
+	}
+
+	report.score()
+	report.Latency = latencyStats(batchTimes, len(cases))
+	return report, nil
+}
+
+// score computes the metrics from the results.
+func (r *EvaluationReport) score() {
+	r.Products = len(r.Results)
+	r.Categorized, r.ExactMatches = 0, 0
+	r.Categories = make(map[string]*CategoryScore)
+	r.Confusion = make(map[string]map[string]int)
+	var total CategoryScore
+
+	scoreOf := func(category string) *CategoryScore {
+		if r.Categories[category] == nil {
+			r.Categories[category] = &CategoryScore{}
+		}
+		return r.Categories[category]
+	}
+
+	for _, res := range r.Results {
+		if len(res.Predicted) > 0 {
+			r.Categorized++
+		}
+		if res.ExactMatch() {
+			r.ExactMatches++
+		}
+
+		var missed, extra []string
+		for _, category := range res.Expected {
+			if slices.Contains(res.Predicted, category) {
+				scoreOf(category).TruePositives++
+				total.TruePositives++
+				r.confuse(category, category)
+			} else {
+				scoreOf(category).FalseNegatives++
+				total.FalseNegatives++
+				missed = append(missed, category)
+			}
+		}
+		for _, category := range res.Predicted {
+			if !slices.Contains(res.Expected, category) {
+				scoreOf(category).FalsePositives++
+				total.FalsePositives++
+				extra = append(extra, category)
+			}
+		}
+
+		// Every missed category was confused with every wrong one; with nothing to
+		// pair with, a category was simply missed or added
+		switch {
+		case len(missed) > 0 && len(extra) > 0:
+			for _, expected := range missed {
+				for _, predicted := range extra {
+					r.confuse(expected, predicted)
+				}
+			}
+		case len(missed) > 0:
+			for _, expected := range missed {
+				r.confuse(expected, NoCategory)
+			}
+		case len(extra) > 0:
+			for _, predicted := range extra {
+				r.confuse(NoCategory, predicted)
+			}
+		}
+	}
+
+	for _, s := range r.Categories {
+		s.compute()
+	}
+	total.compute()
+	r.Precision, r.Recall, r.F1 = total.Precision, total.Recall, total.F1
+}
+
+func (r *EvaluationReport) confuse(expected, predicted string) {
+	if r.Confusion[expected] == nil {
+		r.Confusion[expected] = make(map[string]int)
+	}
+	r.Confusion[expected][predicted]++
+}
+
+func latencyStats(batchTimes []time.Duration, products int) LatencyStats {
+	var stats LatencyStats
+	if len(batchTimes) == 0 {
+		return stats
+	}
+	for _, d := range batchTimes {
+		stats.Total += d
+	}
+	if products > 0 {
+		stats.PerProduct = stats.Total / time.Duration(products)
+	}
+	sorted := slices.Clone(batchTimes)
+	slices.Sort(sorted)
+	percentile := func(p float64) time.Duration {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	stats.BatchP50 = percentile(0.5)
+	stats.BatchP95 = percentile(0.95)
+	stats.BatchMax = sorted[len(sorted)-1]
+	return stats
+}
+
+// ScoreDelta is how a score changed from the baseline to the current report.
+type ScoreDelta struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// EvaluationDiff compares a report against a baseline report.
+type EvaluationDiff struct {
+	Overall ScoreDelta `json:"overall"`
+	// Categories holds the categories whose scores changed
+	Categories map[string]ScoreDelta `json:"categories"`
+	// Fixed are the products that are now categorized exactly right, Broken the ones that no longer are
+	Fixed  []string `json:"fixed"`
+	Broken []string `json:"broken"`
+	// Added and Removed are products that are only in one of the datasets
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+
+	PerProductLatency time.Duration `json:"perProductLatency"`
+	Cost              float64       `json:"cost"`
+}
+
+// DiffEvaluations compares current against baseline. Deltas are current minus baseline.
+func DiffEvaluations(baseline, current *EvaluationReport) EvaluationDiff {
+	diff := EvaluationDiff{
+		Overall: ScoreDelta{
+			Precision: current.Precision - baseline.Precision,
+			Recall:    current.Recall - baseline.Recall,
+			F1:        current.F1 - baseline.F1,
+		},
+		Categories:        make(map[string]ScoreDelta),
+		PerProductLatency: current.Latency.PerProduct - baseline.Latency.PerProduct,
+		Cost:              current.Cost - baseline.Cost,
+	}
+
+	empty := &CategoryScore{}
+	for category := range mergedKeys(baseline.Categories, current.Categories) {
+		before, after := baseline.Categories[category], current.Categories[category]
+		if before == nil {
+			before = empty
+		}
+		if after == nil {
+			after = empty
+		}
+		delta := ScoreDelta{
+			Precision: after.Precision - before.Precision,
+			Recall:    after.Recall - before.Recall,
+			F1:        after.F1 - before.F1,
+		}
+		if delta != (ScoreDelta{}) {
+			diff.Categories[category] = delta
+		}
+	}
+
+	before := make(map[string]EvaluationResult, len(baseline.Results))
+	for _, res := range baseline.Results {
+		before[res.Product] = res
+	}
+	for _, res := range current.Results {
+		prev, ok := before[res.Product]
+		delete(before, res.Product)
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, res.Product)
+		case res.ExactMatch() && !prev.ExactMatch():
+			diff.Fixed = append(diff.Fixed, res.Product)
+		case !res.ExactMatch() && prev.ExactMatch():
+			diff.Broken = append(diff.Broken, res.Product)
+		}
+	}
+	for product := range before {
+		diff.Removed = append(diff.Removed, product)
+	}
+	slices.Sort(diff.Removed)
+	return diff
+}
+
+func mergedKeys[V any](a, b map[string]V) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
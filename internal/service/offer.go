@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"grocery_scraper/internal/models"
 	"grocery_scraper/internal/parser"
-	"grocery_scraper/internal/repository"
-	"io"
 	"math"
 	"regexp"
 	"strconv"
@@ -19,23 +17,22 @@ const ICA_BASE_URL = "https://www.ica.se/erbjudanden"
 // OfferService defines the business logic contract.
 type OfferService interface {
 	GetStoreOffers(ctx context.Context, store models.Store) ([]models.Offer, error)
+	ProcessStore(ctx context.Context, store models.Store) (*OfferBatch, error)
+	ProcessStores(ctx context.Context, stores []models.Store) ([]*OfferBatch, error)
 }
 
-// offerService is the concrete service implementation
-// It now depends on the Repository (for low-level data access/fetching)
-// and the OfferExtractor (for raw HTML parsing).
+// offerService is the concrete service implementation.
+// All the work (fetching, parsing, normalizing, validating, categorizing) is done
+// by the stages of its pipeline.
 type offerService struct {
-	Repo        repository.ICARepository
-	Parser      parser.OfferParser
-	Categorizer Categorizer // <-- New dependency
+	Pipeline *Pipeline
 }
 
-// NewOfferService creates a new service instance with dependencies.
-func NewOfferService(repo repository.ICARepository, extractor parser.OfferParser, categorizer Categorizer) OfferService {
+// NewOfferService creates a new service instance running the given pipeline.
+// Use NewDefaultPipeline for the standard stages and register extra ones on it.
+func NewOfferService(pipeline *Pipeline) OfferService {
 	return &offerService{
-		Repo:        repo,
-		Parser:      extractor,
-		Categorizer: categorizer,
+		Pipeline: pipeline,
 	}
 }
 
@@ -158,91 +155,73 @@ func getValidityPeriod() (time.Time, time.Time) {
 	return start, end
 }
 
-// GetStoreOffers orchestrates the fetching, parsing, transformation, and calculation steps.
-func (s *offerService) GetStoreOffers(ctx context.Context, store models.Store) ([]models.Offer, error) {
-	// 1. Fetch HTML content (Repository responsibility)
-	storeURLStr := fmt.Sprintf("%s/%s", ICA_BASE_URL, store.URLSlug)
-	htmlReader, err := s.Repo.Fetch(ctx, storeURLStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch rendered HTML for %s: %w", store.Name, err)
+// normalizeOffer transforms a raw offer card into a structured Offer and computes its discount.
+func normalizeOffer(store models.Store, rawDeal parser.RawOffer, validFrom, validTo time.Time) models.Offer {
+	// Extract Original Price
+	originalPrice := 0.0
+	if match := originalPriceRegex.FindStringSubmatch(rawDeal.OriginalText); len(match) > 1 {
+		originalPrice = parsePrice(match[1])
 	}
 
-	// Ensure the reader is closed if it's an io.Closer
-	if closer, ok := htmlReader.(io.Closer); ok {
-		defer closer.Close()
+	deal := models.Offer{
+		StoreID:       storeID(store),
+		Source:        models.OfferSourceICA,
+		PromotionID:   rawDeal.PromotionID,
+		StoreName:     store.Name,
+		Name:          rawDeal.Name,
+		OriginalPrice: originalPrice,
+		Type:          "unknown",
+		ValidFrom:     validFrom,
+		ValidTo:       validTo,
 	}
-
-	// 2. Parse Raw Data (Parser responsibility)
-	rawDeals, err := s.Parser.ParseRawOffers(ctx, htmlReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to extract raw offers for %s: %w", store.Name, err)
+	// Construct the final, usable URL
+	deal.ProductURL = fmt.Sprintf("%s/%s?id=%s&action=details", ICA_BASE_URL, store.URLSlug, rawDeal.PromotionID)
+
+	// Determine Offer Type and Extract Sale Details
+	if percentageMatch := percentageRegex.FindStringSubmatch(rawDeal.DealText); len(percentageMatch) > 1 {
+		deal.Type = "percentage"
+		deal.Discount, _ = strconv.Atoi(percentageMatch[1])
+	} else if multibuyMatch := multibuyRegex.FindStringSubmatch(rawDeal.DealText); len(multibuyMatch) > 2 {
+		deal.Type = "multibuy"
+		deal.SaleQuantity, _ = strconv.Atoi(multibuyMatch[1])
+		deal.SalePriceTotal = parsePrice(multibuyMatch[2])
+	} else if singlePriceMatch := singlePriceRegex.FindStringSubmatch(rawDeal.DealText); len(singlePriceMatch) > 1 {
+		deal.Type = "single"
+		deal.SalePrice = parsePrice(singlePriceMatch[1])
 	}
 
-	// 3. Transform Raw Data into structured Offers (Service Business Logic)
-	var productNames []string
-	var tempOffers []models.Offer
-
-	validFrom, validTo := getValidityPeriod()
-
-	for _, rawDeal := range rawDeals {
-		// Extract Original Price
-		originalPrice := 0.0
-		if match := originalPriceRegex.FindStringSubmatch(rawDeal.OriginalText); len(match) > 1 {
-			originalPrice = parsePrice(match[1])
-		}
+	if originalPrice == 0 {
+		deal.OriginalPrice = deal.SalePrice
+	}
 
-		deal := models.Offer{
-			StoreName:     store.Name,
-			Name:          rawDeal.Name,
-			OriginalPrice: originalPrice,
-			Type:          "unknown",
-			ValidFrom:     validFrom,
-			ValidTo:       validTo,
-		}
-		// Construct the final, usable URL
-		deal.ProductURL = fmt.Sprintf("%s/%s?id=%s&action=details", ICA_BASE_URL, store.URLSlug, rawDeal.PromotionID)
-
-		// Determine Offer Type and Extract Sale Details
-		if percentageMatch := percentageRegex.FindStringSubmatch(rawDeal.DealText); len(percentageMatch) > 1 {
-			deal.Type = "percentage"
-			deal.Discount, _ = strconv.Atoi(percentageMatch[1])
-		} else if multibuyMatch := multibuyRegex.FindStringSubmatch(rawDeal.DealText); len(multibuyMatch) > 2 {
-			deal.Type = "multibuy"
-			deal.SaleQuantity, _ = strconv.Atoi(multibuyMatch[1])
-			deal.SalePriceTotal = parsePrice(multibuyMatch[2])
-		} else if singlePriceMatch := singlePriceRegex.FindStringSubmatch(rawDeal.DealText); len(singlePriceMatch) > 1 {
-			deal.Type = "single"
-			deal.SalePrice = parsePrice(singlePriceMatch[1])
-		}
+	// Calculate Final Discount Percentage
+	deal.DiscountPercentage = calculateDiscount(deal)
 
-		if originalPrice == 0 {
-			deal.OriginalPrice = deal.SalePrice
-		}
-
-		// Calculate Final Discount Percentage
-		deal.DiscountPercentage = calculateDiscount(deal)
+	return deal
+}
 
-		tempOffers = append(tempOffers, deal)
-		productNames = append(productNames, deal.Name)
+// ProcessStore runs the store through the pipeline, as a run of its own, and returns
+// the resulting batch, including the per-stage reports.
+func (s *offerService) ProcessStore(ctx context.Context, store models.Store) (*OfferBatch, error) {
+	batches, err := s.Pipeline.RunStores(ctx, []models.Store{store})
+	if err == nil {
+		err = batches[0].Err
 	}
+	return batches[0], err
+}
 
-	// 4. Categorize Products (AI Enhancement)
-	// Only categorize if we have a categorizer and products
-	if s.Categorizer != nil && len(productNames) > 0 {
-		categoriesMap, err := s.Categorizer.Categorize(ctx, productNames)
-		if err != nil {
-			// Log error but don't fail the whole scraping process?
-			// For now, let's just log it.
-			fmt.Printf("Warning: Failed to categorize products for %s: %v\n", store.Name, err)
-		} else {
-			// Assign categories back to offers
-			for i := range tempOffers {
-				if cats, ok := categoriesMap[tempOffers[i].Name]; ok {
-					tempOffers[i].Categories = cats
-				}
-			}
-		}
-	}
+// ProcessStores runs all stores through the pipeline as one run, so the run stages
+// (e.g. categorization) handle the offers of all stores together. Check the Err of
+// every batch; the returned error is only set when a run stage failed.
+func (s *offerService) ProcessStores(ctx context.Context, stores []models.Store) ([]*OfferBatch, error) {
+	return s.Pipeline.RunStores(ctx, stores)
+}
 
-	return tempOffers, nil
+// GetStoreOffers runs the pipeline for a store and returns the offers that made it through.
+func (s *offerService) GetStoreOffers(ctx context.Context, store models.Store) ([]models.Offer, error) {
+	batch, err := s.ProcessStore(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	return batch.Offers(), nil
 }
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/parser"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// OfferItem is a single offer moving through the pipeline, together with the raw
+// card data it was parsed from.
+type OfferItem struct {
+	Raw   parser.RawOffer
+	Offer models.Offer
+}
+
+// OfferBatch is the state passed from stage to stage while processing one store.
+// Stages read and replace Items; dropping an item removes it from the result.
+type OfferBatch struct {
+	Store models.Store
+	// StartedAt is when the first stage started
+	StartedAt time.Time
+	// HTML holds the fetched page until it has been parsed
+	HTML io.Reader
+	// Period is the validity period of the scraped offers, set by the normalize stage
+	Period models.ValidityPeriod
+	Items  []*OfferItem
+	// Skipped holds the promotion IDs of the offer cards the parser could not read
+	Skipped []string
+	// Quarantined holds the offers that failed validation
+	Quarantined []models.QuarantinedOffer
+	// Categorization reports which products the categorize stage could not categorize
+	Categorization *CategorizationResult
+	// Reports holds one entry per stage that ran, in order
+	Reports []StageReport
+	// Err is why the store failed; failed stores are left out of the run stages
+	Err error
+}
+
+// Report returns the report of the stage with the given name, if it ran.
+func (b *OfferBatch) Report(stage string) (StageReport, bool) {
+	for _, report := range b.Reports {
+		if report.Stage == stage {
+			return report, true
+		}
+	}
+	return StageReport{}, false
+}
+
+// Offers returns the offers of all items still in the batch.
+func (b *OfferBatch) Offers() []models.Offer {
+	offers := make([]models.Offer, 0, len(b.Items))
+	for _, item := range b.Items {
+		offers = append(offers, item.Offer)
+	}
+	return offers
+}
+
+// PromotionIDs returns the promotion IDs of every offer found on the page, whether it
+// is still in the batch, was quarantined or could not be parsed. The saved offer of a
+// quarantined promotion is withdrawn by the quarantine until it is released.
+func (b *OfferBatch) PromotionIDs() []string {
+	ids := make([]string, 0, len(b.Items)+len(b.Quarantined)+len(b.Skipped))
+	for _, item := range b.Items {
+		ids = append(ids, item.Offer.PromotionID)
+	}
+	for _, offer := range b.Quarantined {
+		ids = append(ids, offer.PromotionID)
+	}
+	return append(ids, b.Skipped...)
+}
+
+// Periods returns the validity periods the scrape covered: the one of the page and
+// those of the offers still in the batch or quarantined.
+func (b *OfferBatch) Periods() []models.ValidityPeriod {
+	var periods []models.ValidityPeriod
+	add := func(p models.ValidityPeriod) {
+		if !p.From.IsZero() && !slices.ContainsFunc(periods, p.Equal) {
+			periods = append(periods, p)
+		}
+	}
+	add(b.Period)
+	for _, item := range b.Items {
+		add(item.Offer.Period())
+	}
+	for _, offer := range b.Quarantined {
+		add(models.ValidityPeriod{From: offer.ValidFrom, To: offer.ValidTo})
+	}
+	return periods
+}
+
+// MinCompleteShare is the share of the offers a store advertised so far that a scrape
+// must find on the page to be complete. A page that loaded only in part would
+// otherwise withdraw the offers it is missing.
+const MinCompleteShare = 0.5
+
+// Incomplete returns why the batch cannot replace the offers its store advertised so
+// far, or "" when it can: the store must not have failed, and its page must hold at
+// least MinCompleteShare of the advertised number of offer cards.
+func (b *OfferBatch) Incomplete(advertised int) string {
+	if b.Err != nil {
+		return "the store failed"
+	}
+	parsed, ok := b.Report(StageParse)
+	if !ok {
+		return "the page was not parsed"
+	}
+	if found := parsed.ItemsOut + len(b.Skipped); float64(found) < MinCompleteShare*float64(advertised) {
+		return fmt.Sprintf("found %d offer cards for %d advertised offers", found, advertised)
+	}
+	return ""
+}
+
+// Stage is a single named step of the offer-processing pipeline.
+type Stage interface {
+	Name() string
+	Process(ctx context.Context, batch *OfferBatch) error
+}
+
+// RunStage is a step that sees the batches of all stores of a run at once, after
+// every store went through the per-store stages. Work shared between stores, like
+// categorization, belongs here so it is done once per run instead of once per store.
+type RunStage interface {
+	Name() string
+	ProcessRun(ctx context.Context, batches []*OfferBatch) error
+}
+
+// stageFunc adapts a plain function to the Stage interface.
+type stageFunc struct {
+	name string
+	fn   func(ctx context.Context, batch *OfferBatch) error
+}
+
+func (s stageFunc) Name() string { return s.name }
+func (s stageFunc) Process(ctx context.Context, batch *OfferBatch) error {
+	return s.fn(ctx, batch)
+}
+
+// StageFunc creates a Stage from a function, for simple custom steps like tagging.
+func StageFunc(name string, fn func(ctx context.Context, batch *OfferBatch) error) Stage {
+	return stageFunc{name: name, fn: fn}
+}
+
+// StageReport records how long a stage took and how many items it saw.
+type StageReport struct {
+	Stage    string
+	Duration time.Duration
+	ItemsIn  int
+	ItemsOut int
+	Err      error
+}
+
+// StageObserver is notified after every stage run, e.g. to export metrics. The
+// pipeline never calls observers concurrently, even while stores run in parallel,
+// so an observer does not need its own locking.
+type StageObserver func(store models.Store, report StageReport)
+
+// Pipeline runs an ordered list of stages for every store, followed by the run
+// stages for all stores together.
+type Pipeline struct {
+	stages    []Stage
+	runStages []RunStage
+	observers []StageObserver
+	// serializes the observer calls of the parallel store runs
+	observeMu sync.Mutex
+}
+
+// NewPipeline creates a pipeline with the given stages.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Append adds a stage at the end of the pipeline.
+func (p *Pipeline) Append(stage Stage) {
+	p.stages = append(p.stages, stage)
+}
+
+// AppendRunStage adds a stage that runs once for all stores, after the per-store stages.
+func (p *Pipeline) AppendRunStage(stage RunStage) {
+	p.runStages = append(p.runStages, stage)
+}
+
+// InsertBefore adds a stage in front of the stage with the given name.
+func (p *Pipeline) InsertBefore(name string, stage Stage) error {
+	i, err := p.indexOf(name)
+	if err != nil {
+		return err
+	}
+	p.insertAt(i, stage)
+	return nil
+}
+
+// InsertAfter adds a stage right after the stage with the given name.
+func (p *Pipeline) InsertAfter(name string, stage Stage) error {
+	i, err := p.indexOf(name)
+	if err != nil {
+		return err
+	}
+	p.insertAt(i+1, stage)
+	return nil
+}
+
+// Remove drops the stage with the given name.
+func (p *Pipeline) Remove(name string) error {
+	i, err := p.indexOf(name)
+	if err != nil {
+		return err
+	}
+	p.stages = append(p.stages[:i], p.stages[i+1:]...)
+	return nil
+}
+
+// Observe registers a function that receives every stage report.
+func (p *Pipeline) Observe(observer StageObserver) {
+	p.observers = append(p.observers, observer)
+}
+
+// notify passes a stage report to every observer, one report at a time.
+func (p *Pipeline) notify(store models.Store, report StageReport) {
+	p.observeMu.Lock()
+	defer p.observeMu.Unlock()
+	for _, observer := range p.observers {
+		observer(store, report)
+	}
+}
+
+// StageNames returns the names of the registered stages in order, run stages last.
+func (p *Pipeline) StageNames() []string {
+	names := make([]string, 0, len(p.stages)+len(p.runStages))
+	for _, stage := range p.stages {
+		names = append(names, stage.Name())
+	}
+	for _, stage := range p.runStages {
+		names = append(names, stage.Name())
+	}
+	return names
+}
+
+// RunStores processes all stores through the per-store stages in parallel and then
+// runs the run stages once over the stores that succeeded. A failing store does not
+// stop the others; its batch carries the error in Err. A run stage can fail a single
+// store the same way, which leaves it out of the later run stages. The batches are
+// returned in store order; the error is only set when a run stage fails as a whole.
+func (p *Pipeline) RunStores(ctx context.Context, stores []models.Store) ([]*OfferBatch, error) {
+	batches := make([]*OfferBatch, len(stores))
+	var g errgroup.Group
+	for i, store := range stores {
+		g.Go(func() error {
+			batch, err := p.Run(ctx, store)
+			batch.Err = err
+			batches[i] = batch
+			return nil
+		})
+	}
+	g.Wait()
+
+	var succeeded []*OfferBatch
+	for _, batch := range batches {
+		if batch.Err == nil {
+			succeeded = append(succeeded, batch)
+		}
+	}
+	if len(succeeded) == 0 {
+		return batches, nil
+	}
+
+	for _, stage := range p.runStages {
+		itemsIn := make([]int, len(succeeded))
+		total := 0
+		for i, batch := range succeeded {
+			itemsIn[i] = len(batch.Items)
+			total += len(batch.Items)
+		}
+		start := time.Now()
+		err := stage.ProcessRun(ctx, succeeded)
+		duration := time.Since(start)
+		log.Printf("[run] stage %s: %d items from %d stores in %s", stage.Name(), total, len(succeeded), duration.Round(time.Millisecond))
+
+		for i, batch := range succeeded {
+			report := StageReport{Stage: stage.Name(), Duration: duration, ItemsIn: itemsIn[i], ItemsOut: len(batch.Items), Err: err}
+			if report.Err == nil {
+				report.Err = batch.Err
+			}
+			batch.Reports = append(batch.Reports, report)
+			p.notify(batch.Store, report)
+		}
+		if err != nil {
+			return batches, fmt.Errorf("stage %s failed: %w", stage.Name(), err)
+		}
+		succeeded = slices.DeleteFunc(succeeded, func(batch *OfferBatch) bool { return batch.Err != nil })
+		if len(succeeded) == 0 {
+			break
+		}
+	}
+	return batches, nil
+}
+
+// Run processes a store through every per-store stage; run stages are left to
+// RunStores. It stops at the first stage that fails; the returned batch still holds
+// the reports of the stages that ran.
+func (p *Pipeline) Run(ctx context.Context, store models.Store) (*OfferBatch, error) {
+	batch := &OfferBatch{Store: store, StartedAt: time.Now()}
+
+	for _, stage := range p.stages {
+		report := StageReport{Stage: stage.Name(), ItemsIn: len(batch.Items)}
+		start := time.Now()
+		err := stage.Process(ctx, batch)
+		report.Duration = time.Since(start)
+		report.ItemsOut = len(batch.Items)
+		report.Err = err
+
+		batch.Reports = append(batch.Reports, report)
+		log.Printf("[%s] stage %s: %d -> %d items in %s", store.Name, report.Stage, report.ItemsIn, report.ItemsOut, report.Duration.Round(time.Millisecond))
+		p.notify(store, report)
+
+		if err != nil {
+			return batch, fmt.Errorf("stage %s failed for %s: %w", stage.Name(), store.Name, err)
+		}
+	}
+
+	return batch, nil
+}
+
+func (p *Pipeline) indexOf(name string) (int, error) {
+	for i, stage := range p.stages {
+		if stage.Name() == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("pipeline has no stage named %q", name)
+}
+
+func (p *Pipeline) insertAt(i int, stage Stage) {
+	p.stages = append(p.stages, nil)
+	copy(p.stages[i+1:], p.stages[i:])
+	p.stages[i] = stage
+}
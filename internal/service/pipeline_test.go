@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOfferBatchPromotionIDs(t *testing.T) {
+	batch := &OfferBatch{
+		Items:       []*OfferItem{{Offer: models.Offer{PromotionID: "1001"}}, {Offer: models.Offer{PromotionID: "1002"}}},
+		Quarantined: []models.QuarantinedOffer{{PromotionID: "1003"}},
+		Skipped:     []string{"1004"},
+	}
+	if got, want := batch.PromotionIDs(), []string{"1001", "1002", "1003", "1004"}; !slices.Equal(got, want) {
+		t.Errorf("PromotionIDs() = %v, want %v", got, want)
+	}
+}
+
+func TestOfferBatchIncomplete(t *testing.T) {
+	parsed := func(cards int, skipped ...string) *OfferBatch {
+		return &OfferBatch{Reports: []StageReport{{Stage: StageParse, ItemsOut: cards}}, Skipped: skipped}
+	}
+	tests := []struct {
+		name       string
+		batch      *OfferBatch
+		advertised int
+		complete   bool
+	}{
+		{name: "first scrape", batch: parsed(3), advertised: 0, complete: true},
+		{name: "same number of cards", batch: parsed(10), advertised: 10, complete: true},
+		{name: "half of the cards", batch: parsed(5), advertised: 10, complete: true},
+		{name: "too few cards", batch: parsed(4), advertised: 10},
+		{name: "skipped cards count as found", batch: parsed(4, "1001"), advertised: 10, complete: true},
+		{name: "failed store", batch: &OfferBatch{Err: errors.New("timeout")}, advertised: 0},
+		{name: "not parsed", batch: &OfferBatch{}, advertised: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.batch.Incomplete(tt.advertised)
+			if (reason == "") != tt.complete {
+				t.Errorf("Incomplete(%d) = %q, want complete %t", tt.advertised, reason, tt.complete)
+			}
+		})
+	}
+}
+
+func TestOfferBatchPeriods(t *testing.T) {
+	week := models.ValidityPeriod{From: time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 10, 18, 23, 59, 59, 0, time.UTC)}
+	next := models.ValidityPeriod{From: week.From.AddDate(0, 0, 7), To: week.To.AddDate(0, 0, 7)}
+
+	// Every card was quarantined: the period still comes from the page
+	batch := &OfferBatch{Period: week, Quarantined: []models.QuarantinedOffer{{ValidFrom: next.From, ValidTo: next.To}}}
+	if got, want := batch.Periods(), []models.ValidityPeriod{week, next}; !slices.Equal(got, want) {
+		t.Errorf("Periods() = %v, want %v", got, want)
+	}
+
+	batch = &OfferBatch{Items: []*OfferItem{{Offer: models.Offer{ValidFrom: week.From, ValidTo: week.To}}}}
+	if got, want := batch.Periods(), []models.ValidityPeriod{week}; !slices.Equal(got, want) {
+		t.Errorf("Periods() = %v, want %v", got, want)
+	}
+	if got := (&OfferBatch{}).Periods(); len(got) != 0 {
+		t.Errorf("an unparsed batch covers the periods %v", got)
+	}
+}
+
+// sleepStage takes a moment per store, so parallel stores overlap.
+type sleepStage struct{ name string }
+
+func (s sleepStage) Name() string { return s.name }
+
+func (s sleepStage) Process(ctx context.Context, batch *OfferBatch) error {
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+func TestPipelineObserversAreSerialized(t *testing.T) {
+	pipeline := NewPipeline(sleepStage{"fetch"}, sleepStage{"parse"}, sleepStage{"save"})
+	var inFlight, overlaps atomic.Int32
+	reports := map[string]int{} // unguarded on purpose: the pipeline serializes the calls
+	pipeline.Observe(func(store models.Store, report StageReport) {
+		if inFlight.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(100 * time.Microsecond)
+		reports[report.Stage]++
+		inFlight.Add(-1)
+	})
+
+	stores := make([]models.Store, 20)
+	for i := range stores {
+		stores[i] = models.Store{ID: uint(i + 1), Name: fmt.Sprintf("store %d", i+1)}
+	}
+	if _, err := pipeline.RunStores(context.Background(), stores); err != nil {
+		t.Fatal(err)
+	}
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("observers ran concurrently %d times", n)
+	}
+	for _, stage := range pipeline.StageNames() {
+		if reports[stage] != len(stores) {
+			t.Errorf("observed %d reports of stage %s, want %d", reports[stage], stage, len(stores))
+		}
+	}
+}
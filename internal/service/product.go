@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/parser"
+	"grocery_scraper/internal/repository"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Matches net sizes like '500 g', '1,5l', '6-pack' or '12 st'. Captures amount (Group 1) and unit (Group 2).
+	sizeRegex = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*-?\s*(kg|hg|g|l|dl|cl|ml|st|p|pack)\b`)
+
+	// Anything that is not a letter or digit is a word separator in normalized names.
+	nonWordRegex = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+	// EANs are 8 or 13 digits (GTIN-8/GTIN-13); 12 and 14 digit GTINs are accepted too.
+	eanRegex = regexp.MustCompile(`^\d{8}$|^\d{12,14}$`)
+)
+
+// unitFactors converts every size unit to its base unit (g, ml or st).
+var unitFactors = map[string]struct {
+	base   string
+	factor float64
+}{
+	"kg":   {"g", 1000},
+	"hg":   {"g", 100},
+	"g":    {"g", 1},
+	"l":    {"ml", 1000},
+	"dl":   {"ml", 100},
+	"cl":   {"ml", 10},
+	"ml":   {"ml", 1},
+	"st":   {"st", 1},
+	"p":    {"st", 1},
+	"pack": {"st", 1},
+}
+
+// NormalizeProductName lowercases a product name, removes sizes and punctuation
+// and collapses whitespace, so "Mellanmjölk 1,5l" and "MELLANMJÖLK" compare equal.
+func NormalizeProductName(name string) string {
+	name = strings.ToLower(name)
+	name = sizeRegex.ReplaceAllString(name, " ")
+	name = nonWordRegex.ReplaceAllString(name, " ")
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// extractSize returns the first net size found in the texts, converted to its base unit.
+func extractSize(texts ...string) (float64, string) {
+	for _, text := range texts {
+		match := sizeRegex.FindStringSubmatch(strings.ToLower(text))
+		if len(match) < 3 {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", "."), 64)
+		if err != nil || amount <= 0 {
+			continue
+		}
+		unit := unitFactors[match[2]]
+		return amount * unit.factor, unit.base
+	}
+	return 0, ""
+}
+
+// extractBrand takes the brand from the card text. ICA cards start with the brand
+// (or the country of origin) followed by a period, e.g. "Arla. 1,5 l. Jmf-pris ...".
+func extractBrand(cardText string) string {
+	first, _, found := strings.Cut(strings.TrimSpace(cardText), ".")
+	if !found {
+		return ""
+	}
+	first = strings.TrimSpace(first)
+	lower := strings.ToLower(first)
+	if first == "" || len(first) > 40 || strings.Contains(lower, "pris") || sizeRegex.MatchString(lower) || strings.ContainsAny(first, "0123456789") {
+		return ""
+	}
+	return first
+}
+
+// IdentifyProduct computes the product identity of an offer. A valid EAN is the
+// strongest identity; otherwise the normalized name, brand and size are combined.
+func IdentifyProduct(raw parser.RawOffer, offer models.Offer) models.ProductIdentity {
+	size, unit := extractSize(offer.Name, raw.OriginalText)
+	identity := models.ProductIdentity{
+		CanonicalName: NormalizeProductName(offer.Name),
+		Brand:         extractBrand(raw.OriginalText),
+		Size:          size,
+		Unit:          unit,
+	}
+
+	if eanRegex.MatchString(raw.EAN) {
+		identity.EAN = raw.EAN
+		identity.Key = "ean:" + raw.EAN
+		return identity
+	}
+
+	identity.Key = fmt.Sprintf("name:%s|brand:%s|size:%s%s",
+		identity.CanonicalName,
+		NormalizeProductName(identity.Brand),
+		strconv.FormatFloat(size, 'f', -1, 64), unit)
+	return identity
+}
+
+// ProductMatchStage links every offer to a canonical product shared across stores.
+type ProductMatchStage struct {
+	Products repository.ProductRepository
+}
+
+func (s *ProductMatchStage) Name() string { return StageMatchProducts }
+
+func (s *ProductMatchStage) Process(ctx context.Context, batch *OfferBatch) error {
+	// Offers with the same identity in one store resolve to the same product
+	resolved := make(map[string]uint)
+	for _, item := range batch.Items {
+		identity := IdentifyProduct(item.Raw, item.Offer)
+		productID, ok := resolved[identity.Key]
+		if !ok {
+			var err error
+			productID, err = s.Products.ResolveProduct(ctx, identity)
+			if err != nil {
+				return err
+			}
+			resolved[identity.Key] = productID
+		}
+		item.Offer.ProductKey = identity.Key
+		item.Offer.ProductID = &productID
+	}
+	return nil
+}
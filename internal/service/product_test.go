@@ -0,0 +1,85 @@
+package service
+
+import (
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/parser"
+	"testing"
+)
+
+func TestNormalizeProductName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Mellanmjölk 1,5l", want: "mellanmjölk"},
+		{name: "MELLANMJÖLK", want: "mellanmjölk"},
+		{name: "Kaffe 500g", want: "kaffe"},
+		{name: "KAFFE 500 g", want: "kaffe"},
+		{name: "Laxfilé 2 hg", want: "laxfilé"},
+		{name: "Coca-Cola Zero 6-pack", want: "coca cola zero"},
+		{name: "Ägg 12 st, frigående", want: "ägg frigående"},
+		{name: "Tomater i bitar 3x400g", want: "tomater i bitar 3x"},
+		{name: "Gouda 28% lagrad", want: "gouda 28 lagrad"},
+		{name: "  Bananer  ", want: "bananer"},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeProductName(tt.name); got != tt.want {
+				t.Errorf("NormalizeProductName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifyProduct(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  parser.RawOffer
+		want models.ProductIdentity
+	}{
+		{
+			name: "EAN",
+			raw:  parser.RawOffer{EAN: "7310865004703", Name: "Mellanmjölk 1,5l", OriginalText: "Arla. 1,5 l. Jmf-pris 13,27 kr/l."},
+			want: models.ProductIdentity{Key: "ean:7310865004703", CanonicalName: "mellanmjölk", Brand: "Arla",
+				Size: 1500, Unit: "ml", EAN: "7310865004703"},
+		},
+		{
+			name: "size from the card text",
+			raw:  parser.RawOffer{Name: "Kaffe", OriginalText: "Gevalia. 450 g. Jmf-pris 88,67 kr/kg."},
+			want: models.ProductIdentity{Key: "name:kaffe|brand:gevalia|size:450g", CanonicalName: "kaffe", Brand: "Gevalia",
+				Size: 450, Unit: "g"},
+		},
+		{
+			name: "invalid EAN",
+			raw:  parser.RawOffer{EAN: "12345", Name: "Ägg 12 st", OriginalText: "Sverige. Frigående."},
+			want: models.ProductIdentity{Key: "name:ägg|brand:sverige|size:12st", CanonicalName: "ägg", Brand: "Sverige",
+				Size: 12, Unit: "st"},
+		},
+		{
+			name: "size converted to the base unit",
+			raw:  parser.RawOffer{Name: "Potatis 1,5kg"},
+			want: models.ProductIdentity{Key: "name:potatis|brand:|size:1500g", CanonicalName: "potatis", Size: 1500, Unit: "g"},
+		},
+		{
+			name: "no brand or size",
+			raw:  parser.RawOffer{Name: "Bananer", OriginalText: "Jmf-pris 24,90 kr/kg."},
+			want: models.ProductIdentity{Key: "name:bananer|brand:|size:0", CanonicalName: "bananer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IdentifyProduct(tt.raw, models.Offer{Name: tt.raw.Name})
+			if got != tt.want {
+				t.Errorf("IdentifyProduct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// The same product written differently by two stores gets the same key
+	first := IdentifyProduct(parser.RawOffer{OriginalText: "Gevalia. 450 g."}, models.Offer{Name: "Kaffe 450g"})
+	second := IdentifyProduct(parser.RawOffer{OriginalText: "GEVALIA. Jmf-pris 88,67 kr/kg."}, models.Offer{Name: "KAFFE 450 G"})
+	if first.Key != second.Key {
+		t.Errorf("the keys %q and %q differ", first.Key, second.Key)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"time"
+)
+
+// QuarantineService supports reviewing, fixing and releasing quarantined offers.
+type QuarantineService struct {
+	Quarantine repository.QuarantineRepository
+	Offers     repository.OfferRepository
+	Validator  *OfferValidator
+}
+
+// NewQuarantineService creates a new service instance with dependencies.
+func NewQuarantineService(quarantine repository.QuarantineRepository, offers repository.OfferRepository, validator *OfferValidator) *QuarantineService {
+	return &QuarantineService{
+		Quarantine: quarantine,
+		Offers:     offers,
+		Validator:  validator,
+	}
+}
+
+// List returns quarantined offers with the given status (all statuses if empty).
+func (s *QuarantineService) List(ctx context.Context, status string) ([]models.QuarantinedOffer, error) {
+	return s.Quarantine.ListQuarantined(ctx, status)
+}
+
+// Get returns a single quarantined offer.
+func (s *QuarantineService) Get(ctx context.Context, id uint) (*models.QuarantinedOffer, error) {
+	return s.Quarantine.GetQuarantined(ctx, id)
+}
+
+// Fix applies an edit to a pending quarantined offer, recalculates its discount
+// and re-runs validation so the reviewer can see whether it is now clean.
+func (s *QuarantineService) Fix(ctx context.Context, id uint, edit func(q *models.QuarantinedOffer)) (*models.QuarantinedOffer, *ValidationFailure, error) {
+	q, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	edit(q)
+	offer := q.ToOffer()
+	q.DiscountPercentage = calculateDiscount(offer)
+	offer.DiscountPercentage = q.DiscountPercentage
+
+	failure := s.validate(offer)
+	if failure != nil {
+		q.Rule, q.Reason = failure.Rule, failure.Reason
+	} else {
+		q.Rule, q.Reason = "", ""
+	}
+
+	if err := s.Quarantine.UpdateQuarantined(ctx, q); err != nil {
+		return nil, nil, err
+	}
+	return q, failure, nil
+}
+
+// Release moves a quarantined offer into the offers table. The offer must pass
+// validation unless force is set.
+func (s *QuarantineService) Release(ctx context.Context, id uint, force bool) (*models.QuarantinedOffer, error) {
+	q, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	offer := q.ToOffer()
+	if failure := s.validate(offer); failure != nil && !force {
+		return nil, fmt.Errorf("quarantined offer %d still fails validation: %w", id, failure)
+	}
+
+	if _, err := s.Offers.InsertOffers(ctx, []models.Offer{offer}); err != nil {
+		return nil, fmt.Errorf("failed to release quarantined offer %d: %w", id, err)
+	}
+
+	now := time.Now()
+	q.Status = models.QuarantineStatusReleased
+	q.ReleasedAt = &now
+	if err := s.Quarantine.UpdateQuarantined(ctx, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Discard marks a quarantined offer as reviewed and not to be released.
+func (s *QuarantineService) Discard(ctx context.Context, id uint) (*models.QuarantinedOffer, error) {
+	q, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	q.Status = models.QuarantineStatusDiscarded
+	if err := s.Quarantine.UpdateQuarantined(ctx, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (s *QuarantineService) pending(ctx context.Context, id uint) (*models.QuarantinedOffer, error) {
+	q, err := s.Quarantine.GetQuarantined(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if q.Status != models.QuarantineStatusPending {
+		return nil, fmt.Errorf("quarantined offer %d is already %s", id, q.Status)
+	}
+	return q, nil
+}
+
+func (s *QuarantineService) validate(offer models.Offer) *ValidationFailure {
+	if s.Validator == nil {
+		return nil
+	}
+	return s.Validator.Validate(offer)
+}
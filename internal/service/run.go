@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"sync"
+	"time"
+)
+
+// RunRecorder records a parser run in scrape_runs and the outcome of every store in
+// scrape_run_stores.
+type RunRecorder struct {
+	runs repository.ScrapeRunRepository
+
+	mu  sync.Mutex
+	run *models.ScrapeRun
+}
+
+// StartRun saves a new running run and returns a recorder for it.
+func StartRun(ctx context.Context, runs repository.ScrapeRunRepository, configHash, version string) (*RunRecorder, error) {
+	run := &models.ScrapeRun{
+		StartedAt:  time.Now(),
+		Status:     models.ScrapeRunRunning,
+		ConfigHash: configHash,
+		Version:    version,
+	}
+	if err := runs.StartRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return &RunRecorder{runs: runs, run: run}, nil
+}
+
+// ID returns the run ID, to be stored with the offers of the run.
+func (r *RunRecorder) ID() uint {
+	return r.run.ID
+}
+
+// Status returns the status of the run: running until Finish was called.
+func (r *RunRecorder) Status() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.run.Status
+}
+
+// RecordStore saves the outcome of a store: the pipeline counts from its batch, what
+// was written, and the first error of the pipeline or of saving its offers.
+func (r *RunRecorder) RecordStore(ctx context.Context, batch *OfferBatch, written repository.InsertResult, saveDuration time.Duration, saveErr error) error {
+	result := NewScrapeRunStore(r.run.ID, batch)
+	result.Inserted, result.Updated, result.Withdrawn = written.Inserted, written.Updated, written.Withdrawn
+	result.DurationMS += saveDuration.Milliseconds()
+	if saveErr != nil && result.Error == "" {
+		result.Status = models.ScrapeRunFailed
+		result.Error = saveErr.Error()
+	}
+	r.mu.Lock()
+	r.run.Stores = append(r.run.Stores, *result)
+	r.mu.Unlock()
+	return r.runs.SaveRunStore(ctx, result)
+}
+
+// Finish saves the final status: failed when runErr is set or every store failed,
+// partial when some stores failed, succeeded otherwise.
+func (r *RunRecorder) Finish(ctx context.Context, runErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failed := 0
+	for _, store := range r.run.Stores {
+		if store.Status != models.ScrapeRunSucceeded {
+			failed++
+		}
+	}
+	switch {
+	case runErr != nil:
+		r.run.Status = models.ScrapeRunFailed
+		r.run.Error = runErr.Error()
+	case failed > 0 && failed == len(r.run.Stores):
+		r.run.Status = models.ScrapeRunFailed
+	case failed > 0:
+		r.run.Status = models.ScrapeRunPartial
+	default:
+		r.run.Status = models.ScrapeRunSucceeded
+	}
+	finished := time.Now()
+	r.run.FinishedAt = &finished
+	return r.runs.FinishRun(ctx, r.run)
+}
+
+// NewScrapeRunStore summarizes a store's pipeline batch for the run log. The duration
+// is the time spent in the store's stages, without waiting for other stores.
+func NewScrapeRunStore(runID uint, batch *OfferBatch) *models.ScrapeRunStore {
+	result := &models.ScrapeRunStore{
+		RunID:      runID,
+		StoreID:    storeID(batch.Store),
+		StoreName:  batch.Store.Name,
+		Status:     models.ScrapeRunSucceeded,
+		Parsed:     len(batch.Items),
+		StartedAt:  batch.StartedAt,
+		FinishedAt: time.Now(),
+	}
+	var duration time.Duration
+	for _, report := range batch.Reports {
+		duration += report.Duration
+	}
+	if parsed, ok := batch.Report(StageParse); ok {
+		result.Fetched = parsed.ItemsOut
+	}
+	result.Skipped = max(result.Fetched-result.Parsed, 0)
+	if batch.Categorization != nil {
+		result.Categorized = len(batch.Categorization.Categories)
+		result.CategorizationFailed = len(batch.Categorization.Failed)
+	}
+	if batch.Err != nil {
+		result.Status = models.ScrapeRunFailed
+		result.Error = batch.Err.Error()
+		result.Parsed = 0
+	}
+	result.DurationMS = duration.Milliseconds()
+	return result
+}
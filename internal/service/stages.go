@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/parser"
+	"grocery_scraper/internal/repository"
+	"io"
+	"log"
+	"slices"
+)
+
+// Names of the built-in stages, for use with Pipeline.InsertBefore/InsertAfter.
+const (
+	StageFetch         = "fetch"
+	StageParse         = "parse"
+	StageNormalize     = "normalize"
+	StageValidate      = "validate"
+	StageMatchProducts = "match-products"
+	StageEnrich        = "enrich"
+	StageCategorize    = "categorize"
+)
+
+// PipelineDependencies holds the collaborators of the default stages.
+// Optional dependencies that are nil leave their stage out of the pipeline.
+type PipelineDependencies struct {
+	Repo        repository.ICARepository
+	Parser      parser.OfferParser
+	Validator   *OfferValidator                 // optional
+	Quarantine  repository.QuarantineRepository // optional
+	Products    repository.ProductRepository    // optional
+	Attributes  AttributeExtractor              // optional, AI extraction on top of the rules
+	Categorizer Categorizer                     // optional
+	// CategoryOverrides are manual corrections that win over the categorizer
+	CategoryOverrides repository.CategoryOverrideRepository // optional
+	// MinCategoryCoverage fails the run when fewer of a store's products are categorized
+	MinCategoryCoverage float64
+}
+
+// NewDefaultPipeline builds the standard pipeline:
+// fetch -> parse -> normalize -> validate -> match-products -> enrich per store,
+// then categorize once for all stores of the run.
+func NewDefaultPipeline(deps PipelineDependencies) *Pipeline {
+	p := NewPipeline(
+		&FetchStage{Repo: deps.Repo},
+		&ParseStage{Parser: deps.Parser},
+		&NormalizeStage{},
+	)
+	if deps.Validator != nil {
+		p.Append(&ValidateStage{Validator: deps.Validator, Quarantine: deps.Quarantine})
+	}
+	if deps.Products != nil {
+		p.Append(&ProductMatchStage{Products: deps.Products})
+	}
+	p.Append(&EnrichStage{Rules: NewRuleAttributeExtractor(), AI: deps.Attributes})
+	if deps.Categorizer != nil || deps.CategoryOverrides != nil {
+		p.AppendRunStage(&CategorizeStage{
+			Categorizer: deps.Categorizer,
+			Overrides:   deps.CategoryOverrides,
+			MinCoverage: deps.MinCategoryCoverage,
+		})
+	}
+	return p
+}
+
+// FetchStage downloads the rendered offers page of the store.
+type FetchStage struct {
+	Repo repository.ICARepository
+}
+
+func (s *FetchStage) Name() string { return StageFetch }
+
+func (s *FetchStage) Process(ctx context.Context, batch *OfferBatch) error {
+	storeURLStr := fmt.Sprintf("%s/%s", ICA_BASE_URL, batch.Store.URLSlug)
+	htmlReader, err := s.Repo.Fetch(ctx, storeURLStr)
+	if err != nil {
+		return fmt.Errorf("failed to fetch rendered HTML for %s: %w", batch.Store.Name, err)
+	}
+	batch.HTML = htmlReader
+	return nil
+}
+
+// ParseStage extracts the raw offer cards from the fetched page.
+type ParseStage struct {
+	Parser parser.OfferParser
+}
+
+func (s *ParseStage) Name() string { return StageParse }
+
+func (s *ParseStage) Process(ctx context.Context, batch *OfferBatch) error {
+	if batch.HTML == nil {
+		return fmt.Errorf("no HTML fetched for %s", batch.Store.Name)
+	}
+	// Ensure the reader is closed if it's an io.Closer
+	if closer, ok := batch.HTML.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	parsed, err := s.Parser.ParseRawOffers(ctx, batch.HTML)
+	batch.HTML = nil
+	if err != nil {
+		return fmt.Errorf("failed to extract raw offers for %s: %w", batch.Store.Name, err)
+	}
+
+	batch.Skipped = parsed.Skipped
+	for _, raw := range parsed.Offers {
+		batch.Items = append(batch.Items, &OfferItem{Raw: raw})
+	}
+	return nil
+}
+
+// NormalizeStage turns the raw card text into structured offers with prices and discounts.
+type NormalizeStage struct{}
+
+func (s *NormalizeStage) Name() string { return StageNormalize }
+
+func (s *NormalizeStage) Process(ctx context.Context, batch *OfferBatch) error {
+	validFrom, validTo := getValidityPeriod()
+	batch.Period = models.ValidityPeriod{From: validFrom, To: validTo}
+	for _, item := range batch.Items {
+		item.Offer = normalizeOffer(batch.Store, item.Raw, validFrom, validTo)
+	}
+	return nil
+}
+
+// ValidateStage drops offers that fail validation and writes them to quarantine.
+type ValidateStage struct {
+	Validator  *OfferValidator
+	Quarantine repository.QuarantineRepository
+}
+
+func (s *ValidateStage) Name() string { return StageValidate }
+
+func (s *ValidateStage) Process(ctx context.Context, batch *OfferBatch) error {
+	var quarantined []models.QuarantinedOffer
+	kept := batch.Items[:0]
+	for _, item := range batch.Items {
+		if failure := s.Validator.Validate(item.Offer); failure != nil {
+			quarantined = append(quarantined, models.NewQuarantinedOffer(item.Offer, item.Raw.OriginalText, item.Raw.DealText, failure.Rule, failure.Reason))
+			continue
+		}
+		kept = append(kept, item)
+	}
+	batch.Items = kept
+
+	if len(quarantined) == 0 {
+		return nil
+	}
+	batch.Quarantined = append(batch.Quarantined, quarantined...)
+	log.Printf("%d offers from %s failed validation and will be quarantined", len(quarantined), batch.Store.Name)
+	if s.Quarantine != nil {
+		if _, err := s.Quarantine.QuarantineOffers(ctx, quarantined); err != nil {
+			return fmt.Errorf("failed to quarantine offers for %s: %w", batch.Store.Name, err)
+		}
+	}
+	return nil
+}
+
+// CategorizeStage assigns categories to the offers. It runs once for all stores of
+// a run: offers of the same product are categorized once, no matter how many
+// stores sell it. Manual overrides always win and their products are not sent to
+// the categorizer. A failing categorizer is logged but does not fail the run; a
+// store with fewer than MinCoverage of its products categorized fails on its own,
+// with the error in its batch's Err, and the other stores are still saved.
+type CategorizeStage struct {
+	Categorizer Categorizer                           // optional when Overrides is set
+	Overrides   repository.CategoryOverrideRepository // optional
+	// MinCoverage is the share of products (0-1) that must be categorized; 0 accepts any result
+	MinCoverage float64
+}
+
+// manualConfidence is the confidence of the categories of a manual override.
+var manualConfidence = 1.0
+
+// maxLoggedFailures limits how many uncategorized products are listed in the log.
+const maxLoggedFailures = 10
+
+func (s *CategorizeStage) Name() string { return StageCategorize }
+
+// Process categorizes a single store, for pipelines that run the stage per store.
+func (s *CategorizeStage) Process(ctx context.Context, batch *OfferBatch) error {
+	return s.ProcessRun(ctx, []*OfferBatch{batch})
+}
+
+func (s *CategorizeStage) ProcessRun(ctx context.Context, batches []*OfferBatch) error {
+	var items []*OfferItem
+	for _, batch := range batches {
+		items = append(items, batch.Items...)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	overridden := s.applyCategoryOverrides(ctx, items)
+
+	// Every distinct product is sent once, under the text of the first offer seen
+	texts := make(map[string]string)
+	var products []string
+	for _, item := range items {
+		if _, ok := overridden[item]; ok {
+			continue
+		}
+		key := categorizationKey(item.Offer)
+		if _, ok := texts[key]; ok {
+			continue
+		}
+		text := categorizationText(item.Offer)
+		texts[key] = text
+		if !slices.Contains(products, text) {
+			products = append(products, text)
+		}
+	}
+
+	var result *CategorizationResult
+	var err error
+	if s.Categorizer != nil && len(products) > 0 {
+		result, err = s.Categorizer.Categorize(ctx, products)
+		if err != nil {
+			log.Printf("Warning: Failed to categorize products: %v", err)
+		}
+	}
+	if result == nil {
+		result = NewCategorizationResult()
+		if s.Categorizer != nil {
+			result.FailAll(products, fmt.Sprintf("categorizer failed: %v", err))
+		}
+	}
+	log.Printf("Categorized %d of %d distinct products for %d offers from %d stores (%d overridden)",
+		len(result.Categories), len(products), len(items), len(batches), len(overridden))
+
+	// Fan the results back out to the offers of every store
+	for _, batch := range batches {
+		batchResult := NewCategorizationResult()
+		for _, item := range batch.Items {
+			if cats, ok := overridden[item]; ok {
+				item.Offer.Categories = cats
+				item.Offer.CategorySource, item.Offer.CategoryConfidence = models.CategorySourceManual, &manualConfidence
+				batchResult.Set(categorizationText(item.Offer), cats)
+				continue
+			}
+			text := texts[categorizationKey(item.Offer)]
+			if cats := result.Categories[text]; len(cats) > 0 {
+				source := result.Sources[text]
+				item.Offer.Categories = cats
+				item.Offer.CategorySource, item.Offer.CategoryConfidence = source.Source, source.Confidence
+				batchResult.Set(text, cats)
+				batchResult.SetSource(text, source)
+			} else if reason, ok := result.Failed[text]; ok {
+				batchResult.Fail(text, reason)
+			}
+		}
+		batch.Categorization = batchResult
+
+		if len(batchResult.Failed) > 0 {
+			log.Printf("[%s] categorized %d products, %d failed", batch.Store.Name, len(batchResult.Categories), len(batchResult.Failed))
+			logged := 0
+			for product, reason := range batchResult.Failed {
+				if logged == maxLoggedFailures {
+					log.Printf("[%s]   ... and %d more", batch.Store.Name, len(batchResult.Failed)-logged)
+					break
+				}
+				log.Printf("[%s]   %q: %s", batch.Store.Name, product, reason)
+				logged++
+			}
+		}
+		if coverage := batchResult.Coverage(); coverage < s.MinCoverage {
+			batch.Err = fmt.Errorf("only %.0f%% of the products were categorized, %.0f%% are required", coverage*100, s.MinCoverage*100)
+			log.Printf("[%s] %v", batch.Store.Name, batch.Err)
+		}
+	}
+	return nil
+}
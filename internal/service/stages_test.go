@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recordingCategorizer categorizes the products it knows and fails the others,
+// remembering every product it was asked for.
+type recordingCategorizer struct {
+	categories map[string][]string
+
+	mu    sync.Mutex
+	asked []string
+}
+
+func (c *recordingCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	c.mu.Lock()
+	c.asked = append(c.asked, products...)
+	c.mu.Unlock()
+	result := NewCategorizationResult()
+	for _, product := range products {
+		if cats, ok := c.categories[product]; ok {
+			result.Set(product, cats)
+			result.SetSource(product, CategorySource{Source: models.CategorySourceAI})
+		} else {
+			result.Fail(product, "unknown product")
+		}
+	}
+	return result, nil
+}
+
+func TestCategorizeStageProcessRun(t *testing.T) {
+	milk, coffee := uint(1), uint(2)
+	item := func(name string, productID *uint) *OfferItem {
+		return &OfferItem{Offer: models.Offer{Name: name, ProductID: productID}}
+	}
+	maxi := &OfferBatch{Store: models.Store{Name: "ICA Maxi"}, Items: []*OfferItem{
+		item("Mellanmjölk 1,5l", &milk), item("Kaffe 450g", &coffee), item("Bananer", nil),
+	}}
+	// Kvantum sells the same milk under another name, and a product nobody knows
+	kvantum := &OfferBatch{Store: models.Store{Name: "ICA Kvantum"}, Items: []*OfferItem{
+		item("MELLANMJÖLK ARLA", &milk), item("Bananer", nil), item("Okänd vara", nil),
+	}}
+
+	categorizer := &recordingCategorizer{categories: map[string][]string{
+		"Mellanmjölk 1,5l": {"Mejeri"},
+		"Kaffe 450g":       {"Skafferi"},
+		"Bananer":          {"Frukt & Grönt"},
+	}}
+	stage := &CategorizeStage{Categorizer: categorizer, MinCoverage: 0.7}
+	if err := stage.ProcessRun(context.Background(), []*OfferBatch{maxi, kvantum}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Mellanmjölk 1,5l", "Kaffe 450g", "Bananer", "Okänd vara"}; !slices.Equal(categorizer.asked, want) {
+		t.Errorf("the categorizer was asked for %q, want every product once: %q", categorizer.asked, want)
+	}
+
+	want := map[*OfferItem][]string{
+		maxi.Items[0]: {"Mejeri"}, maxi.Items[1]: {"Skafferi"}, maxi.Items[2]: {"Frukt & Grönt"},
+		kvantum.Items[0]: {"Mejeri"}, kvantum.Items[1]: {"Frukt & Grönt"}, kvantum.Items[2]: nil,
+	}
+	for item, cats := range want {
+		if !slices.Equal(item.Offer.Categories, cats) {
+			t.Errorf("%s got the categories %v, want %v", item.Offer.Name, item.Offer.Categories, cats)
+		}
+		if cats != nil && item.Offer.CategorySource != models.CategorySourceAI {
+			t.Errorf("%s was categorized by %q", item.Offer.Name, item.Offer.CategorySource)
+		}
+	}
+
+	// Only Kvantum is below the coverage: 2 of its 3 products were categorized
+	if maxi.Err != nil {
+		t.Errorf("ICA Maxi failed: %v", maxi.Err)
+	}
+	if kvantum.Err == nil {
+		t.Error("ICA Kvantum did not fail with 67% of its products categorized")
+	}
+	if got := kvantum.Categorization.Failed; len(got) != 1 || got["Okänd vara"] != "unknown product" {
+		t.Errorf("ICA Kvantum reports the failures %v", got)
+	}
+	if got := maxi.Categorization.Coverage(); got != 1 {
+		t.Errorf("ICA Maxi has the coverage %v, want 1", got)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"grocery_scraper/internal/repository"
+	"regexp"
+	"strings"
+)
+
+// Matches the numeric ICA store ID at the end of an offers page slug, e.g. 'maxi-ica-stormarknad-kalmar-1004348'.
+var storeIDSlugRegex = regexp.MustCompile(`-(\d+)$`)
+
+// StoreExternalID extracts the chain's store ID from an offers page slug. A slug
+// without an ID is its own key.
+func StoreExternalID(urlSlug string) string {
+	if match := storeIDSlugRegex.FindStringSubmatch(urlSlug); len(match) > 1 {
+		return match[1]
+	}
+	return urlSlug
+}
+
+// StoreProfile derives the ICA store profile from the store name.
+func StoreProfile(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "maxi"):
+		return models.StoreProfileMaxi
+	case strings.Contains(lower, "kvantum"):
+		return models.StoreProfileKvantum
+	case strings.Contains(lower, "supermarket"):
+		return models.StoreProfileSupermarket
+	case strings.Contains(lower, "nära"):
+		return models.StoreProfileNara
+	}
+	return ""
+}
+
+// StoreCatalogService searches for stores and keeps their metadata in the catalogue.
+type StoreCatalogService struct {
+	Lookup repository.StoreLookup
+	Stores repository.StoreRepository
+}
+
+// NewStoreCatalogService creates a new service instance with dependencies.
+func NewStoreCatalogService(lookup repository.StoreLookup, stores repository.StoreRepository) *StoreCatalogService {
+	return &StoreCatalogService{
+		Lookup: lookup,
+		Stores: stores,
+	}
+}
+
+// Search finds stores by name, city or postal code and saves their metadata.
+func (s *StoreCatalogService) Search(ctx context.Context, query string) ([]models.StoreInfo, error) {
+	found, err := s.Lookup.SearchStores(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		completeStoreInfo(&found[i])
+	}
+	if err := s.Stores.UpsertStores(ctx, found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Find returns a store by its external ID, from the catalogue if it is already
+// known and from the lookup source otherwise.
+func (s *StoreCatalogService) Find(ctx context.Context, chain, externalID string) (*models.StoreInfo, error) {
+	if store, err := s.Stores.GetStore(ctx, chain, externalID); err == nil {
+		return store, nil
+	}
+
+	found, err := s.Search(ctx, externalID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		if found[i].Chain == chain && found[i].ExternalID == externalID {
+			return &found[i], nil
+		}
+	}
+	return nil, fmt.Errorf("store %s/%s not found", chain, externalID)
+}
+
+// RegisterStores adds the stores of the scrape list to the catalogue, updating the
+// name and slug of the ones it already has, and returns them with their IDs set.
+// Offers are linked to the catalogue entry, so renaming a store keeps its offers.
+func RegisterStores(ctx context.Context, stores repository.StoreRepository, targets []models.Store) ([]models.Store, error) {
+	infos := make([]models.StoreInfo, len(targets))
+	for i, target := range targets {
+		infos[i] = models.StoreInfo{Name: target.Name, URLSlug: target.URLSlug}
+		completeStoreInfo(&infos[i])
+	}
+	if err := stores.RegisterStores(ctx, infos); err != nil {
+		return nil, err
+	}
+	registered := make([]models.Store, len(targets))
+	for i, info := range infos {
+		registered[i] = info.ScrapeTarget()
+	}
+	return registered, nil
+}
+
+// storeID returns the catalogue ID of a store, nil if it was not registered.
+func storeID(store models.Store) *uint {
+	if store.ID == 0 {
+		return nil
+	}
+	id := store.ID
+	return &id
+}
+
+// completeStoreInfo fills in the fields that can be derived from the others.
+func completeStoreInfo(store *models.StoreInfo) {
+	if store.Chain == "" {
+		store.Chain = models.ChainICA
+	}
+	if store.ExternalID == "" {
+		store.ExternalID = StoreExternalID(store.URLSlug)
+	}
+	if store.Profile == "" {
+		store.Profile = StoreProfile(store.Name)
+	}
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"grocery_scraper/internal/models"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Taxonomy modes control what happens to labels that are not an exact taxonomy label.
+const (
+	// TaxonomyModeFuzzy maps near misses ("Mejeriprodukter", "Mejer") to the closest category
+	TaxonomyModeFuzzy = "fuzzy"
+	// TaxonomyModeStrict rejects every label that is not an ID, label or alias
+	TaxonomyModeStrict = "strict"
+)
+
+// fuzzySimilarity is the minimum edit-distance similarity for a fuzzy match.
+const fuzzySimilarity = 0.8
+
+// minPrefixLength keeps short labels from matching every compound word that starts with them.
+const minPrefixLength = 4
+
+// Taxonomy is a loaded category taxonomy with lookup indexes.
+type Taxonomy struct {
+	models.Taxonomy
+
+	byID   map[string]models.TaxonomyCategory
+	labels map[string]string // normalized ID, label or alias -> category ID
+}
+
+// LoadTaxonomy reads and validates a taxonomy file.
+func LoadTaxonomy(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read taxonomy %s: %w", path, err)
+	}
+	var def models.Taxonomy
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to parse taxonomy %s: %w", path, err)
+	}
+	return NewTaxonomy(def)
+}
+
+// NewTaxonomy validates a taxonomy and builds its indexes. IDs must be unique, every
+// parent must exist, the hierarchy must not have cycles, and no label may point to
+// two different categories.
+func NewTaxonomy(def models.Taxonomy) (*Taxonomy, error) {
+	t := &Taxonomy{
+		Taxonomy: def,
+		byID:     make(map[string]models.TaxonomyCategory),
+		labels:   make(map[string]string),
+	}
+	for _, cat := range def.Categories {
+		if cat.ID == "" || cat.LabelSV == "" {
+			return nil, fmt.Errorf("taxonomy category %q needs an id and a Swedish label", cat.ID)
+		}
+		if _, ok := t.byID[cat.ID]; ok {
+			return nil, fmt.Errorf("duplicate taxonomy category id %q", cat.ID)
+		}
+		t.byID[cat.ID] = cat
+	}
+
+	for _, cat := range def.Categories {
+		if cat.Parent != "" {
+			if _, ok := t.byID[cat.Parent]; !ok {
+				return nil, fmt.Errorf("taxonomy category %q has unknown parent %q", cat.ID, cat.Parent)
+			}
+		}
+		seen := map[string]bool{cat.ID: true}
+		for parent := cat.Parent; parent != ""; parent = t.byID[parent].Parent {
+			if seen[parent] {
+				return nil, fmt.Errorf("taxonomy category %q is part of a parent cycle", cat.ID)
+			}
+			seen[parent] = true
+		}
+
+		names := append([]string{cat.ID, cat.LabelSV, cat.LabelEN}, cat.Aliases...)
+		for _, name := range names {
+			key := normalizeLabel(name)
+			if key == "" {
+				continue
+			}
+			if other, ok := t.labels[key]; ok && other != cat.ID {
+				return nil, fmt.Errorf("taxonomy label %q is used by both %q and %q", name, other, cat.ID)
+			}
+			t.labels[key] = cat.ID
+		}
+	}
+	return t, nil
+}
+
+// normalizeLabel makes labels comparable: lower case, "&" and "och" are the same,
+// and punctuation is ignored.
+func normalizeLabel(label string) string {
+	label = strings.ToLower(label)
+	label = strings.ReplaceAll(label, "&", " och ")
+	label = nonWordRegex.ReplaceAllString(label, " ")
+	return strings.Join(strings.Fields(label), " ")
+}
+
+// Category returns the category with the given ID.
+func (t *Taxonomy) Category(id string) (models.TaxonomyCategory, bool) {
+	cat, ok := t.byID[id]
+	return cat, ok
+}
+
+// Ancestors returns the IDs of a category's parents, nearest first.
+func (t *Taxonomy) Ancestors(id string) []string {
+	var ancestors []string
+	for parent := t.byID[id].Parent; parent != ""; parent = t.byID[parent].Parent {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// Descendants returns the IDs of a category's children, their children and so on,
+// in file order.
+func (t *Taxonomy) Descendants(id string) []string {
+	var descendants []string
+	for _, cat := range t.Categories {
+		if cat.ID != id && slices.Contains(t.Ancestors(cat.ID), id) {
+			descendants = append(descendants, cat.ID)
+		}
+	}
+	return descendants
+}
+
+// Labels returns the Swedish label of every category, in file order.
+func (t *Taxonomy) Labels() []string {
+	labels := make([]string, 0, len(t.Categories))
+	for _, cat := range t.Categories {
+		labels = append(labels, cat.LabelSV)
+	}
+	return labels
+}
+
+// Resolve maps a category label returned by a categorizer to a category ID. Exact
+// matches on ID, label or alias always resolve; with fuzzy set, compound words
+// starting with a known label ("Mejeriprodukter") and small misspellings do as well.
+func (t *Taxonomy) Resolve(label string, fuzzy bool) (string, bool) {
+	key := normalizeLabel(label)
+	if key == "" {
+		return "", false
+	}
+	if id, ok := t.labels[key]; ok {
+		return id, true
+	}
+	if !fuzzy {
+		return "", false
+	}
+
+	// Sorted so the result does not depend on map iteration order
+	known := make([]string, 0, len(t.labels))
+	for name := range t.labels {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+
+	bestID, bestScore := "", 0.0
+	for _, name := range known {
+		score := labelSimilarity(key, name)
+		if len([]rune(name)) >= minPrefixLength && strings.HasPrefix(key, name) {
+			// Longer prefixes are more specific, but never beat an exact-length match
+			score = max(score, fuzzySimilarity+0.1*float64(len(name))/float64(len(key)))
+		}
+		if score > bestScore {
+			bestID, bestScore = t.labels[name], score
+		}
+	}
+	if bestScore < fuzzySimilarity {
+		return "", false
+	}
+	return bestID, true
+}
+
+// labelSimilarity is 1 minus the edit distance relative to the longer string.
+func labelSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// TaxonomyCategorizer wraps a categorizer and replaces the labels it returns with
+// taxonomy IDs. Labels that cannot be resolved are dropped and logged, so only
+// known categories reach the database.
+type TaxonomyCategorizer struct {
+	next     Categorizer
+	taxonomy *Taxonomy
+	fuzzy    bool
+}
+
+// NewTaxonomyCategorizer creates a categorizer that validates results against the
+// taxonomy. The mode is TaxonomyModeFuzzy or TaxonomyModeStrict.
+func NewTaxonomyCategorizer(next Categorizer, taxonomy *Taxonomy, mode string) (*TaxonomyCategorizer, error) {
+	switch mode {
+	case TaxonomyModeFuzzy, "":
+		mode = TaxonomyModeFuzzy
+	case TaxonomyModeStrict:
+	default:
+		return nil, fmt.Errorf("unknown taxonomy mode %q", mode)
+	}
+	return &TaxonomyCategorizer{
+		next:     next,
+		taxonomy: taxonomy,
+		fuzzy:    mode == TaxonomyModeFuzzy,
+	}, nil
+}
+
+// Categorize implements Categorizer.
+func (c *TaxonomyCategorizer) Categorize(ctx context.Context, products []string) (*CategorizationResult, error) {
+	result, err := c.next.Categorize(ctx, products)
+	if result == nil {
+		return nil, err
+	}
+
+	mapped := NewCategorizationResult()
+	for product, reason := range result.Failed {
+		mapped.Fail(product, reason)
+	}
+	rejected := make(map[string]int)
+	for product, labels := range result.Categories {
+		var ids, unknown []string
+		for _, label := range labels {
+			id, ok := c.taxonomy.Resolve(label, c.fuzzy)
+			if !ok {
+				rejected[label]++
+				unknown = append(unknown, label)
+				continue
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			mapped.Set(product, ids)
+			mapped.SetSource(product, result.Sources[product])
+		} else {
+			mapped.Fail(product, fmt.Sprintf("categories not in taxonomy: %s", strings.Join(unknown, ", ")))
+		}
+	}
+
+	if len(rejected) > 0 {
+		log.Printf("Warning: rejected category labels not in taxonomy v%d: %v", c.taxonomy.Version, rejected)
+	}
+	return mapped, err
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"grocery_scraper/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testTaxonomy is a small taxonomy with a hierarchy, aliases and English labels.
+var testTaxonomy = models.Taxonomy{
+	Version: 1,
+	Categories: []models.TaxonomyCategory{
+		{ID: "mejeri", LabelSV: "Mejeri", LabelEN: "Dairy products", Aliases: []string{"Dairy"}},
+		{ID: "mejeri.ost", Parent: "mejeri", LabelSV: "Ost", LabelEN: "Cheese", Aliases: []string{"Ostar"}},
+		{ID: "mejeri.mjolk", Parent: "mejeri", LabelSV: "Mjölk", LabelEN: "Milk"},
+		{ID: "frukt", LabelSV: "Frukt & Grönt", LabelEN: "Fruit & Vegetables"},
+		{ID: "skafferi", LabelSV: "Skafferi", LabelEN: "Pantry"},
+	},
+}
+
+func TestNewTaxonomy(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []models.TaxonomyCategory
+		wantErr    string
+	}{
+		{name: "valid", categories: testTaxonomy.Categories},
+		{name: "missing label", categories: []models.TaxonomyCategory{{ID: "mejeri"}}, wantErr: "needs an id"},
+		{name: "duplicate id", categories: []models.TaxonomyCategory{
+			{ID: "mejeri", LabelSV: "Mejeri"}, {ID: "mejeri", LabelSV: "Mejeriprodukter"},
+		}, wantErr: "duplicate taxonomy category id"},
+		{name: "unknown parent", categories: []models.TaxonomyCategory{
+			{ID: "mejeri.ost", Parent: "mejeri", LabelSV: "Ost"},
+		}, wantErr: "unknown parent"},
+		{name: "own parent", categories: []models.TaxonomyCategory{
+			{ID: "mejeri", Parent: "mejeri", LabelSV: "Mejeri"},
+		}, wantErr: "cycle"},
+		{name: "cycle", categories: []models.TaxonomyCategory{
+			{ID: "a", Parent: "c", LabelSV: "A"}, {ID: "b", Parent: "a", LabelSV: "B"}, {ID: "c", Parent: "b", LabelSV: "C"},
+		}, wantErr: "cycle"},
+		{name: "duplicate label", categories: []models.TaxonomyCategory{
+			{ID: "mejeri.ost", LabelSV: "Ost"}, {ID: "deli.ost", LabelSV: "Ost"},
+		}, wantErr: `label "Ost" is used by both`},
+		{name: "alias of another category", categories: []models.TaxonomyCategory{
+			{ID: "frukt", LabelSV: "Frukt & Grönt"}, {ID: "gront", LabelSV: "Grönsaker", Aliases: []string{"frukt och grönt"}},
+		}, wantErr: "is used by both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTaxonomy(models.Taxonomy{Version: 1, Categories: tt.categories})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTaxonomyResolve(t *testing.T) {
+	taxonomy, err := NewTaxonomy(testTaxonomy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		label  string
+		strict string // the category in strict mode, "" if the label is rejected
+		fuzzy  string // the category in fuzzy mode
+	}{
+		{label: "mejeri.ost", strict: "mejeri.ost", fuzzy: "mejeri.ost"},
+		{label: "MEJERI", strict: "mejeri", fuzzy: "mejeri"},
+		{label: "Dairy", strict: "mejeri", fuzzy: "mejeri"},
+		{label: "Cheese", strict: "mejeri.ost", fuzzy: "mejeri.ost"},
+		{label: "Ostar", strict: "mejeri.ost", fuzzy: "mejeri.ost"},
+		{label: "Frukt och grönt", strict: "frukt", fuzzy: "frukt"},
+		{label: "fruit & vegetables!", strict: "frukt", fuzzy: "frukt"},
+		{label: "Mejeriprodukter", fuzzy: "mejeri"},
+		{label: "Mjölkprodukter", fuzzy: "mejeri.mjolk"},
+		{label: "Mejer", fuzzy: "mejeri"},
+		{label: "Skafferie", fuzzy: "skafferi"},
+		// Labels shorter than minPrefixLength do not match compound words
+		{label: "Ostkaka"},
+		{label: "Elektronik"},
+		{label: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			if got, ok := taxonomy.Resolve(tt.label, false); got != tt.strict || ok != (tt.strict != "") {
+				t.Errorf("strict: Resolve(%q) = %q, %v, want %q", tt.label, got, ok, tt.strict)
+			}
+			if got, ok := taxonomy.Resolve(tt.label, true); got != tt.fuzzy || ok != (tt.fuzzy != "") {
+				t.Errorf("fuzzy: Resolve(%q) = %q, %v, want %q", tt.label, got, ok, tt.fuzzy)
+			}
+		})
+	}
+
+	if got := taxonomy.Ancestors("mejeri.ost"); !slices.Equal(got, []string{"mejeri"}) {
+		t.Errorf("Ancestors(mejeri.ost) = %v", got)
+	}
+	if got := taxonomy.Descendants("mejeri"); !slices.Equal(got, []string{"mejeri.ost", "mejeri.mjolk"}) {
+		t.Errorf("Descendants(mejeri) = %v", got)
+	}
+}
+
+func TestTaxonomyCategorizer(t *testing.T) {
+	taxonomy, err := NewTaxonomy(testTaxonomy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &recordingCategorizer{categories: map[string][]string{
+		"Prästost":   {"Ostar", "Mejeriprodukter", "Ost"},
+		"Hörlurar":   {"Elektronik"},
+		"Mjölk 1,5l": {"Mjölkprodukter"},
+	}}
+	products := []string{"Prästost", "Hörlurar", "Mjölk 1,5l"}
+
+	tests := []struct {
+		mode string
+		want map[string][]string
+	}{
+		{mode: TaxonomyModeStrict, want: map[string][]string{"Prästost": {"mejeri.ost"}}},
+		{mode: TaxonomyModeFuzzy, want: map[string][]string{"Prästost": {"mejeri.ost", "mejeri"}, "Mjölk 1,5l": {"mejeri.mjolk"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			categorizer, err := NewTaxonomyCategorizer(next, taxonomy, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := categorizer.Categorize(context.Background(), products)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, product := range products {
+				want, ok := tt.want[product]
+				if got := result.Categories[product]; !slices.Equal(got, want) {
+					t.Errorf("%s got %v, want %v", product, got, want)
+				}
+				if !ok && !strings.HasPrefix(result.Failed[product], "categories not in taxonomy") {
+					t.Errorf("%s failed with %q", product, result.Failed[product])
+				}
+			}
+		})
+	}
+
+	if _, err := NewTaxonomyCategorizer(next, taxonomy, "loose"); err == nil {
+		t.Error("an unknown mode was accepted")
+	}
+}
+
+func TestLoadTaxonomy(t *testing.T) {
+	taxonomy, err := LoadTaxonomy("../../data/taxonomy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taxonomy.Labels()) == 0 {
+		t.Error("the taxonomy has no categories")
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"grocery_scraper/internal/models"
+	"strings"
+)
+
+// Names of the built-in validation rules, as used in config.yaml.
+const (
+	RuleNameRequired          = "name_required"
+	RulePositiveSalePrice     = "positive_sale_price"
+	RuleNonNegativeDiscount   = "non_negative_discount"
+	RuleOriginalNotBelowSale  = "original_price_not_below_sale"
+	RuleMaxDiscountPercentage = "max_discount_percentage"
+)
+
+// DefaultValidationRules are enforced when no rules are configured.
+var DefaultValidationRules = []string{
+	RuleNameRequired,
+	RulePositiveSalePrice,
+	RuleNonNegativeDiscount,
+	RuleOriginalNotBelowSale,
+}
+
+// ValidationRule checks a single property of a parsed offer.
+type ValidationRule interface {
+	Name() string
+	Check(offer models.Offer) error
+}
+
+// ValidationFailure describes the first rule an offer failed.
+type ValidationFailure struct {
+	Rule   string
+	Reason string
+}
+
+func (f *ValidationFailure) Error() string {
+	return fmt.Sprintf("%s: %s", f.Rule, f.Reason)
+}
+
+// ruleFunc adapts a plain function to the ValidationRule interface.
+type ruleFunc struct {
+	name  string
+	check func(offer models.Offer) error
+}
+
+func (r ruleFunc) Name() string                   { return r.name }
+func (r ruleFunc) Check(offer models.Offer) error { return r.check(offer) }
+
+// OfferValidator runs a configured set of rules against offers.
+type OfferValidator struct {
+	rules []ValidationRule
+}
+
+// NewOfferValidator builds a validator from rule names. An empty list enables
+// DefaultValidationRules. maxDiscount is only used by the max_discount_percentage rule.
+func NewOfferValidator(ruleNames []string, maxDiscount float64) (*OfferValidator, error) {
+	if len(ruleNames) == 0 {
+		ruleNames = DefaultValidationRules
+	}
+
+	v := &OfferValidator{}
+	for _, name := range ruleNames {
+		rule, err := newValidationRule(strings.TrimSpace(name), maxDiscount)
+		if err != nil {
+			return nil, err
+		}
+		v.rules = append(v.rules, rule)
+	}
+	return v, nil
+}
+
+// AddRule registers an extra rule that runs after the configured ones.
+func (v *OfferValidator) AddRule(rule ValidationRule) {
+	v.rules = append(v.rules, rule)
+}
+
+// Validate returns the first failing rule, or nil if the offer is clean.
+func (v *OfferValidator) Validate(offer models.Offer) *ValidationFailure {
+	for _, rule := range v.rules {
+		if err := rule.Check(offer); err != nil {
+			return &ValidationFailure{Rule: rule.Name(), Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func newValidationRule(name string, maxDiscount float64) (ValidationRule, error) {
+	switch name {
+	case RuleNameRequired:
+		return ruleFunc{name, func(o models.Offer) error {
+			if strings.TrimSpace(o.Name) == "" {
+				return fmt.Errorf("product name is empty")
+			}
+			return nil
+		}}, nil
+	case RulePositiveSalePrice:
+		return ruleFunc{name, checkSalePrice}, nil
+	case RuleNonNegativeDiscount:
+		return ruleFunc{name, func(o models.Offer) error {
+			if o.DiscountPercentage < 0 {
+				return fmt.Errorf("discount percentage %.2f is negative", o.DiscountPercentage)
+			}
+			return nil
+		}}, nil
+	case RuleOriginalNotBelowSale:
+		return ruleFunc{name, checkOriginalPrice}, nil
+	case RuleMaxDiscountPercentage:
+		if maxDiscount <= 0 {
+			return nil, fmt.Errorf("validation rule %q requires a positive max_discount_percentage", name)
+		}
+		return ruleFunc{name, func(o models.Offer) error {
+			if o.DiscountPercentage > maxDiscount {
+				return fmt.Errorf("discount percentage %.2f exceeds %.2f", o.DiscountPercentage, maxDiscount)
+			}
+			return nil
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unknown validation rule %q", name)
+	}
+}
+
+// checkSalePrice requires a positive price for the offer's type. Percentage offers
+// carry no price of their own, so they need a positive discount instead.
+func checkSalePrice(o models.Offer) error {
+	switch o.Type {
+	case "single":
+		if o.SalePrice <= 0 {
+			return fmt.Errorf("sale price %.2f is not positive", o.SalePrice)
+		}
+	case "multibuy":
+		if o.SaleQuantity <= 0 || o.SalePriceTotal <= 0 {
+			return fmt.Errorf("multibuy %d for %.2f is not positive", o.SaleQuantity, o.SalePriceTotal)
+		}
+	case "percentage":
+		if o.Discount <= 0 {
+			return fmt.Errorf("percentage discount %d is not positive", o.Discount)
+		}
+	default:
+		return fmt.Errorf("offer type %q has no sale price", o.Type)
+	}
+	return nil
+}
+
+// checkOriginalPrice rejects offers where the original price is lower than what
+// the offer charges for the same quantity.
+func checkOriginalPrice(o models.Offer) error {
+	if o.OriginalPrice <= 0 {
+		return nil
+	}
+	switch o.Type {
+	case "single":
+		if o.OriginalPrice < o.SalePrice {
+			return fmt.Errorf("original price %.2f is lower than sale price %.2f", o.OriginalPrice, o.SalePrice)
+		}
+	case "multibuy":
+		if o.SaleQuantity > 0 && o.OriginalPrice*float64(o.SaleQuantity) < o.SalePriceTotal {
+			return fmt.Errorf("original price %.2f x %d is lower than sale total %.2f", o.OriginalPrice, o.SaleQuantity, o.SalePriceTotal)
+		}
+	}
+	return nil
+}